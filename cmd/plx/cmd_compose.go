@@ -68,6 +68,9 @@ func runComposeUp(engine *container.Engine, config *compose.ComposeConfig, proje
 			Args:        svc.Command,
 			Detach:      true, // Generally compose up matches detach or attaches all. Let's default to detach for now.
 			Interactive: false,
+			Restart:     svc.Restart,
+			LogDriver:   svc.Logging.Driver,
+			LogOpts:     svc.Logging.Options,
 		}
 
 		// Service Discovery: Add previously started services to ExtraHosts
@@ -103,6 +106,12 @@ func runComposeUp(engine *container.Engine, config *compose.ComposeConfig, proje
 			}
 		}
 
+		// Resources (deploy.resources.limits, cpuset, memswap_limit)
+		if err := applyComposeResources(&opts, svc); err != nil {
+			fmt.Printf("Failed to start %s: %v\n", name, err)
+			continue
+		}
+
 		// Run
 		if err := engine.Run(opts); err != nil {
 			fmt.Printf("Failed to start %s: %v\n", name, err)
@@ -134,10 +143,41 @@ func runComposeDown(engine *container.Engine, config *compose.ComposeConfig, pro
 		containers, _ := engine.List()
 		for _, c := range containers {
 			if c.Name == containerName {
-				_ = engine.Stop(c.ID)
+				_ = engine.Stop(c.ID, container.DefaultStopTimeout)
 				_ = engine.Remove(c.ID)
 				fmt.Printf("Removed %s\n", containerName)
 			}
 		}
 	}
 }
+
+// applyComposeResources maps a service's resource limits onto the run options.
+func applyComposeResources(opts *container.RunOptions, svc compose.ServiceConfig) error {
+	limits := svc.Deploy.Resources.Limits
+	if limits.Memory != "" {
+		n, err := container.ParseMemoryBytes(limits.Memory)
+		if err != nil {
+			return fmt.Errorf("deploy.resources.limits.memory: %w", err)
+		}
+		opts.Memory = n
+	}
+	if svc.MemswapLimit == "-1" {
+		opts.MemorySwap = -1
+	} else if svc.MemswapLimit != "" {
+		n, err := container.ParseMemoryBytes(svc.MemswapLimit)
+		if err != nil {
+			return fmt.Errorf("memswap_limit: %w", err)
+		}
+		opts.MemorySwap = n
+	}
+	if limits.CPUs != "" {
+		n, err := strconv.ParseFloat(limits.CPUs, 64)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("deploy.resources.limits.cpus: invalid value %q", limits.CPUs)
+		}
+		opts.CPUs = n
+	}
+	opts.CpusetCpus = svc.Cpuset
+	opts.PidsLimit = limits.Pids
+	return nil
+}
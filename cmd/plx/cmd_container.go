@@ -1,8 +1,16 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
 
 	"PocketLinx/pkg/container"
 )
@@ -20,26 +28,60 @@ func handlePs(engine *container.Engine) {
 		if len(displayCmd) > 30 {
 			displayCmd = displayCmd[:27] + "..."
 		}
+		status := c.Status
+		if c.Status == "Exited" && c.ExitReason == "unknown" {
+			status += " (unknown)" // found dead, see reconcile
+		} else if c.Status == "Exited" && !c.FinishedAt.IsZero() {
+			status += fmt.Sprintf(" (%d)", c.ExitCode)
+		}
+		if c.Status == "Running" && c.Health != "" {
+			status += " (" + c.Health + ")"
+		}
+		if c.RestartCount > 0 {
+			status += fmt.Sprintf(" [restarts: %d]", c.RestartCount)
+		}
 		rows = append(rows, []string{
 			c.ID,
 			c.Name,
 			displayCmd,
 			c.Created.Format("2006-01-02 15:04:05"),
-			c.Status,
+			status,
 		})
 	}
 	container.PrintTable(headers, rows)
 }
 
 func handleStop(engine *container.Engine, args []string) {
-	if len(args) < 1 {
-		fmt.Println("Usage: plx stop <container_id>")
-		os.Exit(1)
+	timeout := container.DefaultStopTimeout
+	var ids []string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "-t", "--time", "--timeout":
+			if i+1 >= len(args) {
+				fmt.Println("Error: flag needs an argument: -t")
+				os.Exit(1)
+			}
+			secs, err := strconv.Atoi(args[i+1])
+			if err != nil || secs < 0 {
+				fmt.Printf("Error: invalid timeout '%s'\n", args[i+1])
+				os.Exit(1)
+			}
+			timeout = time.Duration(secs) * time.Second
+			i++
+		default:
+			ids = append(ids, args[i])
+		}
 	}
-	if err := engine.Stop(args[0]); err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to stop container: %v\n", err)
+	if len(ids) < 1 {
+		fmt.Println("Usage: plx stop [-t seconds] <container_id>...")
 		os.Exit(1)
 	}
+	for _, id := range ids {
+		if err := engine.Stop(id, timeout); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to stop container: %v\n", err)
+			os.Exit(1)
+		}
+	}
 }
 
 func handleStart(engine *container.Engine, args []string) {
@@ -54,16 +96,55 @@ func handleStart(engine *container.Engine, args []string) {
 }
 
 func handleLogs(engine *container.Engine, args []string) {
-	if len(args) < 1 {
-		fmt.Println("Usage: plx logs <container_id>")
+	opts := container.LogOptions{Tail: -1}
+	var ids []string
+	now := time.Now()
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch arg {
+		case "-f", "--follow":
+			opts.Follow = true
+		case "-t", "--timestamps":
+			opts.Timestamps = true
+		case "-n", "--tail", "--since", "--until":
+			if i+1 >= len(args) {
+				fmt.Printf("Error: flag needs an argument: %s\n", arg)
+				os.Exit(1)
+			}
+			val := args[i+1]
+			i++
+			var err error
+			switch arg {
+			case "-n", "--tail":
+				if val == "all" {
+					opts.Tail = -1
+				} else {
+					opts.Tail, err = strconv.Atoi(val)
+					if err == nil && opts.Tail < 0 {
+						err = fmt.Errorf("must not be negative")
+					}
+				}
+			case "--since":
+				opts.Since, err = container.ParseLogTime(val, now)
+			case "--until":
+				opts.Until, err = container.ParseLogTime(val, now)
+			}
+			if err != nil {
+				fmt.Printf("Error: invalid %s '%s': %v\n", arg, val, err)
+				os.Exit(1)
+			}
+		default:
+			ids = append(ids, arg)
+		}
+	}
+	if len(ids) != 1 {
+		fmt.Println("Usage: plx logs [-f] [-t] [--tail N] [--since time] [--until time] <container_id>")
 		os.Exit(1)
 	}
-	logs, err := engine.Logs(args[0])
-	if err != nil {
+	if err := engine.Logs(context.Background(), ids[0], opts, os.Stdout); err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to get logs: %v\n", err)
 		os.Exit(1)
 	}
-	fmt.Print(logs)
 }
 
 func handleRm(engine *container.Engine, args []string) {
@@ -126,3 +207,256 @@ func handleExec(engine *container.Engine, args []string) {
 		os.Exit(1)
 	}
 }
+
+func handleStats(engine *container.Engine, args []string) {
+	stream, format := true, "table"
+	var filter []string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--no-stream":
+			stream = false
+		case "--format":
+			if i+1 >= len(args) {
+				fmt.Println("Error: flag needs an argument: --format")
+				os.Exit(1)
+			}
+			format = args[i+1]
+			i++
+		default:
+			filter = append(filter, args[i])
+		}
+	}
+	if format != "table" && format != "json" {
+		fmt.Printf("Error: invalid format '%s' (expected table or json)\n", format)
+		os.Exit(1)
+	}
+
+	var prev []container.ContainerStats
+	for {
+		stats, err := engine.Stats(prev)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to get stats: %v\n", err)
+			os.Exit(1)
+		}
+		prev = stats
+
+		selected := make([]container.ContainerStats, 0, len(stats))
+		for _, st := range stats {
+			if statsSelected(st, filter) {
+				selected = append(selected, st)
+			}
+		}
+		if format == "json" {
+			data, _ := json.Marshal(selected)
+			fmt.Println(string(data))
+		} else {
+			if stream {
+				fmt.Print("\x1b[H\x1b[2J")
+			}
+			printStats(selected)
+		}
+		if !stream {
+			return
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// statsSelected reports whether st matches one of the container IDs (or ID prefixes)
+// and names given on the command line. No filter selects every container.
+func statsSelected(st container.ContainerStats, filter []string) bool {
+	if len(filter) == 0 {
+		return true
+	}
+	for _, f := range filter {
+		if f == st.Name || strings.HasPrefix(st.ID, f) {
+			return true
+		}
+	}
+	return false
+}
+
+func printStats(stats []container.ContainerStats) {
+	headers := []string{"CONTAINER ID", "NAME", "CPU %", "MEM USAGE / LIMIT", "MEM %", "NET I/O", "BLOCK I/O", "PIDS"}
+	var rows [][]string
+	for _, st := range stats {
+		rows = append(rows, []string{
+			st.ID,
+			st.Name,
+			fmt.Sprintf("%.2f%%", st.CPUPercent),
+			container.FormatBytes(st.MemoryUsage) + " / " + container.FormatBytes(st.MemoryLimit),
+			fmt.Sprintf("%.2f%%", st.MemoryPercent),
+			container.FormatBytes(st.NetRx) + " / " + container.FormatBytes(st.NetTx),
+			container.FormatBytes(st.BlockRead) + " / " + container.FormatBytes(st.BlockWrite),
+			strconv.FormatInt(st.Pids, 10),
+		})
+	}
+	container.PrintTable(headers, rows)
+}
+
+func handleWait(engine *container.Engine, args []string) {
+	if len(args) < 1 {
+		fmt.Println("Usage: plx wait <container_id>...")
+		os.Exit(1)
+	}
+	failed := false
+	for _, id := range args {
+		code, err := engine.Wait(id)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to wait for %s: %v\n", id, err)
+			failed = true
+			continue
+		}
+		fmt.Println(code)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func handleTop(engine *container.Engine, args []string) {
+	if len(args) < 1 {
+		fmt.Println("Usage: plx top <container_id> [ps options]")
+		os.Exit(1)
+	}
+	top, err := engine.Top(args[0], args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to list processes: %v\n", err)
+		os.Exit(1)
+	}
+	container.PrintTable(top.Titles, top.Processes)
+}
+
+func handleCp(engine *container.Engine, args []string) {
+	copyOwnership := false
+	var paths []string
+	for _, a := range args {
+		switch a {
+		case "-a", "--archive":
+			copyOwnership = true
+		default:
+			paths = append(paths, a)
+		}
+	}
+	if len(paths) != 2 {
+		fmt.Println("Usage: plx cp [-a] <src> <container>:<dst>")
+		fmt.Println("       plx cp [-a] <container>:<src> <dst>")
+		fmt.Println("       (\"-\" as <src> or <dst> reads or writes a tar archive; \"dir/.\" copies the contents of dir)")
+		os.Exit(1)
+	}
+	srcID, src := splitCpArg(paths[0])
+	dstID, dst := splitCpArg(paths[1])
+
+	var err error
+	switch {
+	case srcID != "" && dstID != "":
+		err = fmt.Errorf("copying between containers is not supported")
+	case srcID == "" && dstID == "":
+		err = fmt.Errorf("one of <src> and <dst> must be <container>:<path>")
+	case dstID != "" && src == "-":
+		err = engine.PutArchive(dstID, dst, os.Stdin, copyOwnership)
+	case dstID != "":
+		err = engine.CopyToContainer(dstID, src, dst, copyOwnership)
+	case dst == "-":
+		err = engine.GetArchive(srcID, src, os.Stdout)
+	default:
+		err = engine.CopyFromContainer(srcID, src, dst)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to copy: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// splitCpArg splits a plx cp argument into the container and the path. Host paths
+// are absolute, start with ".", or (on Windows) begin with a drive letter.
+func splitCpArg(arg string) (id, p string) {
+	if filepath.IsAbs(arg) || strings.HasPrefix(arg, ".") {
+		return "", arg
+	}
+	id, p, ok := strings.Cut(arg, ":")
+	if !ok || id == "" || strings.ContainsAny(id, `/\`) || (len(id) == 1 && runtime.GOOS == "windows") {
+		return "", arg
+	}
+	return id, p
+}
+
+func handleInspect(engine *container.Engine, args []string) {
+	var typ, format string
+	var names []string
+	for i := 0; i < len(args); i++ {
+		switch a := args[i]; {
+		case a == "--type" || a == "-f" || a == "--format":
+			if i+1 >= len(args) {
+				fmt.Printf("Error: flag needs an argument: %s\n", a)
+				os.Exit(1)
+			}
+			if a == "--type" {
+				typ = args[i+1]
+			} else {
+				format = args[i+1]
+			}
+			i++
+		case strings.HasPrefix(a, "--type="):
+			typ = strings.TrimPrefix(a, "--type=")
+		case strings.HasPrefix(a, "--format="):
+			format = strings.TrimPrefix(a, "--format=")
+		default:
+			names = append(names, a)
+		}
+	}
+	if len(names) == 0 {
+		fmt.Println("Usage: plx inspect [--type container|image|volume|network] [-f '{{.IP}}'] <name>...")
+		os.Exit(1)
+	}
+
+	var tmpl *template.Template
+	if format != "" {
+		var err error
+		tmpl, err = template.New("format").Funcs(inspectFuncs).Parse(format)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --format: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	failed := false
+	objects := []any{}
+	for _, name := range names {
+		obj, err := engine.Inspect(name, typ)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			failed = true
+			continue
+		}
+		if tmpl == nil {
+			objects = append(objects, obj)
+			continue
+		}
+		var out strings.Builder
+		if err := tmpl.Execute(&out, obj); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s: %v\n", name, err)
+			failed = true
+			continue
+		}
+		fmt.Println(out.String())
+	}
+	if tmpl == nil {
+		data, _ := json.MarshalIndent(objects, "", "    ")
+		fmt.Println(string(data))
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// inspectFuncs are the template functions of plx inspect --format, as in docker inspect.
+var inspectFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"join":  strings.Join,
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestSplitCpArg(t *testing.T) {
+	tests := []struct {
+		arg, id, path string
+	}{
+		{"web:/etc/hosts", "web", "/etc/hosts"},
+		{"web:.", "web", "."},
+		{"web:/app/", "web", "/app/"},
+		{"c-1a2b:relative/dir/.", "c-1a2b", "relative/dir/."},
+		{"-", "", "-"},
+		{"./file", "", "./file"},
+		{"./web:file", "", "./web:file"},
+		{"../out", "", "../out"},
+		{"file", "", "file"},
+		{"dir/web:file", "", "dir/web:file"},
+		{":/etc", "", ":/etc"},
+	}
+	if runtime.GOOS == "windows" {
+		tests = append(tests, []struct{ arg, id, path string }{
+			{`C:\Users\me\file`, "", `C:\Users\me\file`},
+			{`C:file`, "", `C:file`},
+			{`dir\web:file`, "", `dir\web:file`},
+		}...)
+	} else {
+		tests = append(tests, []struct{ arg, id, path string }{
+			{"/tmp/a:b", "", "/tmp/a:b"},
+			{"c:/data", "c", "/data"}, // a one-letter container, not a drive
+		}...)
+	}
+	for _, tt := range tests {
+		if id, p := splitCpArg(tt.arg); id != tt.id || p != tt.path {
+			t.Errorf("splitCpArg(%q) = %q, %q, want %q, %q", tt.arg, id, p, tt.id, tt.path)
+		}
+	}
+}
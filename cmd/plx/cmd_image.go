@@ -3,6 +3,9 @@ package main
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 
 	"PocketLinx/pkg/container"
 )
@@ -19,7 +22,25 @@ func handlePull(engine *container.Engine, args []string) {
 	}
 }
 
-func handleImages(engine *container.Engine) {
+func handleImages(engine *container.Engine, args []string) {
+	var labelFilters []string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "-f", "--filter":
+			if i+1 >= len(args) {
+				fmt.Println("Error: flag needs an argument: --filter")
+				os.Exit(1)
+			}
+			key, value, _ := strings.Cut(args[i+1], "=")
+			if key != "label" || value == "" {
+				fmt.Printf("Error: unsupported filter '%s' (supported: label=<key>[=<value>])\n", args[i+1])
+				os.Exit(1)
+			}
+			labelFilters = append(labelFilters, value)
+			i++
+		}
+	}
+
 	images, err := engine.Images()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to list images: %v\n", err)
@@ -28,18 +49,40 @@ func handleImages(engine *container.Engine) {
 	headers := []string{"IMAGE NAME"}
 	var rows [][]string
 	for _, img := range images {
+		if len(labelFilters) > 0 {
+			meta, err := engine.InspectImage(img)
+			if err != nil {
+				continue
+			}
+			matched := true
+			for _, f := range labelFilters {
+				if !meta.HasLabel(f) {
+					matched = false
+					break
+				}
+			}
+			if !matched {
+				continue
+			}
+		}
 		rows = append(rows, []string{img})
 	}
 	container.PrintTable(headers, rows)
 }
 
 func handleBuild(engine *container.Engine, args []string) {
-	ctxDir := "."
+	ctxArg := ""
 	targetImage := ""
 	configFile := ""
+	opts := container.BuildOptions{BuildArgs: make(map[string]string), Secrets: make(map[string]string)}
+	progressMode := "auto"
 
-	// Parse arguments manually to support -t/--tag and -f/--file
+	// Parse arguments manually to support -t/--tag, -f/--file, --build-arg, --no-cache, --reproducible and --progress
 	for i := 0; i < len(args); i++ {
+		if mode, ok := strings.CutPrefix(args[i], "--progress="); ok {
+			progressMode = mode
+			continue
+		}
 		switch args[i] {
 		case "-t", "--tag":
 			if i+1 < len(args) {
@@ -57,25 +100,117 @@ func handleBuild(engine *container.Engine, args []string) {
 				fmt.Println("Error: flag needs an argument: -f")
 				os.Exit(1)
 			}
+		case "--build-arg":
+			if i+1 < len(args) {
+				// KEY=VALUE, or KEY to take the value from the host environment
+				k, v, ok := strings.Cut(args[i+1], "=")
+				if !ok {
+					v, ok = os.LookupEnv(k)
+				}
+				if ok {
+					opts.BuildArgs[k] = v
+				}
+				i++
+			} else {
+				fmt.Println("Error: flag needs an argument: --build-arg")
+				os.Exit(1)
+			}
+		case "--no-cache":
+			opts.NoCache = true
+		case "--reproducible":
+			opts.Reproducible = true
+		case "--secret":
+			if i+1 < len(args) {
+				id, src, err := container.ParseBuildSecret(args[i+1])
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+					os.Exit(1)
+				}
+				if abs, err := filepath.Abs(src); err == nil {
+					src = abs
+				}
+				opts.Secrets[id] = src
+				i++
+			} else {
+				fmt.Println("Error: flag needs an argument: --secret")
+				os.Exit(1)
+			}
+		case "--progress":
+			if i+1 < len(args) {
+				progressMode = args[i+1]
+				i++
+			} else {
+				fmt.Println("Error: flag needs an argument: --progress")
+				os.Exit(1)
+			}
+		case "--no-cache-filter":
+			if i+1 < len(args) {
+				opts.NoCacheFilter = append(opts.NoCacheFilter, strings.Split(args[i+1], ",")...)
+				i++
+			} else {
+				fmt.Println("Error: flag needs an argument: --no-cache-filter")
+				os.Exit(1)
+			}
 		default:
-			ctxDir = args[i]
+			ctxArg = args[i]
 		}
 	}
 
+	// SOURCE_DATE_EPOCH (build arg or environment) implies --reproducible
+	epoch, ok := opts.BuildArgs["SOURCE_DATE_EPOCH"]
+	if !ok {
+		epoch, ok = os.LookupEnv("SOURCE_DATE_EPOCH")
+	}
+	if ok && epoch != "" {
+		sec, err := strconv.ParseInt(epoch, 10, 64)
+		if err != nil || sec < 0 {
+			fmt.Printf("Error: invalid SOURCE_DATE_EPOCH '%s' (expected Unix seconds)\n", epoch)
+			os.Exit(1)
+		}
+		opts.Reproducible = true
+		opts.SourceDateEpoch = sec
+	}
+
+	progress, err := container.NewBuildProgress(progressMode, os.Stdout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	opts.Progress = progress
+
+	// The context may be a directory, a tarball ("-" for stdin) or a git repository
+	buildCtx, err := container.PrepareBuildContext(ctxArg, configFile, os.Stdin)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer buildCtx.Cleanup()
+
 	// Try to load config to get image name if not provided via flag
 	if targetImage == "" {
-		config, _ := container.LoadProjectConfigFromDir(ctxDir)
+		config, _ := container.LoadProjectConfigFromDir(buildCtx.Dir)
 		if config != nil && config.Image != "" {
 			targetImage = config.Image
 		}
 	}
+	if targetImage == "" {
+		// Temporary contexts have meaningless directory names
+		targetImage = strings.ToLower(buildCtx.Name)
+	}
 
-	img, err := engine.Build(ctxDir, configFile, targetImage)
+	opts.ContextDir = buildCtx.Dir
+	opts.Dockerfile = buildCtx.Dockerfile
+	opts.Tag = targetImage
+	img, err := engine.Build(opts)
 	if err != nil {
+		buildCtx.Cleanup()
 		fmt.Fprintf(os.Stderr, "Build failed: %v\n", err)
 		os.Exit(1)
 	}
-	fmt.Printf("Successfully built image: %s\n", img)
+	// With --progress=json, stdout carries only events
+	if progressMode != "json" {
+		fmt.Printf("Successfully built image: %s\n", img)
+	}
 }
 
 func handlePrune(engine *container.Engine) {
@@ -114,3 +249,54 @@ func handlePackage(engine *container.Engine, args []string) {
 		os.Exit(1)
 	}
 }
+
+// handleLint checks a Dockerfile (and the plx.json next to it) without building.
+// It exits with 1 when an error is found (with --strict also on warnings), for CI.
+func handleLint(args []string) {
+	dockerfile := "Dockerfile"
+	strict := false
+	for _, arg := range args {
+		switch {
+		case arg == "--strict":
+			strict = true
+		case strings.HasPrefix(arg, "-"):
+			fmt.Printf("Error: unknown flag: %s\n", arg)
+			os.Exit(1)
+		default:
+			dockerfile = arg
+		}
+	}
+	if info, err := os.Stat(dockerfile); err == nil && info.IsDir() {
+		dockerfile = filepath.Join(dockerfile, "Dockerfile")
+	}
+	ctxDir := filepath.Dir(dockerfile)
+
+	diags, err := container.LintDockerfile(dockerfile, ctxDir)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	configPath := filepath.Join(ctxDir, "plx.json")
+	if _, err := os.Stat(configPath); err == nil {
+		configDiags, err := container.LintProjectConfig(configPath)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		diags = append(diags, configDiags...)
+	}
+
+	failed := false
+	for _, d := range diags {
+		fmt.Println(d)
+		if d.Severity == container.LintError || strict {
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+	if len(diags) == 0 {
+		fmt.Println("No problems found.")
+	}
+}
@@ -1,11 +1,13 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"PocketLinx/pkg/container"
 )
@@ -18,6 +20,11 @@ func handleRun(engine *container.Engine, args []string) {
 	}
 
 	if err := engine.Run(*opts); err != nil {
+		// A foreground container's exit code becomes plx's own, as with docker run
+		var exitErr *container.ExitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.Code)
+		}
 		fmt.Fprintf(os.Stderr, "Run failed: %v\n", err)
 		os.Exit(1)
 	}
@@ -53,6 +60,21 @@ func parseRunOptions(args []string) (*container.RunOptions, error) {
 	image := ""
 	interactive := false
 	detach := false
+	publishAll := false
+	stopSignal := ""
+	restart := ""
+	logDriver := ""
+	var logOpts map[string]string
+	var memory, memorySwap, pidsLimit int64
+	var cpus float64
+	cpusetCpus := ""
+	var health *container.HealthConfig
+	healthOpt := func() *container.HealthConfig {
+		if health == nil {
+			health = &container.HealthConfig{}
+		}
+		return health
+	}
 	workdir := ""
 
 	// Apply config defaults
@@ -143,6 +165,95 @@ func parseRunOptions(args []string) (*container.RunOptions, error) {
 			interactive = true
 		} else if arg == "-d" || arg == "--detach" {
 			detach = true
+		} else if arg == "-P" || arg == "--publish-all" {
+			publishAll = true
+		} else if arg == "--health-cmd" && i+1 < len(args) {
+			healthOpt().Test = []string{"CMD-SHELL", args[i+1]}
+			i++
+		} else if (arg == "--health-interval" || arg == "--health-timeout" || arg == "--health-start-period") && i+1 < len(args) {
+			d, err := time.ParseDuration(args[i+1])
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("invalid duration for %s: %s", arg, args[i+1])
+			}
+			switch arg {
+			case "--health-interval":
+				healthOpt().Interval = d
+			case "--health-timeout":
+				healthOpt().Timeout = d
+			default:
+				healthOpt().StartPeriod = d
+			}
+			i++
+		} else if arg == "--health-retries" && i+1 < len(args) {
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid value for --health-retries: %s", args[i+1])
+			}
+			healthOpt().Retries = n
+			i++
+		} else if arg == "--stop-signal" && i+1 < len(args) {
+			if _, err := container.ParseSignal(args[i+1]); err != nil {
+				return nil, err
+			}
+			stopSignal = args[i+1]
+			i++
+		} else if arg == "--restart" && i+1 < len(args) {
+			if _, err := container.ParseRestartPolicy(args[i+1]); err != nil {
+				return nil, err
+			}
+			restart = args[i+1]
+			i++
+		} else if arg == "--log-driver" && i+1 < len(args) {
+			logDriver = args[i+1]
+			i++
+		} else if arg == "--log-opt" && i+1 < len(args) {
+			// max-size=10m,max-file=3 or one --log-opt per option
+			for _, kv := range strings.Split(args[i+1], ",") {
+				k, v, ok := strings.Cut(kv, "=")
+				if !ok {
+					return nil, fmt.Errorf("invalid --log-opt %s (expected key=value)", kv)
+				}
+				if logOpts == nil {
+					logOpts = make(map[string]string)
+				}
+				logOpts[k] = v
+			}
+			i++
+		} else if (arg == "--memory" || arg == "-m" || arg == "--memory-swap") && i+1 < len(args) {
+			var n int64
+			if arg == "--memory-swap" && args[i+1] == "-1" {
+				n = -1
+			} else {
+				var err error
+				if n, err = container.ParseMemoryBytes(args[i+1]); err != nil {
+					return nil, fmt.Errorf("invalid value for %s: %w", arg, err)
+				}
+			}
+			if arg == "--memory-swap" {
+				memorySwap = n
+			} else {
+				memory = n
+			}
+			i++
+		} else if arg == "--cpus" && i+1 < len(args) {
+			n, err := strconv.ParseFloat(args[i+1], 64)
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("invalid value for --cpus: %s", args[i+1])
+			}
+			cpus = n
+			i++
+		} else if arg == "--cpuset-cpus" && i+1 < len(args) {
+			cpusetCpus = args[i+1]
+			i++
+		} else if arg == "--pids-limit" && i+1 < len(args) {
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil || n < -1 {
+				return nil, fmt.Errorf("invalid value for --pids-limit: %s", args[i+1])
+			}
+			pidsLimit = n
+			i++
+		} else if arg == "--no-healthcheck" {
+			healthOpt().Test = []string{"NONE"}
 		} else if strings.HasPrefix(arg, "-") {
 			// Unknown flag
 			fmt.Printf("Unknown flag: %s\n", arg)
@@ -175,21 +286,10 @@ func parseRunOptions(args []string) (*container.RunOptions, error) {
 			}, image)
 
 			// Reconstruct properties from Instructions
-			for _, instr := range df.Instructions {
+			for _, instr := range df.Final().Instructions {
 				switch instr.Type {
 				case "CMD":
-					// Simple shell/exec form detection
-					args := instr.Raw
-					if strings.HasPrefix(args, "[") && strings.HasSuffix(args, "]") {
-						trimmed := strings.Trim(args, "[]")
-						parts := strings.Split(trimmed, ",")
-						for i, p := range parts {
-							parts[i] = strings.Trim(strings.TrimSpace(p), "\"")
-						}
-						cmdArgs = parts
-					} else {
-						cmdArgs = []string{"sh", "-c", args}
-					}
+					cmdArgs = instr.Args
 				case "ENV":
 					for i := 0; i < len(instr.Args); i += 2 {
 						k := instr.Args[i]
@@ -203,7 +303,7 @@ func parseRunOptions(args []string) (*container.RunOptions, error) {
 					}
 				case "EXPOSE":
 					for _, pStr := range instr.Args {
-						if p, err := strconv.Atoi(pStr); err == nil {
+						if p, _, err := container.ParseExposedPort(pStr); err == nil {
 							// Default mapping: host port same as container port
 							portMappings = append(portMappings, container.PortMapping{Host: p, Container: p})
 						}
@@ -218,7 +318,7 @@ func parseRunOptions(args []string) (*container.RunOptions, error) {
 	}
 
 	if len(cmdArgs) == 0 && image == "alpine" {
-		return nil, fmt.Errorf("Usage: plx run [options] <image> [command] [args...]\nOptions: -it, -d, -v, -p, -e, --name")
+		return nil, fmt.Errorf("Usage: plx run [options] <image> [command] [args...]\nOptions: -it, -d, -v, -p, -P, -e, --name, --health-cmd, --restart, --log-driver, --log-opt, --memory, --cpus, --pids-limit")
 	}
 
 	// Heuristic: If workdir is empty and we have a mount to /app, default to /app
@@ -241,5 +341,16 @@ func parseRunOptions(args []string) (*container.RunOptions, error) {
 		Interactive: interactive,
 		Detach:      detach,
 		Workdir:     workdir,
+		PublishAll:  publishAll,
+		Healthcheck: health,
+		StopSignal:  stopSignal,
+		Restart:     restart,
+		LogDriver:   logDriver,
+		LogOpts:     logOpts,
+		Memory:      memory,
+		MemorySwap:  memorySwap,
+		CPUs:        cpus,
+		CpusetCpus:  cpusetCpus,
+		PidsLimit:   pidsLimit,
 	}, nil
 }
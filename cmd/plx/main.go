@@ -20,6 +20,11 @@ func main() {
 		handleVersion()
 		return
 	}
+	// lint はバックエンドを必要としない
+	if cmd == "lint" {
+		handleLint(args)
+		return
+	}
 
 	var backend container.Backend
 
@@ -36,13 +41,23 @@ func main() {
 	case "pull":
 		handlePull(engine, args)
 	case "images":
-		handleImages(engine)
+		handleImages(engine, args)
 	case "run":
 		handleRun(engine, args)
 	case "exec":
 		handleExec(engine, args)
 	case "ps":
 		handlePs(engine)
+	case "stats":
+		handleStats(engine, args)
+	case "top":
+		handleTop(engine, args)
+	case "inspect":
+		handleInspect(engine, args)
+	case "cp":
+		handleCp(engine, args)
+	case "wait":
+		handleWait(engine, args)
 	case "stop":
 		handleStop(engine, args)
 	case "start":
@@ -79,14 +94,20 @@ func printUsage() {
 	fmt.Println("  plx setup                        Initialize environment")
 	fmt.Println("  plx install                      Add plx to your system PATH")
 	fmt.Println("  plx pull <image>                 Download an image (alpine, ubuntu)")
-	fmt.Println("  plx images                       List downloaded images")
-	fmt.Printf("  plx run [-it] [-e K=V] [-p H:C] [-v S:D] [image] <cmd>...  Run command\n")
+	fmt.Println("  plx images [--filter label=k=v]  List downloaded images")
+	fmt.Printf("  plx run [-it] [-d] [-e K=V] [-p H:C] [-P] [-v S:D] [--restart policy] [--log-driver json-file|local|none] [--log-opt max-size=10m,max-file=3] [--memory 512m] [--cpus 1.5] [--pids-limit N] [image] <cmd>...  Run command\n")
 	fmt.Printf("  plx exec [-it] <container> <cmd>...              Execute command in running container\n")
 	fmt.Println("  plx ps                           List containers")
-	fmt.Println("  plx stop <id>                    Stop container")
-	fmt.Println("  plx logs <id>                    View container logs")
+	fmt.Println("  plx inspect [--type T] [-f '{{.IP}}'] <name>...  Show containers, images, volumes or networks as JSON")
+	fmt.Println("  plx stats [--no-stream] [--format json] [id...]  Live CPU, memory, network and block I/O usage")
+	fmt.Println("  plx top <id> [ps options]        List the processes running in a container")
+	fmt.Println("  plx cp [-a] <src> <id>:<dst> | <id>:<src> <dst>  Copy files between the host and a container")
+	fmt.Println("  plx stop [-t secs] <id>          Stop container (SIGTERM, then SIGKILL after timeout)")
+	fmt.Println("  plx wait <id>...                 Wait for containers to exit and print their exit codes")
+	fmt.Println("  plx logs [-f] [-t] [--tail N] [--since 10m] [--until time] <id>  View container logs")
 	fmt.Println("  plx rm <id>                      Remove container")
-	fmt.Println("  plx build [path]                 Build image from Dockerfile")
+	fmt.Println("  plx build [-t tag] [-f file] [--build-arg K=V] [--secret id=x,src=file] [--no-cache] [--no-cache-filter step] [--reproducible] [--progress auto|tty|plain|json] [path|-|file.tar.gz|repo.git#ref:dir]  Build image from Dockerfile")
+	fmt.Println("  plx lint [--strict] [Dockerfile]  Check a Dockerfile and plx.json for problems")
 	fmt.Println("  plx version                      Show version")
 	fmt.Println("  plx dashboard                    Launch visual Control Center")
 	fmt.Println("  plx prune                        Clear build cache")
@@ -4,11 +4,15 @@ import (
 	"PocketLinx/pkg/compose"
 	"PocketLinx/pkg/container"
 	"PocketLinx/pkg/version"
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -85,8 +89,17 @@ func (s *Server) handleStart(w http.ResponseWriter, r *http.Request) {
 
 func (s *Server) handleStop(w http.ResponseWriter, r *http.Request) {
 	id := r.URL.Query().Get("id")
+	timeout := container.DefaultStopTimeout
+	if t := r.URL.Query().Get("t"); t != "" {
+		secs, err := strconv.Atoi(t)
+		if err != nil || secs < 0 {
+			http.Error(w, "invalid timeout", http.StatusBadRequest)
+			return
+		}
+		timeout = time.Duration(secs) * time.Second
+	}
 	fmt.Printf("[API] STOP request for %s\n", id)
-	if err := s.engine.Stop(id); err != nil {
+	if err := s.engine.Stop(id, timeout); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -124,14 +137,167 @@ func (s *Server) handleUpdate(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, "OK")
 }
 
+// handleLogs returns a container's log as text. With follow=1 it streams the log as
+// server-sent events (one "data:" event per line, "logerror" on failure, then "end") until the
+// container exits or the client goes away.
+// Query: id, follow, tail, since, until, timestamps.
 func (s *Server) handleLogs(w http.ResponseWriter, r *http.Request) {
-	id := r.URL.Query().Get("id")
-	logs, err := s.engine.Logs(id)
+	q := r.URL.Query()
+	id := q.Get("id")
+	opts := container.LogOptions{
+		Tail:       -1,
+		Follow:     q.Get("follow") == "1" || q.Get("follow") == "true",
+		Timestamps: q.Get("timestamps") == "1" || q.Get("timestamps") == "true",
+	}
+	if v := q.Get("tail"); v != "" && v != "all" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "invalid tail: "+v, http.StatusBadRequest)
+			return
+		}
+		opts.Tail = n
+	}
+	for name, t := range map[string]*time.Time{"since": &opts.Since, "until": &opts.Until} {
+		if v := q.Get(name); v != "" {
+			parsed, err := container.ParseLogTime(v, time.Now())
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			*t = parsed
+		}
+	}
+
+	if !opts.Follow {
+		var buf bytes.Buffer
+		if err := s.engine.Logs(r.Context(), id, opts, &buf); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write(buf.Bytes())
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	events := &sseWriter{w: w}
+	if err := s.engine.Logs(r.Context(), id, opts, events); err != nil {
+		fmt.Fprintf(w, "event: logerror\ndata: %s\n\n", err)
+	}
+	events.close()
+}
+
+// sseWriter sends every line written to it as a server-sent event.
+type sseWriter struct {
+	w       http.ResponseWriter
+	partial []byte
+}
+
+func (e *sseWriter) Write(p []byte) (int, error) {
+	e.partial = append(e.partial, p...)
+	for {
+		i := bytes.IndexByte(e.partial, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		if _, err := fmt.Fprintf(e.w, "data: %s\n\n", bytes.TrimSuffix(e.partial[:i], []byte("\r"))); err != nil {
+			return 0, err
+		}
+		e.partial = e.partial[i+1:]
+	}
+}
+
+func (e *sseWriter) Flush() {
+	if f, ok := e.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// close sends the last partial line and the "end" event, which tells the browser not
+// to reconnect.
+func (e *sseWriter) close() {
+	if len(e.partial) > 0 {
+		e.Write([]byte("\n"))
+	}
+	fmt.Fprint(e.w, "event: end\ndata: \n\n")
+	e.Flush()
+}
+
+// handleTop lists the processes of a container. ?ps_args=... is passed to ps.
+func (s *Server) handleTop(w http.ResponseWriter, r *http.Request) {
+	psArgs := strings.Fields(r.URL.Query().Get("ps_args"))
+	top, err := s.engine.Top(r.PathValue("id"), psArgs)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(top)
+}
+
+// writeTracker remembers whether anything was written, so that an error can still be
+// reported with a status code before the archive starts.
+type writeTracker struct {
+	http.ResponseWriter
+	written bool
+}
+
+func (t *writeTracker) Write(p []byte) (int, error) {
+	t.written = true
+	return t.ResponseWriter.Write(p)
+}
+
+// handleGetArchive returns a tar archive of ?path= in the container.
+func (s *Server) handleGetArchive(w http.ResponseWriter, r *http.Request) {
+	p := r.URL.Query().Get("path")
+	if p == "" {
+		http.Error(w, "path is required", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-tar")
+	tw := &writeTracker{ResponseWriter: w}
+	if err := s.engine.GetArchive(r.PathValue("id"), p, tw); err != nil && !tw.written {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// handlePutArchive extracts the tar archive in the request body into the directory
+// ?path= of the container (?copyUIDGID=1 keeps the owners of the archive).
+func (s *Server) handlePutArchive(w http.ResponseWriter, r *http.Request) {
+	p := r.URL.Query().Get("path")
+	if p == "" {
+		http.Error(w, "path is required", http.StatusBadRequest)
+		return
+	}
+	copyOwnership := r.URL.Query().Get("copyUIDGID")
+	if err := s.engine.PutArchive(r.PathValue("id"), p, r.Body, copyOwnership == "1" || copyOwnership == "true"); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleStats returns the resource usage of the running containers. CPU % is measured
+// since the previous request when the dashboard polls regularly, otherwise over a fresh
+// one-second window.
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+
+	prev := s.lastStats
+	if time.Since(s.statsAt) > 30*time.Second {
+		prev = nil
+	}
+	stats, err := s.engine.Stats(prev)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	fmt.Fprintf(w, "%s", logs)
+	s.lastStats, s.statsAt = stats, time.Now()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
 }
 
 func (s *Server) handleImages(w http.ResponseWriter, r *http.Request) {
@@ -50,7 +50,7 @@ function renderContainerControls() {
                     <span class="card-image">${c.image}</span>
                 </div>
                 <div style="font-size: 0.7rem; color: ${isRunning ? 'var(--accent-success)' : 'var(--text-muted)'}; font-weight: 700;">
-                    ${c.status.toUpperCase()}
+                    ${c.status.toUpperCase()}${isRunning && c.health ? ` (${c.health.toUpperCase()})` : ''}
                 </div>
             </div>
             
@@ -318,18 +318,40 @@ function showConfig(id) {
     }
     if (!container) return;
 
+    closeLogStream();
     const json = JSON.stringify(container, null, 2);
     const logArea = document.getElementById('log-scroller');
     logArea.innerHTML = `<div style="padding:10px; font-family:var(--font-mono); font-size:11px; white-space:pre-wrap; color:var(--text-primary);"><strong>CONTAINER CONFIGURATION (Furniture List):</strong>\n\n${json}</div>`;
     document.querySelector('.activity-overlay').classList.add('active');
 }
 
-async function showLogs(id) {
-    const res = await fetch(`/api/logs?id=${id}`);
-    const text = await res.text();
+// Log view: streams the container's log (server-sent events) until it exits
+let logStream = null;
+
+function closeLogStream() {
+    if (logStream) {
+        logStream.close();
+        logStream = null;
+    }
+}
+
+function showLogs(id) {
+    closeLogStream();
     const logArea = document.getElementById('log-scroller');
-    logArea.innerHTML = `<pre style="color: var(--text-main); font-size: 11px; white-space: pre-wrap;">${text}</pre>`;
+    logArea.innerHTML = `<pre style="color: var(--text-main); font-size: 11px; white-space: pre-wrap;"></pre>`;
+    const pre = logArea.querySelector('pre');
     document.querySelector('.activity-overlay').classList.add('active');
+
+    logStream = new EventSource(`/api/logs?id=${encodeURIComponent(id)}&follow=1&tail=500`);
+    logStream.onmessage = (e) => {
+        const atBottom = logArea.scrollTop + logArea.clientHeight >= logArea.scrollHeight - 4;
+        pre.appendChild(document.createTextNode(e.data + '\n'));
+        if (atBottom) logArea.scrollTop = logArea.scrollHeight;
+    };
+    logStream.addEventListener('logerror', (e) => {
+        pre.appendChild(document.createTextNode(`[error] ${e.data}\n`));
+    });
+    logStream.addEventListener('end', closeLogStream);
 }
 
 function appendLog(msg) {
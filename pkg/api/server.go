@@ -13,6 +13,11 @@ type Server struct {
 	engine  *container.Engine
 	proxies map[string]*portProxy
 	mu      sync.Mutex
+
+	// Last /api/stats sample, the baseline for the CPU % of the next request
+	statsMu   sync.Mutex
+	lastStats []container.ContainerStats
+	statsAt   time.Time
 }
 
 func NewServer(engine *container.Engine) *Server {
@@ -34,6 +39,10 @@ func (s *Server) Start(port int) error {
 	http.HandleFunc("/api/remove", s.handleRemove)
 	http.HandleFunc("/api/update", s.handleUpdate)
 	http.HandleFunc("/api/logs", s.handleLogs)
+	http.HandleFunc("/api/stats", s.handleStats)
+	http.HandleFunc("GET /api/containers/{id}/top", s.handleTop)
+	http.HandleFunc("GET /api/containers/{id}/archive", s.handleGetArchive)
+	http.HandleFunc("PUT /api/containers/{id}/archive", s.handlePutArchive)
 	http.HandleFunc("/api/version", s.handleVersion)
 	http.HandleFunc("/api/images", s.handleImages)
 	http.HandleFunc("/api/compose/projects", s.handleComposeProjects)
@@ -43,9 +52,12 @@ func (s *Server) Start(port int) error {
 	http.HandleFunc("/logo.png", s.handleAsset("logo.png", "image/png"))
 	http.HandleFunc("/", s.handleUI)
 
-	// Start a background loop to sync proxies
+	// Start a background loop to restore containers with a restart policy and sync proxies
 	go func() {
 		for {
+			if err := s.engine.RestoreContainers(); err != nil {
+				fmt.Printf("Warning: %v\n", err)
+			}
 			s.syncProxies()
 			time.Sleep(5 * time.Second)
 		}
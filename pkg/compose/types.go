@@ -9,11 +9,37 @@ type ComposeConfig struct {
 
 // ServiceConfig represents a single service definition
 type ServiceConfig struct {
-	Image       string   `yaml:"image"`
-	Command     []string `yaml:"command,omitempty"` // Supports ["cmd", "arg"] format
-	Ports       []string `yaml:"ports,omitempty"`   // "8080:80"
-	Environment []string `yaml:"environment,omitempty"`
-	Volumes     []string `yaml:"volumes,omitempty"`
-	WorkingDir  string   `yaml:"working_dir,omitempty"`
-	Restart     string   `yaml:"restart,omitempty"`
+	Image        string        `yaml:"image"`
+	Command      []string      `yaml:"command,omitempty"` // Supports ["cmd", "arg"] format
+	Ports        []string      `yaml:"ports,omitempty"`   // "8080:80"
+	Environment  []string      `yaml:"environment,omitempty"`
+	Volumes      []string      `yaml:"volumes,omitempty"`
+	WorkingDir   string        `yaml:"working_dir,omitempty"`
+	Restart      string        `yaml:"restart,omitempty"`
+	Cpuset       string        `yaml:"cpuset,omitempty"`        // "0-3"
+	MemswapLimit string        `yaml:"memswap_limit,omitempty"` // memory + swap, "-1" = unlimited swap
+	Deploy       DeployConfig  `yaml:"deploy,omitempty"`
+	Logging      LoggingConfig `yaml:"logging,omitempty"`
+}
+
+// LoggingConfig maps to plx run --log-driver/--log-opt
+type LoggingConfig struct {
+	Driver  string            `yaml:"driver,omitempty"`
+	Options map[string]string `yaml:"options,omitempty"`
+}
+
+// DeployConfig is the part of a service's deploy section plx supports
+type DeployConfig struct {
+	Resources ResourcesConfig `yaml:"resources,omitempty"`
+}
+
+// ResourcesConfig holds deploy.resources; limits map to plx run --memory/--cpus/--pids-limit
+type ResourcesConfig struct {
+	Limits ResourceLimits `yaml:"limits,omitempty"`
+}
+
+type ResourceLimits struct {
+	CPUs   string `yaml:"cpus,omitempty"`   // "0.5"
+	Memory string `yaml:"memory,omitempty"` // "512M"
+	Pids   int64  `yaml:"pids,omitempty"`
 }
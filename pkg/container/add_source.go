@@ -0,0 +1,229 @@
+package container
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// IsRemoteSource reports whether an ADD source must be downloaded (http/https URL).
+func IsRemoteSource(src string) bool {
+	return strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://")
+}
+
+// ResolveLocalSource returns the host path of a COPY/ADD source.
+// Relative paths are resolved against the build context; file:// URLs are used as-is.
+func ResolveLocalSource(ctxDir, src string) string {
+	if strings.HasPrefix(src, "file://") {
+		if u, err := url.Parse(src); err == nil {
+			p := u.Path
+			// file:///C:/path -> C:/path on Windows hosts
+			if len(p) >= 3 && p[0] == '/' && p[2] == ':' {
+				p = p[1:]
+			}
+			return filepath.FromSlash(p)
+		}
+		return filepath.FromSlash(strings.TrimPrefix(src, "file://"))
+	}
+	return filepath.Join(ctxDir, src)
+}
+
+// RemoteSourceName returns the file name ADD uses for a downloaded URL.
+func RemoteSourceName(src string) string {
+	if u, err := url.Parse(src); err == nil {
+		if base := path.Base(u.Path); base != "" && base != "/" && base != "." {
+			return base
+		}
+	}
+	return "download"
+}
+
+// remoteSource is the download of one ADD URL; mu is held while it is being fetched.
+type remoteSource struct {
+	mu   sync.Mutex
+	path string // downloaded host path, "" until fetched
+}
+
+var (
+	remoteSourcesMu sync.Mutex
+	remoteSources   = make(map[string]*remoteSource) // url -> download
+)
+
+// FetchRemoteSource downloads an ADD URL into the local download cache and verifies
+// the optional checksum ("sha256:<hex>"). Repeated calls for the same URL within
+// one process reuse the first download, so hashing and copying fetch it only once;
+// different URLs are downloaded in parallel. The file is renamed into place when
+// complete, so concurrent builds fetching the same URL do not interfere.
+func FetchRemoteSource(src, checksum string) (string, error) {
+	remoteSourcesMu.Lock()
+	rs := remoteSources[src]
+	if rs == nil {
+		rs = &remoteSource{}
+		remoteSources[src] = rs
+	}
+	remoteSourcesMu.Unlock()
+
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if rs.path == "" {
+		dir := filepath.Join(GetDataDir(), "downloads")
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return "", err
+		}
+		key := sha256.Sum256([]byte(src))
+		localPath := filepath.Join(dir, hex.EncodeToString(key[:8])+"-"+RemoteSourceName(src))
+		if os.Getenv("PLX_VERBOSE") != "" {
+			fmt.Fprintf(os.Stderr, "[DEBUG] Downloading %s -> %s\n", src, localPath)
+		}
+		if err := downloadFile(src, localPath); err != nil {
+			return "", fmt.Errorf("failed to download %s: %w", src, err)
+		}
+		rs.path = localPath
+	}
+
+	if checksum != "" {
+		if err := VerifyChecksum(rs.path, checksum); err != nil {
+			return "", fmt.Errorf("%s: %w", src, err)
+		}
+	}
+	return rs.path, nil
+}
+
+// VerifyChecksum checks a file against a "sha256:<hex>" digest.
+func VerifyChecksum(filePath, checksum string) error {
+	algo, want, found := strings.Cut(checksum, ":")
+	if !found || algo != "sha256" {
+		return fmt.Errorf("unsupported checksum %q (expected sha256:<hex>)", checksum)
+	}
+	got, err := fileSHA256(filePath)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(got, want) {
+		return fmt.Errorf("checksum mismatch: expected sha256:%s, got sha256:%s", want, got)
+	}
+	return nil
+}
+
+func fileSHA256(filePath string) (string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// IsArchive reports whether a local file is a (possibly compressed) tar archive
+// that ADD should auto-extract. Detection is by content, like Docker: a compressed
+// file is only an archive if it decompresses to a tar header, otherwise ADD copies it
+// as it is. xz is looked into with the xz tool; without it (Windows hosts) any xz file
+// is taken for an archive.
+func IsArchive(filePath string) bool {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	magic, _ := br.Peek(6)
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}): // gzip
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return false
+		}
+		defer gz.Close()
+		return isTarHeader(gz)
+	case bytes.HasPrefix(magic, []byte("BZh")): // bzip2
+		return isTarHeader(bzip2.NewReader(br))
+	case bytes.HasPrefix(magic, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}): // xz
+		cmd := exec.Command("xz", "-dc", filePath)
+		out, err := cmd.StdoutPipe()
+		if err == nil {
+			err = cmd.Start()
+		}
+		if err != nil {
+			return true
+		}
+		defer func() {
+			cmd.Process.Kill()
+			cmd.Wait()
+		}()
+		return isTarHeader(out)
+	}
+	return isTarHeader(br)
+}
+
+// isTarHeader reports whether r starts with a ustar header ("ustar" at offset 257).
+func isTarHeader(r io.Reader) bool {
+	header := make([]byte, 262)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return false
+	}
+	return bytes.Equal(header[257:262], []byte("ustar"))
+}
+
+// ExpandSources resolves wildcards in COPY/ADD sources against the build context.
+// Remote URLs are returned unchanged; a pattern that matches nothing is an error.
+func ExpandSources(ctxDir string, instr Instruction) ([]string, error) {
+	ignore, err := LoadIgnoreMatcher(ctxDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var sources []string
+	for _, src := range instr.Sources() {
+		if IsRemoteSource(src) || strings.HasPrefix(src, "file://") {
+			sources = append(sources, src)
+			continue
+		}
+		if !strings.ContainsAny(src, "*?[") {
+			if ignore.Matches(src) {
+				return nil, fmt.Errorf("%s is excluded by the build context's ignore file", src)
+			}
+			sources = append(sources, src)
+			continue
+		}
+		matches, err := filepath.Glob(filepath.Join(ctxDir, src))
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %s: %w", src, err)
+		}
+		matched := 0
+		for _, m := range matches {
+			rel, err := filepath.Rel(ctxDir, m)
+			if err != nil {
+				return nil, err
+			}
+			if ignore.Matches(rel) {
+				continue
+			}
+			sources = append(sources, filepath.ToSlash(rel))
+			matched++
+		}
+		if matched == 0 {
+			return nil, fmt.Errorf("no source files were specified by %s", src)
+		}
+	}
+	if len(sources) > 1 && !strings.HasSuffix(instr.Dest(), "/") {
+		return nil, fmt.Errorf("when using %s with more than one source file, the destination must be a directory and end with a /", instr.Type)
+	}
+	return sources, nil
+}
@@ -0,0 +1,161 @@
+package container
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func tarBytes(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err := tw.WriteHeader(&tar.Header{Name: "f", Mode: 0644, Size: 5}); err != nil {
+		t.Fatal(err)
+	}
+	tw.Write([]byte("hello"))
+	tw.Close()
+	return buf.Bytes()
+}
+
+func gzipBytes(data []byte) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write(data)
+	gz.Close()
+	return buf.Bytes()
+}
+
+func TestIsArchive(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name string
+		data []byte
+		want bool
+	}{
+		{"plain.txt", []byte("hello\n"), false},
+		{"empty", nil, false},
+		{"app.tar", tarBytes(t), true},
+		{"app.tar.gz", gzipBytes(tarBytes(t)), true},
+		{"notes.gz", gzipBytes([]byte("hello\n")), false},
+		{"broken.gz", []byte{0x1f, 0x8b, 0x00}, false},
+	}
+	for _, tt := range tests {
+		p := filepath.Join(dir, tt.name)
+		if err := os.WriteFile(p, tt.data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if got := IsArchive(p); got != tt.want {
+			t.Errorf("IsArchive(%s) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestIsArchiveCompressors checks bzip2 and xz, which the standard library cannot write.
+func TestIsArchiveCompressors(t *testing.T) {
+	for _, tool := range []string{"bzip2", "xz"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Logf("%s not found, skipping", tool)
+			continue
+		}
+		dir := t.TempDir()
+		tarPath, textPath := filepath.Join(dir, "app.tar"), filepath.Join(dir, "notes.txt")
+		os.WriteFile(tarPath, tarBytes(t), 0644)
+		os.WriteFile(textPath, []byte("hello\n"), 0644)
+		for p, want := range map[string]bool{tarPath: true, textPath: false} {
+			if out, err := exec.Command(tool, p).CombinedOutput(); err != nil {
+				t.Fatalf("%s %s: %v: %s", tool, p, err, out)
+			}
+			ext := map[string]string{"bzip2": ".bz2", "xz": ".xz"}[tool]
+			if got := IsArchive(p + ext); got != want {
+				t.Errorf("IsArchive(%s) = %v, want %v", filepath.Base(p+ext), got, want)
+			}
+		}
+	}
+}
+
+func TestFetchRemoteSource(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+
+	var fileHits atomic.Int32
+	fastDone := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/file.txt":
+			fileHits.Add(1)
+			w.Write([]byte("content"))
+		case "/slow.txt":
+			select { // only finishes once /fast.txt was downloaded in parallel
+			case <-fastDone:
+			case <-time.After(5 * time.Second):
+			}
+			w.Write([]byte("slow"))
+		case "/fast.txt":
+			w.Write([]byte("fast"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p, err := FetchRemoteSource(srv.URL+"/file.txt", "sha256:ed7002b439e9ac845f22357d822bac1444730fbdb6016d3ec9432297b9ec9f73")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if data, _ := os.ReadFile(p); string(data) != "content" {
+				t.Errorf("downloaded %q", data)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := fileHits.Load(); n != 1 {
+		t.Errorf("the same URL was downloaded %d times", n)
+	}
+
+	slow := make(chan time.Time, 1)
+	go func() {
+		FetchRemoteSource(srv.URL+"/slow.txt", "")
+		slow <- time.Now()
+	}()
+	time.Sleep(100 * time.Millisecond) // let the slow download take its lock
+	if _, err := FetchRemoteSource(srv.URL+"/fast.txt", ""); err != nil {
+		t.Fatal(err)
+	}
+	fast := time.Now()
+	close(fastDone)
+	if slowAt := <-slow; slowAt.Before(fast) {
+		t.Error("the download of another URL waited for the slow one")
+	}
+
+	if _, err := FetchRemoteSource(srv.URL+"/missing.txt", ""); err == nil {
+		t.Error("a 404 should fail")
+	}
+	if _, err := FetchRemoteSource(srv.URL+"/file.txt", "sha256:00"); err == nil {
+		t.Error("a checksum mismatch should fail")
+	}
+	entries, _ := os.ReadDir(filepath.Join(home, ".pocketlinx", "downloads"))
+	if len(entries) != 3 {
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		t.Errorf("download cache holds %q, want the 3 completed downloads only", names)
+	}
+}
@@ -0,0 +1,125 @@
+package container
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path"
+	"strings"
+)
+
+// splitCopyPath splits a plx cp path into the directory tar runs in and the entry it
+// archives. "dir/." archives the contents of dir, like docker cp.
+func splitCopyPath(p string) (dir, base string) {
+	contents := p == "." || strings.HasSuffix(p, "/.")
+	p = path.Clean("/" + p)
+	if contents || p == "/" {
+		return p, "."
+	}
+	return path.Dir(p), path.Base(p)
+}
+
+// packScript writes a tar archive of p (see splitCopyPath) to stdout. root is the
+// container's rootfs, or "" for a path of the host; paths that resolve (through
+// symlinks) outside root are refused with status 5. Status 3: p does not exist.
+func packScript(root, p string) string {
+	dir, base := splitCopyPath(p)
+	return fmt.Sprintf(`ROOTFS=%s
+DIR=$(readlink -f "$ROOTFS"%s) && [ -d "$DIR" ] || { echo "no such directory: "%s >&2; exit 3; }
+case "$DIR" in "$ROOTFS"|"$ROOTFS"/*) ;; *) echo %s" is outside the container" >&2; exit 5 ;; esac
+[ -e "$DIR"/%s ] || [ -L "$DIR"/%s ] || { echo "no such file or directory: "%s >&2; exit 3; }
+exec tar -C "$DIR" --numeric-owner -cf - %s
+`, shellQuote(root), shellQuote(dir), shellQuote(dir), shellQuote(p),
+		shellQuote(base), shellQuote(base), shellQuote(p), shellQuote(base))
+}
+
+// unpackScript extracts the tar archive on stdin to dst (root as for packScript). If dst
+// is an existing directory the archive is extracted into it. Otherwise from, the entry
+// the archive was made of, is extracted as dst; "." (the contents of a directory)
+// creates dst. With from "" dst must be an existing directory. Files are owned by root
+// unless copyOwnership keeps the UID/GID of the archive. Status 6: dst cannot be created.
+func unpackScript(root, dst, from string, copyOwnership bool) string {
+	owner := "--no-same-owner"
+	if copyOwnership {
+		owner = "--same-owner --numeric-owner"
+	}
+	clean := path.Clean("/" + dst)
+	var script strings.Builder
+	fmt.Fprintf(&script, `ROOTFS=%s
+confine() { case "$1" in "$ROOTFS"|"$ROOTFS"/*) ;; *) echo %s" is outside the container" >&2; exit 5 ;; esac; }
+DST="$ROOTFS"%s
+if [ -d "$DST" ]; then
+  DIR=$(readlink -f "$DST")
+  confine "$DIR"
+  exec tar -C "$DIR" %s -xf -
+fi
+`, shellQuote(root), shellQuote(dst), shellQuote(clean), owner)
+	if from == "" || strings.HasSuffix(dst, "/") {
+		fmt.Fprintf(&script, `if [ -e "$DST" ]; then echo "not a directory: "%s >&2; else echo "no such directory: "%s >&2; fi
+exit 6
+`, shellQuote(dst), shellQuote(dst))
+		return script.String()
+	}
+	parent, base := shellQuote(path.Dir(clean)), shellQuote(path.Base(clean))
+	fmt.Fprintf(&script, `DIR=$(readlink -f "$ROOTFS"%s) && [ -d "$DIR" ] || { echo "no such directory: "%s >&2; exit 6; }
+confine "$DIR"
+`, parent, parent)
+	if from == "." {
+		fmt.Fprintf(&script, "mkdir \"$DIR\"/%s || exit 6\nexec tar -C \"$DIR\"/%s %s -xf -\n", base, base, owner)
+		return script.String()
+	}
+	// Extracted next to dst first, so that a failed copy leaves dst as it was
+	fmt.Fprintf(&script, `T=$(mktemp -d "$DIR/.plx-cp.XXXXXX") || exit 1
+tar -C "$T" %s -xf - && mv -f "$T"/%s "$DIR"/%s
+CODE=$?
+rm -rf "$T"
+exit $CODE
+`, owner, shellQuote(from), base)
+	return script.String()
+}
+
+// inContainerFunc defines in_container, which runs a script in the mount namespace of
+// the running container (so that its volumes and tmpfs mounts are seen) or, when it is
+// stopped, directly on its rootfs. It needs $PID from containerPIDScript.
+const inContainerFunc = `in_container() { if [ -n "$PID" ]; then nsenter -t "$PID" -m -- sh -c "$1"; else sh -c "$1"; fi; }
+`
+
+// copyToScript copies hostSrc into the container at dst (plx cp <src> <container>:<dst>).
+func copyToScript(pidScript, hostSrc, rootfsDir, dst string, copyOwnership bool) string {
+	_, from := splitCopyPath(hostSrc)
+	return pidScript + inContainerFunc + fmt.Sprintf("sh -c %s | in_container %s\n",
+		shellQuote(packScript("", hostSrc)), shellQuote(unpackScript(rootfsDir, dst, from, copyOwnership)))
+}
+
+// copyFromScript copies src of the container to hostDst (plx cp <container>:<src> <dst>).
+func copyFromScript(pidScript, rootfsDir, src, hostDst string) string {
+	_, from := splitCopyPath(src)
+	return pidScript + inContainerFunc + fmt.Sprintf("in_container %s | sh -c %s\n",
+		shellQuote(packScript(rootfsDir, src)), shellQuote(unpackScript("", hostDst, from, false)))
+}
+
+// getArchiveScript writes a tar archive of src of the container to stdout.
+func getArchiveScript(pidScript, rootfsDir, src string) string {
+	return pidScript + inContainerFunc + fmt.Sprintf("in_container %s\n", shellQuote(packScript(rootfsDir, src)))
+}
+
+// putArchiveScript extracts the tar archive on stdin into the directory dst of the container.
+func putArchiveScript(pidScript, rootfsDir, dst string, copyOwnership bool) string {
+	return pidScript + inContainerFunc + fmt.Sprintf("in_container %s\n", shellQuote(unpackScript(rootfsDir, dst, "", copyOwnership)))
+}
+
+// runCopyScript runs cmd, a copy script, and returns the first message it wrote to
+// stderr as the error (later ones are usually tar complaining about the empty archive).
+func runCopyScript(cmd *exec.Cmd) error {
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err == nil {
+		return nil
+	}
+	if line, _, _ := strings.Cut(strings.TrimSpace(stderr.String()), "\n"); line != "" {
+		return errors.New(line)
+	}
+	return err
+}
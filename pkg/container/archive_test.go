@@ -0,0 +1,119 @@
+package container
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestSplitCopyPath(t *testing.T) {
+	tests := []struct {
+		in, dir, base string
+	}{
+		{"/etc/hosts", "/etc", "hosts"},
+		{"etc/hosts", "/etc", "hosts"},
+		{"/app/", "/", "app"},
+		{"/app/.", "/app", "."},
+		{"app/.", "/app", "."},
+		{".", "/", "."},
+		{"/", "/", "."},
+		{"/a/../b", "/", "b"},
+		{"/../../etc", "/", "etc"},
+	}
+	for _, tt := range tests {
+		if dir, base := splitCopyPath(tt.in); dir != tt.dir || base != tt.base {
+			t.Errorf("splitCopyPath(%q) = %q, %q, want %q, %q", tt.in, dir, base, tt.dir, tt.base)
+		}
+	}
+}
+
+func TestCopyScripts(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a POSIX shell and tar")
+	}
+	outside := t.TempDir()
+	writeFiles(t, outside, map[string]string{"secret": "s"})
+
+	// exitCode runs a pack script piped into an unpack script (or one of them alone)
+	exitCode := func(script string) int {
+		t.Helper()
+		err := exec.Command("sh", "-c", script).Run()
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return exitErr.ExitCode()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return 0
+	}
+	copyTo := func(host, rootfs, dst string) int {
+		_, from := splitCopyPath(host)
+		return exitCode("sh -c " + shellQuote(packScript("", host)) + " | sh -c " + shellQuote(unpackScript(rootfs, dst, from, false)))
+	}
+	newRootfs := func() string {
+		rootfs := filepath.Join(t.TempDir(), "rootfs")
+		writeFiles(t, rootfs, map[string]string{"etc/hosts": "h", "app/main": "m"})
+		for name, target := range map[string]string{"escape": outside, "up": "../..", "etcdir": "etc"} {
+			if err := os.Symlink(target, filepath.Join(rootfs, name)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return rootfs
+	}
+	src := t.TempDir()
+	writeFiles(t, src, map[string]string{"file": "f", "dir/a": "a", "dir/sub/b": "b"})
+
+	tests := []struct {
+		name   string
+		host   string // under src
+		dst    string
+		code   int
+		exists string // under the rootfs, after the copy
+	}{
+		{"file into a directory", "file", "/app", 0, "app/file"},
+		{"file to a new name", "file", "/app/renamed", 0, "app/renamed"},
+		{"directory", "dir", "/app", 0, "app/dir/sub/b"},
+		{"directory contents", "dir/.", "/app", 0, "app/a"},
+		{"directory contents to a new directory", "dir/.", "/new", 0, "new/sub/b"},
+		{"through a symlink inside", "file", "/etcdir", 0, "etc/file"},
+		{"missing parent", "file", "/missing/file", 6, ""},
+		{"trailing slash needs a directory", "file", "/missing/", 6, ""},
+		{"symlink to outside", "file", "/escape", 5, ""},
+		{"symlink to outside as parent", "file", "/escape/file", 5, ""},
+		{"relative symlink out of the rootfs", "file", "/up/file", 5, ""},
+	}
+	for _, tt := range tests {
+		rootfs := newRootfs()
+		if code := copyTo(src+"/"+tt.host, rootfs, tt.dst); code != tt.code { // not Join: it drops "/."
+			t.Errorf("%s: exit status %d, want %d", tt.name, code, tt.code)
+		}
+		if tt.exists != "" {
+			if _, err := os.Stat(filepath.Join(rootfs, tt.exists)); err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+		}
+		if entries, _ := os.ReadDir(outside); len(entries) != 1 {
+			t.Fatalf("%s: wrote outside the container", tt.name)
+		}
+	}
+
+	rootfs := newRootfs()
+	for _, tt := range []struct {
+		src  string
+		code int
+	}{
+		{"/etc/hosts", 0},
+		{"/etcdir/hosts", 0},
+		{"/missing", 3},
+		{"/escape/secret", 5},
+		{"/up/secret", 5},
+	} {
+		if code := exitCode(packScript(rootfs, tt.src)); code != tt.code {
+			t.Errorf("packing %s: exit status %d, want %d", tt.src, code, tt.code)
+		}
+	}
+}
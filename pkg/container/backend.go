@@ -1,18 +1,38 @@
 package container
 
-import "time"
+import (
+	"context"
+	"io"
+	"strings"
+	"time"
+)
 
 // Container はコンテナの情報を保持する構造体です。
 type Container struct {
-	ID      string        `json:"id"`
-	Name    string        `json:"name"`
-	Image   string        `json:"image"`
-	Command string        `json:"command"`
-	Created time.Time     `json:"created"`
-	Status  string        `json:"status"`
-	Ports   []PortMapping `json:"ports"`
-	IP      string        `json:"ip"`
-	Config  RunOptions    `json:"config"`
+	ID      string    `json:"id"`
+	Name    string    `json:"name"`
+	Image   string    `json:"image"`
+	Command string    `json:"command"`
+	Created time.Time `json:"created"`
+	Status  string    `json:"status"`
+	Health  string    `json:"health,omitempty"` // "starting", "healthy" or "unhealthy" when a healthcheck is configured
+	// ExitReason records how the container last stopped: "stopped" (exited after the stop signal,
+	// or stopped with plx stop after it was gone), "killed" (SIGKILL after the stop timeout)
+	// or "unknown" (its process was found gone, see reconcile.go)
+	ExitReason string `json:"exitReason,omitempty"`
+	// RestartCount is how often the restart policy has restarted the container since it was last started
+	RestartCount int `json:"restartCount"`
+	// State of the current or last run. Pid is the host PID of the container's PID 1
+	// while it runs (0 otherwise); ExitCode is 128 + N for a process killed by signal N
+	Pid        int       `json:"pid"`
+	ExitCode   int       `json:"exitCode"`
+	OOMKilled  bool      `json:"oomKilled"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+
+	Ports  []PortMapping `json:"ports"`
+	IP     string        `json:"ip"`
+	Config RunOptions    `json:"config"`
 }
 
 // Mount はホストパスとコンテナパスのペアを表します。
@@ -33,6 +53,22 @@ type ImageMetadata struct {
 	Workdir string            `json:"workdir"`
 	Env     map[string]string `json:"env"`
 	Command []string          `json:"command"`
+
+	Labels       map[string]string `json:"labels,omitempty"`
+	ExposedPorts []string          `json:"exposedPorts,omitempty"` // "80/tcp"
+	Volumes      []string          `json:"volumes,omitempty"`
+	Healthcheck  *HealthConfig     `json:"healthcheck,omitempty"`
+	StopSignal   string            `json:"stopSignal,omitempty"`
+	OnBuild      []string          `json:"onBuild,omitempty"` // ONBUILD triggers, run by builds that use this image as a base
+}
+
+// HealthConfig describes how to probe a container (HEALTHCHECK / --health-*).
+type HealthConfig struct {
+	Test        []string      `json:"test"` // ["NONE"], ["CMD", argv...] or ["CMD-SHELL", cmd]
+	Interval    time.Duration `json:"interval,omitempty"`
+	Timeout     time.Duration `json:"timeout,omitempty"`
+	StartPeriod time.Duration `json:"startPeriod,omitempty"`
+	Retries     int           `json:"retries,omitempty"`
 }
 
 // RunOptions はコンテナ実行時の詳細設定を保持する構造体です。
@@ -47,7 +83,38 @@ type RunOptions struct {
 	Detach      bool
 	User        string
 	Workdir     string
-	ExtraHosts  []string // List of "hostname:ip" mappings
+	ExtraHosts  []string      // List of "hostname:ip" mappings
+	PublishAll  bool          // -P: publish every exposed port on a free host port
+	Healthcheck *HealthConfig // --health-* overrides (merged with the image's HEALTHCHECK)
+	StopSignal  string        // --stop-signal (defaults to the image's STOPSIGNAL, then SIGTERM)
+	Restart     string        // --restart: no, on-failure[:N], always or unless-stopped
+
+	// Resource limits, enforced with a cgroup v2 subtree per container (0 = unlimited)
+	Memory     int64   // --memory in bytes
+	MemorySwap int64   // --memory-swap: memory + swap in bytes (-1 = unlimited swap)
+	CPUs       float64 // --cpus
+	CpusetCpus string  // --cpuset-cpus, e.g. "0-3"
+	PidsLimit  int64   // --pids-limit
+
+	// Logging of detached containers (foreground containers write to the terminal)
+	LogDriver string            // --log-driver: json-file (default), local or none
+	LogOpts   map[string]string // --log-opt: max-size, max-file
+}
+
+// BuildOptions はイメージビルド時の設定を保持する構造体です。
+type BuildOptions struct {
+	ContextDir    string
+	Dockerfile    string            // ContextDir からの相対パス、または絶対パス (既定: Dockerfile)
+	Tag           string            // 空の場合はコンテキストのディレクトリ名
+	BuildArgs     map[string]string // --build-arg
+	NoCache       bool              // --no-cache: ignore every cached step
+	NoCacheFilter []string          // --no-cache-filter: step numbers or instruction types to rebuild
+	Progress      BuildProgress     // --progress (nil: auto-detect on stdout)
+	Secrets       map[string]string // --secret id -> host file, for RUN --mount=type=secret
+	// Reproducible (--reproducible / SOURCE_DATE_EPOCH) writes byte-identical image
+	// archives for identical inputs; mtimes are clamped to SourceDateEpoch (Unix seconds)
+	Reproducible    bool
+	SourceDateEpoch int64
 }
 
 // Backend はコンテナ実行の基盤（WSL2, Linux Native等）を抽象化するインターフェースです。
@@ -56,13 +123,14 @@ type Backend interface {
 	Install() error
 	Pull(image string) error
 	Images() ([]string, error)
+	InspectImage(image string) (*ImageMetadata, error)
 	Run(opts RunOptions) error
 	Start(id string) error
 	List() ([]Container, error)
-	Stop(id string) error
-	Logs(id string) (string, error)
+	Stop(id string, timeout time.Duration) error
+	Logs(ctx context.Context, id string, opts LogOptions, w io.Writer) error
 	Remove(id string) error
-	Build(ctxDir string, dockerfile string, tag string) (string, error) // Dockerfileからビルドしてイメージ名を返す
+	Build(opts BuildOptions) (string, error) // Dockerfileからビルドしてイメージ名を返す
 	Prune() error
 	Diff(image1, image2 string) (string, error)
 	ExportDiff(baseImage, targetImage, outputPath string) error
@@ -71,21 +139,101 @@ type Backend interface {
 	CreateVolume(name string) error
 	RemoveVolume(name string) error
 	ListVolumes() ([]string, error)
+	InspectVolume(name string) (*Volume, error)
+	Networks() []Network
 
 	GetIP(id string) (string, error)
 	Update(id string, opts RunOptions) error
 	Exec(id string, cmd []string, interactive bool) error
+	Stats() ([]ContainerStats, error)
+	RestoreContainers() error // restarts dead containers with a restart policy, see RuntimeService
+	Top(id string, psArgs []string) (*ContainerTop, error)
+	CopyToContainer(id, hostPath, containerPath string, copyOwnership bool) error
+	CopyFromContainer(id, containerPath, hostPath string) error
+	GetArchive(id, containerPath string, w io.Writer) error
+	PutArchive(id, containerPath string, r io.Reader, copyOwnership bool) error
 }
 
 // Dockerfile represents the parsed content of a Dockerfile
 type Dockerfile struct {
-	Base         string
+	GlobalArgs []Instruction // ARGs before the first FROM, see ApplyGlobalArgs
+	Stages     []Stage       // one per FROM; the last stage is the image being built
+}
+
+// Stage is one FROM section of a (multi-stage) Dockerfile
+type Stage struct {
+	Name         string // FROM ... AS name (lower case, "" when unnamed)
+	Base         string // image name, or the name/index of an earlier stage
+	Line         int
 	Instructions []Instruction
 }
 
+// Final returns the stage that produces the image.
+func (df *Dockerfile) Final() *Stage {
+	return &df.Stages[len(df.Stages)-1]
+}
+
 // Instruction represents a single step in the Dockerfile
 type Instruction struct {
-	Type string   // "RUN", "COPY", "ENV", "WORKDIR", "CMD", "EXPOSE"
-	Args []string // For COPY: [src, dest], For ENV: [key, value]
-	Raw  string   // Original command string (useful for RUN)
+	Type     string              // "RUN", "COPY", "ADD", "ENV", "WORKDIR", "CMD", "EXPOSE"
+	Args     []string            // COPY/ADD: [src..., dest], ENV/LABEL: [k1, v1, k2, v2...], CMD: argv
+	Flags    map[string][]string // Leading --name=value options (e.g. COPY --chown=app:app)
+	Raw      string              // Original argument text without leading flags
+	Line     int                 // 1-based line number in the Dockerfile
+	JSONForm bool                // Args came from a JSON exec form (["cmd", "arg"])
+	Shell    []string            // Shell for shell-form RUN (SHELL instruction, default /bin/sh -c)
+	Heredocs []Heredoc           // Heredoc bodies attached to the instruction
+}
+
+// Heredoc is a <<NAME ... NAME block following an instruction.
+type Heredoc struct {
+	Name      string
+	Body      string
+	StripTabs bool // <<-NAME
+}
+
+// Flag returns the last value given for the --name option, or "" if absent.
+func (i Instruction) Flag(name string) string {
+	values := i.Flags[name]
+	if len(values) == 0 {
+		return ""
+	}
+	return values[len(values)-1]
+}
+
+// Sources returns the COPY/ADD sources (every argument but the last).
+func (i Instruction) Sources() []string {
+	if len(i.Args) < 2 {
+		return nil
+	}
+	return i.Args[:len(i.Args)-1]
+}
+
+// Dest returns the COPY/ADD destination (the last argument).
+func (i Instruction) Dest() string {
+	if len(i.Args) == 0 {
+		return ""
+	}
+	return i.Args[len(i.Args)-1]
+}
+
+// ShellCommand returns the RUN command as a single string for /bin/sh -c.
+// Exec-form arguments are quoted so they reach the program unchanged, and a
+// non-default SHELL is invoked explicitly with the script as its last argument.
+func (i Instruction) ShellCommand() string {
+	argv := i.Args
+	if !i.JSONForm {
+		if len(i.Args) == 0 {
+			return ""
+		}
+		if len(i.Shell) == 0 || strings.Join(i.Shell, " ") == strings.Join(DefaultShell, " ") {
+			return i.Args[0]
+		}
+		argv = append(append([]string{}, i.Shell...), i.Args[0])
+	}
+	quoted := make([]string, len(argv))
+	for n, a := range argv {
+		quoted[n] = shellQuote(a)
+	}
+	return strings.Join(quoted, " ")
 }
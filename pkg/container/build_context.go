@@ -0,0 +1,281 @@
+package container
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// BuildContext is a `plx build` context materialised as a local directory.
+type BuildContext struct {
+	Dir        string
+	Dockerfile string // relative to Dir, or absolute ("" = Dir/Dockerfile)
+	Name       string // default image name
+	temp       []string
+}
+
+// Cleanup removes temporary directories created for the context.
+func (c *BuildContext) Cleanup() {
+	for _, dir := range c.temp {
+		os.RemoveAll(dir)
+	}
+}
+
+// PrepareBuildContext resolves the context argument of `plx build`:
+//
+//	dir                      a local directory (as before)
+//	-                        a context tarball (optionally gzipped) read from stdin
+//	app.tar.gz / app.tar     a context tarball on disk
+//	repo.git#ref:subdir      a local git repository checked out at ref (default HEAD)
+//
+// dockerfile "-" reads the Dockerfile from stdin; without a context argument the
+// build then has an empty context.
+func PrepareBuildContext(ctxArg, dockerfile string, stdin io.Reader) (*BuildContext, error) {
+	ctx := &BuildContext{Dockerfile: dockerfile}
+	if err := ctx.prepare(ctxArg, stdin); err != nil {
+		ctx.Cleanup()
+		return nil, err
+	}
+	return ctx, nil
+}
+
+func (c *BuildContext) prepare(ctxArg string, stdin io.Reader) error {
+	if c.Dockerfile == "-" {
+		if ctxArg == "-" {
+			return fmt.Errorf("the context and the Dockerfile cannot both be read from stdin")
+		}
+		dir, err := c.tempDir("plx-dockerfile-")
+		if err != nil {
+			return err
+		}
+		c.Dockerfile = filepath.Join(dir, "Dockerfile")
+		f, err := os.Create(c.Dockerfile)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(f, stdin)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read Dockerfile from stdin: %w", err)
+		}
+		if ctxArg == "" {
+			// No context: COPY/ADD only work with remote sources
+			if c.Dir, err = c.tempDir("plx-context-"); err != nil {
+				return err
+			}
+			c.Name = "stdin"
+			return nil
+		}
+	}
+	if ctxArg == "" {
+		ctxArg = "."
+	}
+
+	if ctxArg == "-" {
+		c.Name = "stdin"
+		return c.extract(stdin, "stdin")
+	}
+
+	repo, ref, isGit := parseGitContext(ctxArg)
+	if isGit {
+		return c.checkoutGit(repo, ref)
+	}
+
+	info, err := os.Stat(ctxArg)
+	if err != nil {
+		return fmt.Errorf("build context %s: %w", ctxArg, err)
+	}
+	if info.IsDir() {
+		c.Dir = ctxArg
+		return nil
+	}
+	if !IsArchive(ctxArg) {
+		return fmt.Errorf("build context %s is neither a directory nor a tar archive", ctxArg)
+	}
+	f, err := os.Open(ctxArg)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	c.Name = archiveBaseName(ctxArg)
+	return c.extract(f, ctxArg)
+}
+
+// parseGitContext splits "path/to/repo.git#ref:subdir". A reference is treated as
+// git when it has a #fragment or the path ends in .git.
+func parseGitContext(arg string) (repo, treeish string, ok bool) {
+	repo, fragment, hasFragment := strings.Cut(arg, "#")
+	if !hasFragment && !strings.HasSuffix(strings.TrimRight(repo, `/\`), ".git") {
+		return "", "", false
+	}
+	ref, subdir, _ := strings.Cut(fragment, ":")
+	if ref == "" {
+		ref = "HEAD"
+	}
+	treeish = ref
+	if subdir = strings.Trim(subdir, "/"); subdir != "" {
+		treeish = ref + ":" + subdir
+	}
+	return repo, treeish, true
+}
+
+// checkoutGit exports the tree at treeish with `git archive` into a temporary context.
+func (c *BuildContext) checkoutGit(repo, treeish string) error {
+	if _, err := os.Stat(repo); err != nil {
+		return fmt.Errorf("git context %s: %w", repo, err)
+	}
+	cmd := exec.Command("git", "-C", repo, "archive", "--format=tar", treeish)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to run git: %w", err)
+	}
+	extractErr := c.extract(out, repo+"#"+treeish)
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("git archive %s in %s failed: %v: %s", treeish, repo, err, strings.TrimSpace(stderr.String()))
+	}
+	if extractErr != nil {
+		return extractErr
+	}
+	c.Name = strings.TrimSuffix(filepath.Base(strings.TrimRight(repo, `/\`)), ".git")
+	return nil
+}
+
+// extract unpacks a (gzipped) tar stream into a new temporary context directory.
+// Symlinks are kept as they are, but no entry may be written through one that points
+// outside the context (a -> /etc followed by a/passwd).
+func (c *BuildContext) extract(r io.Reader, source string) error {
+	dir, err := c.tempDir("plx-context-")
+	if err != nil {
+		return err
+	}
+	c.Dir = dir
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return fmt.Errorf("%s: %w", source, err)
+		}
+		defer gz.Close()
+		r = gz
+	} else {
+		r = br
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: invalid tar archive: %w", source, err)
+		}
+		name := filepath.FromSlash(strings.TrimPrefix(hdr.Name, "./"))
+		if name == "" || name == "." {
+			continue
+		}
+		target := filepath.Join(dir, name)
+		if !strings.HasPrefix(target, dir+string(os.PathSeparator)) || !resolvesInside(realDir, filepath.Dir(target)) {
+			return fmt.Errorf("%s: entry %q escapes the context", source, hdr.Name)
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, os.FileMode(hdr.Mode)&os.ModePerm|0700); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			// Replace an earlier entry instead of writing through it if it is a symlink
+			if fi, err := os.Lstat(target); err == nil && !fi.IsDir() {
+				if err := os.Remove(target); err != nil {
+					return err
+				}
+			}
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(hdr.Mode)&os.ModePerm)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(f, tr)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := os.Symlink(hdr.Linkname, target); err != nil {
+				return fmt.Errorf("%s: %w", source, err)
+			}
+		case tar.TypeLink:
+			linkTarget := filepath.Join(dir, filepath.FromSlash(hdr.Linkname))
+			if !strings.HasPrefix(linkTarget, dir+string(os.PathSeparator)) || !resolvesInside(realDir, filepath.Dir(linkTarget)) {
+				return fmt.Errorf("%s: link %q escapes the context", source, hdr.Name)
+			}
+			if err := os.Link(linkTarget, target); err != nil {
+				return fmt.Errorf("%s: %w", source, err)
+			}
+		}
+	}
+}
+
+// resolvesInside reports whether p stays inside root (a path without symlinks) once
+// the symlinks in its existing part are resolved. The missing rest is created as
+// plain directories, so it cannot leave root.
+func resolvesInside(root, p string) bool {
+	existing := p
+	for {
+		if _, err := os.Lstat(existing); err == nil {
+			break
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			return false
+		}
+		existing = parent
+	}
+	real, err := filepath.EvalSymlinks(existing)
+	if err != nil {
+		return false // dangling symlink
+	}
+	return real == root || strings.HasPrefix(real, root+string(os.PathSeparator))
+}
+
+func (c *BuildContext) tempDir(prefix string) (string, error) {
+	dir, err := os.MkdirTemp("", prefix)
+	if err != nil {
+		return "", err
+	}
+	c.temp = append(c.temp, dir)
+	return dir, nil
+}
+
+func archiveBaseName(p string) string {
+	name := filepath.Base(p)
+	for _, ext := range []string{".tar.gz", ".tgz", ".tar"} {
+		if strings.HasSuffix(strings.ToLower(name), ext) {
+			return name[:len(name)-len(ext)]
+		}
+	}
+	return name
+}
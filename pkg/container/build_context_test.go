@@ -0,0 +1,101 @@
+package container
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+type tarEntry struct {
+	name, link string
+	typ        byte
+	body       string
+}
+
+func tarStream(t *testing.T, entries []tarEntry) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Linkname: e.link, Typeflag: e.typ, Mode: 0644, Size: int64(len(e.body))}
+		if e.typ == tar.TypeDir {
+			hdr.Mode = 0755
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+func TestExtractContextStaysInside(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("creating symlinks needs extra privileges on Windows")
+	}
+	outside := t.TempDir()
+	writeFiles(t, outside, map[string]string{"passwd": "root"})
+
+	tests := []struct {
+		name    string
+		entries []tarEntry
+		ok      bool
+	}{
+		{"file through an absolute symlink", []tarEntry{
+			{name: "a", link: outside, typ: tar.TypeSymlink},
+			{name: "a/x", typ: tar.TypeReg, body: "pwned"},
+		}, false},
+		{"directory through a relative symlink", []tarEntry{
+			{name: "a", link: "../../../../../../../../" + outside, typ: tar.TypeSymlink},
+			{name: "a/sub/", typ: tar.TypeDir},
+		}, false},
+		{"file through a nested symlink", []tarEntry{
+			{name: "d/", typ: tar.TypeDir},
+			{name: "d/up", link: "..", typ: tar.TypeSymlink},
+			{name: "d/up/up", link: "..", typ: tar.TypeSymlink},
+			{name: "d/up/up/x", typ: tar.TypeReg, body: "pwned"},
+		}, false},
+		{"hard link through a symlink", []tarEntry{
+			{name: "a", link: outside, typ: tar.TypeSymlink},
+			{name: "b", link: "a/passwd", typ: tar.TypeLink},
+		}, false},
+		{"dotdot entry name", []tarEntry{
+			{name: "../x", typ: tar.TypeReg, body: "pwned"},
+		}, false},
+		{"file over a symlink replaces the link", []tarEntry{
+			{name: "a", link: filepath.Join(outside, "passwd"), typ: tar.TypeSymlink},
+			{name: "a", typ: tar.TypeReg, body: "pwned"},
+		}, true},
+		{"symlinks are kept", []tarEntry{
+			{name: "bin", link: "/usr/bin", typ: tar.TypeSymlink},
+			{name: "app/", typ: tar.TypeDir},
+			{name: "app/main", typ: tar.TypeReg, body: "x"},
+			{name: "current", link: "app", typ: tar.TypeSymlink},
+			{name: "current/config", typ: tar.TypeReg, body: "x"},
+		}, true},
+	}
+	for _, tt := range tests {
+		ctx, err := PrepareBuildContext("-", "", tarStream(t, tt.entries))
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: error = %v, want ok %v", tt.name, err, tt.ok)
+		}
+		if ctx != nil {
+			ctx.Cleanup()
+		}
+		files, _ := os.ReadDir(outside)
+		if len(files) != 1 {
+			t.Fatalf("%s: wrote outside the context: %v", tt.name, files)
+		}
+		if data, _ := os.ReadFile(filepath.Join(outside, "passwd")); string(data) != "root" {
+			t.Fatalf("%s: overwrote a file outside the context", tt.name)
+		}
+	}
+}
@@ -5,9 +5,11 @@ import (
 	"encoding/hex"
 	"fmt"
 	"io"
-	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -16,8 +18,93 @@ func GetWslCacheDir() string {
 	return "/var/lib/pocketlinx/cache"
 }
 
+// BuildStepEnv is the build state a step runs in, beyond the files of the previous layer.
+type BuildStepEnv struct {
+	User    string
+	Workdir string
+	Args    map[string]string // ARGs declared so far, with their effective values
+	From    map[string]string // COPY --from value -> cache key of that stage or image
+}
+
+// GetWslCacheMountsDir returns the directory that persists RUN --mount=type=cache contents inside WSL
+func GetWslCacheMountsDir() string {
+	return "/var/lib/pocketlinx/cache-mounts"
+}
+
+// CacheLayer describes a cached build step stored as a diff against its parent
+// (<hash>.json next to <hash>.tar.gz). The chain ends at the base image.
+type CacheLayer struct {
+	Parent     string   `json:"parent,omitempty"` // previous checkpoint, "" for the base image
+	Base       string   `json:"base"`
+	BaseDigest string   `json:"baseDigest"`
+	Whiteouts  []string `json:"whiteouts,omitempty"` // paths removed (or replaced by another file type) since the parent
+	Changed    int      `json:"changed"`             // number of entries in the diff archive
+}
+
+// pruneWhiteouts drops paths that lie inside another removed directory.
+func pruneWhiteouts(paths []string) []string {
+	sort.Strings(paths)
+	removed := make(map[string]bool)
+	var out []string
+	for _, p := range paths {
+		if p == "" || removed[p] {
+			continue
+		}
+		covered := false
+		for dir := path.Dir(p); dir != "." && dir != "/"; dir = path.Dir(dir) {
+			if removed[dir] {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			removed[p] = true
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// CalculateBuildHashes computes the cache key of every step. The chain is seeded
+// with the base image digest (or the key of the base stage), so a re-pulled base
+// invalidates all cached layers. from maps COPY --from values to the key of their source.
+func CalculateBuildHashes(baseDigest string, instrs []Instruction, ctxDir string, buildArgs map[string]string, from map[string]string) ([]string, error) {
+	parentHash := StageBaseKey(baseDigest)
+	env := BuildStepEnv{User: "root", Workdir: "/", Args: make(map[string]string), From: from}
+
+	hashes := make([]string, len(instrs))
+	for i, instr := range instrs {
+		switch instr.Type {
+		case "ARG":
+			for k, v := range ResolveBuildArgs(instr, buildArgs) {
+				env.Args[k] = v
+			}
+		case "USER":
+			if len(instr.Args) > 0 {
+				env.User = instr.Args[0]
+			}
+		case "WORKDIR":
+			if len(instr.Args) > 0 {
+				env.Workdir = ResolveWorkdir(env.Workdir, instr.Args[0])
+			}
+		}
+		h, err := CalculateInstructionHash(parentHash, instr, ctxDir, env)
+		if err != nil {
+			return nil, fmt.Errorf("failed to calculate hash for step %d: %w", i+1, err)
+		}
+		hashes[i] = h
+		parentHash = h
+	}
+	return hashes, nil
+}
+
+// StageBaseKey returns the key a stage's step chain starts from.
+func StageBaseKey(baseDigest string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte("FROM "+baseDigest)))
+}
+
 // CalculateInstructionHash computes a deterministic hash for a build step
-func CalculateInstructionHash(parentHash string, instr Instruction, ctxDir string) (string, error) {
+func CalculateInstructionHash(parentHash string, instr Instruction, ctxDir string, env BuildStepEnv) (string, error) {
 	hasher := sha256.New()
 
 	// Mix in parent hash (chaining)
@@ -27,84 +114,210 @@ func CalculateInstructionHash(parentHash string, instr Instruction, ctxDir strin
 	hasher.Write([]byte(instr.Type))
 	hasher.Write([]byte(instr.Raw))
 
-	// For COPY, we must hash the actual file contents
-	if instr.Type == "COPY" && len(instr.Args) >= 2 {
-		// instr.Args[0] is source (relative to ctxDir)
-		srcPath := filepath.Join(ctxDir, instr.Args[0])
-		fileHash, err := hashPath(srcPath)
+	// Flags, heredoc bodies and the SHELL are not part of Raw
+	for _, name := range sortedKeys(instr.Flags) {
+		fmt.Fprintf(hasher, "|--%s=%q", name, instr.Flags[name])
+	}
+	for _, doc := range instr.Heredocs {
+		fmt.Fprintf(hasher, "|<<%s\n%s", doc.Name, doc.Body)
+	}
+	if instr.Type == "RUN" {
+		fmt.Fprintf(hasher, "|shell=%q", instr.Shell)
+	}
+
+	// Mix in the build environment: the same RUN may behave differently per user, workdir or --build-arg
+	fmt.Fprintf(hasher, "|user=%s|workdir=%s", env.User, env.Workdir)
+	for _, k := range sortedKeys(env.Args) {
+		fmt.Fprintf(hasher, "|arg:%s=%s", k, env.Args[k])
+	}
+
+	// COPY --from: the sources come from another stage or image, identified by its key
+	if from := instr.Flag("from"); from != "" && instr.Type == "COPY" {
+		key, ok := env.From[from]
+		if !ok {
+			return "", fmt.Errorf("COPY --from=%s: unknown stage or image", from)
+		}
+		fmt.Fprintf(hasher, "|from=%s", key)
+		return fmt.Sprintf("%x", hasher.Sum(nil)), nil
+	}
+
+	// For COPY/ADD, we must hash the actual file contents
+	if instr.Type == "COPY" || instr.Type == "ADD" {
+		sources, err := ExpandSources(ctxDir, instr)
+		if err != nil {
+			return "", err
+		}
+		ignore, err := LoadIgnoreMatcher(ctxDir)
 		if err != nil {
-			return "", fmt.Errorf("failed to hash copy source %s: %w", srcPath, err)
+			return "", err
+		}
+		for _, src := range sources {
+			hasher.Write([]byte(src))
+			if instr.Type == "ADD" && IsRemoteSource(src) {
+				// A pinned checksum identifies the content; otherwise hash what we download
+				checksum := instr.Flag("checksum")
+				if checksum == "" {
+					localPath, err := FetchRemoteSource(src, "")
+					if err != nil {
+						return "", err
+					}
+					if checksum, err = fileSHA256(localPath); err != nil {
+						return "", fmt.Errorf("failed to hash add source %s: %w", src, err)
+					}
+				}
+				hasher.Write([]byte(checksum))
+				continue
+			}
+			// src is relative to ctxDir, or a file:// URL
+			srcPath := ResolveLocalSource(ctxDir, src)
+			fileHash, err := hashPath(ctxDir, srcPath, ignore)
+			if err != nil {
+				return "", fmt.Errorf("failed to hash copy source %s: %w", srcPath, err)
+			}
+			hasher.Write([]byte(fileHash))
 		}
-		hasher.Write([]byte(fileHash))
 	}
 
 	return hex.EncodeToString(hasher.Sum(nil)), nil
 }
 
-// hashPath computes SHA256 of a file or directory recursively, respecting .plxignore
-func hashPath(pathStr string) (string, error) {
-	hasher := sha256.New()
+// ResolveBuildArgs returns the effective value of every argument declared by an ARG
+// instruction: the --build-arg value if given, otherwise the default.
+// Arguments without either are left undefined, as in Docker.
+func ResolveBuildArgs(instr Instruction, buildArgs map[string]string) map[string]string {
+	values := make(map[string]string)
+	for _, decl := range instr.Args {
+		name, def, hasDefault := strings.Cut(decl, "=")
+		if v, ok := buildArgs[name]; ok {
+			values[name] = v
+		} else if hasDefault {
+			values[name] = def
+		}
+	}
+	return values
+}
 
-	// Load ignore patterns if .plxignore exists in the context root
-	ignorePatterns := make(map[string]bool)
-	ignoreFile := filepath.Join(pathStr, ".plxignore")
-	if data, err := os.ReadFile(ignoreFile); err == nil {
-		lines := strings.Split(string(data), "\n")
-		for _, line := range lines {
-			line = strings.TrimSpace(line)
-			if line != "" && !strings.HasPrefix(line, "#") {
-				ignorePatterns[line] = true
-			}
+// predefinedBuildArgs are build args plx build itself reads, so they are used without
+// an ARG instruction (SOURCE_DATE_EPOCH turns on --reproducible).
+var predefinedBuildArgs = map[string]bool{"SOURCE_DATE_EPOCH": true}
+
+// UnusedBuildArgs returns the --build-arg names that no ARG instruction declares and
+// plx build does not read itself.
+func UnusedBuildArgs(instrs []Instruction, buildArgs map[string]string) []string {
+	declared := make(map[string]bool)
+	for _, instr := range instrs {
+		if instr.Type != "ARG" {
+			continue
+		}
+		for _, decl := range instr.Args {
+			name, _, _ := strings.Cut(decl, "=")
+			declared[name] = true
 		}
 	}
+	var unused []string
+	for _, k := range sortedKeys(buildArgs) {
+		if !declared[k] && !predefinedBuildArgs[k] {
+			unused = append(unused, k)
+		}
+	}
+	return unused
+}
 
-	// Always ignore these
-	ignorePatterns[".git"] = true
+// ResolveWorkdir applies a WORKDIR instruction; relative paths are taken from the current directory.
+func ResolveWorkdir(current, dir string) string {
+	if path.IsAbs(dir) {
+		return path.Clean(dir)
+	}
+	return path.Join(current, dir)
+}
 
-	count := 0
-	err := filepath.WalkDir(pathStr, func(p string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return err
+// CacheLookupLimit returns the number of leading steps that may be served from
+// the cache: 0 with --no-cache, otherwise the steps before the first one
+// selected by --no-cache-filter (a stage name, a 1-based step number or an instruction type).
+func CacheLookupLimit(opts BuildOptions, stage Stage) int {
+	if opts.NoCache {
+		return 0
+	}
+	for _, f := range opts.NoCacheFilter {
+		if stage.Name != "" && strings.EqualFold(f, stage.Name) {
+			return 0
+		}
+	}
+	instrs := stage.Instructions
+	for i, instr := range instrs {
+		for _, f := range opts.NoCacheFilter {
+			if n, err := strconv.Atoi(f); err == nil && n == i+1 {
+				return i
+			}
+			if strings.EqualFold(f, instr.Type) {
+				return i
+			}
 		}
+	}
+	return len(instrs)
+}
 
-		relPath, _ := filepath.Rel(pathStr, p)
-		if relPath == "." {
-			return nil
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// hashPath computes SHA256 of a file or directory recursively.
+// Paths excluded by the context's ignore file do not contribute to the hash.
+func hashPath(ctxDir, pathStr string, ignore *IgnoreMatcher) (string, error) {
+	hasher := sha256.New()
+
+	info, err := os.Stat(pathStr)
+	if err != nil {
+		return "", err
+	}
+	entries := []string{"."}
+	if info.IsDir() {
+		if entries, err = ListContextFiles(ctxDir, pathStr, ignore); err != nil {
+			return "", err
 		}
+	}
 
-		// Check if this path should be ignored
-		if ignorePatterns[relPath] || ignorePatterns[filepath.Base(p)] {
-			if d.IsDir() {
-				return filepath.SkipDir
-			}
-			return nil
+	for count, relPath := range entries {
+		if os.Getenv("PLX_VERBOSE") != "" && count > 0 && count%100 == 0 {
+			fmt.Fprintf(os.Stderr, "\r[DEBUG] Hashing context: %d files scanned...", count)
 		}
 
-		count++
-		if os.Getenv("PLX_VERBOSE") != "" && count%100 == 0 {
-			fmt.Printf("\r[DEBUG] Hashing context: %d files scanned...", count)
+		p := filepath.Join(pathStr, filepath.FromSlash(relPath))
+		st, err := os.Lstat(p)
+		if err != nil {
+			return "", err
 		}
 
-		// Hash the relative path and mode
-		fmt.Fprintf(hasher, "%s|%v|", relPath, d.IsDir())
+		// Hash the relative path and mode (type and permission bits, which COPY keeps)
+		fmt.Fprintf(hasher, "%s|%v|", relPath, st.Mode())
 
-		if !d.IsDir() {
-			f, err := os.Open(p)
-			if err != nil {
-				return err
-			}
-			defer f.Close()
-			if _, err := io.Copy(hasher, f); err != nil {
-				return err
+		switch {
+		case st.Mode()&os.ModeSymlink != 0:
+			target, _ := os.Readlink(p)
+			fmt.Fprintf(hasher, "->%s|", target)
+		case st.Mode().IsRegular():
+			if err := hashFile(hasher, p); err != nil {
+				return "", err
 			}
 		}
-		return nil
-	})
-	if os.Getenv("PLX_VERBOSE") != "" && count > 0 {
-		fmt.Println()
 	}
-	if err != nil {
-		return "", err
+	if os.Getenv("PLX_VERBOSE") != "" && len(entries) >= 100 {
+		fmt.Fprintln(os.Stderr)
 	}
 	return hex.EncodeToString(hasher.Sum(nil)), nil
 }
+
+func hashFile(w io.Writer, p string) error {
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
@@ -0,0 +1,75 @@
+package container
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestHashPath(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(dir string) error
+		same   bool
+	}{
+		{"nothing changed", func(string) error { return nil }, true},
+		{"content", func(dir string) error {
+			return os.WriteFile(filepath.Join(dir, "app", "run.sh"), []byte("echo changed\n"), 0644)
+		}, false},
+		{"new file", func(dir string) error {
+			return os.WriteFile(filepath.Join(dir, "app", "new"), nil, 0644)
+		}, false},
+		{"mode", func(dir string) error {
+			return os.Chmod(filepath.Join(dir, "app", "run.sh"), 0755)
+		}, runtime.GOOS == "windows"}, // only the read-only bit exists there
+		{"ignored file", func(dir string) error {
+			return os.WriteFile(filepath.Join(dir, "app", "debug.log"), []byte("x"), 0644)
+		}, true},
+	}
+	ignore, err := NewIgnoreMatcher([]string{"**/*.log"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		writeFiles(t, dir, map[string]string{"app/run.sh": "echo hi\n", "app/lib/a.txt": "a"})
+		before, err := hashPath(dir, filepath.Join(dir, "app"), ignore)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := tt.change(dir); err != nil {
+			t.Fatal(err)
+		}
+		after, err := hashPath(dir, filepath.Join(dir, "app"), ignore)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (before == after) != tt.same {
+			t.Errorf("%s: hash unchanged = %v, want %v", tt.name, before == after, tt.same)
+		}
+	}
+}
+
+func TestUnusedBuildArgs(t *testing.T) {
+	df, err := ParseDockerfileReader("Dockerfile", strings.NewReader("ARG BASE=alpine\nFROM $BASE\nARG VERSION\nARG A=1 B\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		args map[string]string
+		want []string
+	}{
+		{nil, nil},
+		{map[string]string{"BASE": "x", "VERSION": "1", "B": "2"}, nil},
+		{map[string]string{"VERSION": "1", "TYPO": "x", "OTHER": "y"}, []string{"OTHER", "TYPO"}},
+		{map[string]string{"SOURCE_DATE_EPOCH": "0"}, nil},
+	}
+	for _, tt := range tests {
+		if got := UnusedBuildArgs(df.allInstructions(), tt.args); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("UnusedBuildArgs(%v) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package container
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// cgroupCPUPeriod is the cpu.max period (µs) --cpus is expressed against.
+const cgroupCPUPeriod = 100000
+
+var (
+	memorySizeRe = regexp.MustCompile(`^(\d+(?:\.\d+)?) ?([kKmMgGtT]?)(?:[iI]?[bB])?$`)
+	cpusetRe     = regexp.MustCompile(`^\d+(-\d+)?(,\d+(-\d+)?)*$`)
+)
+
+// ParseMemoryBytes parses a --memory value such as "512m", "1.5g" or "1048576"
+// (binary units, an optional "b"/"ib" suffix) into bytes.
+func ParseMemoryBytes(s string) (int64, error) {
+	m := memorySizeRe.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return 0, fmt.Errorf("invalid size: %q (expected a number with an optional unit b, k, m, g or t)", s)
+	}
+	n, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size: %q", s)
+	}
+	shift := strings.Index("kmgt", strings.ToLower(m[2])) + 1
+	if m[2] == "" {
+		shift = 0
+	}
+	return int64(n * float64(int64(1)<<(10*shift))), nil
+}
+
+// HasResourceLimits reports whether the container must get a cgroup with limits.
+func (o RunOptions) HasResourceLimits() bool {
+	return o.Memory > 0 || o.CPUs > 0 || o.CpusetCpus != "" || o.PidsLimit > 0
+}
+
+// ValidateResources checks the --memory/--cpus/... options before anything is created.
+func ValidateResources(o RunOptions) error {
+	if o.Memory < 0 {
+		return fmt.Errorf("--memory must not be negative")
+	}
+	if o.Memory > 0 && o.Memory < 6*1024*1024 {
+		return fmt.Errorf("--memory must be at least 6MB")
+	}
+	switch {
+	case o.MemorySwap == 0 || o.MemorySwap == -1:
+	case o.MemorySwap < -1:
+		return fmt.Errorf("--memory-swap must be -1 (unlimited) or a size")
+	case o.Memory == 0:
+		return fmt.Errorf("--memory-swap requires --memory")
+	case o.MemorySwap < o.Memory:
+		return fmt.Errorf("--memory-swap (memory + swap) must be at least --memory")
+	}
+	if o.CPUs < 0 {
+		return fmt.Errorf("--cpus must not be negative")
+	}
+	if o.CPUs > 0 && o.CPUs*cgroupCPUPeriod < 1000 {
+		return fmt.Errorf("--cpus must be at least 0.01")
+	}
+	if o.CpusetCpus != "" && !cpusetRe.MatchString(o.CpusetCpus) {
+		return fmt.Errorf("invalid --cpuset-cpus %q (expected e.g. 0-3 or 0,2)", o.CpusetCpus)
+	}
+	return nil
+}
+
+// cgroupControllers returns the cgroup v2 controllers the options need.
+func (o RunOptions) cgroupControllers() []string {
+	var controllers []string
+	if o.Memory > 0 {
+		controllers = append(controllers, "memory")
+	}
+	if o.CPUs > 0 {
+		controllers = append(controllers, "cpu")
+	}
+	if o.CpusetCpus != "" {
+		controllers = append(controllers, "cpuset")
+	}
+	if o.PidsLimit > 0 {
+		controllers = append(controllers, "pids")
+	}
+	return controllers
+}
+
+// cgroupLimits returns the interface files to write, in order.
+func (o RunOptions) cgroupLimits() [][2]string {
+	var limits [][2]string
+	if o.Memory > 0 {
+		limits = append(limits, [2]string{"memory.max", strconv.FormatInt(o.Memory, 10)})
+		// Like Docker, --memory alone allows as much swap as memory
+		swap := strconv.FormatInt(o.Memory, 10)
+		switch {
+		case o.MemorySwap == -1:
+			swap = "max"
+		case o.MemorySwap > 0:
+			swap = strconv.FormatInt(o.MemorySwap-o.Memory, 10)
+		}
+		limits = append(limits, [2]string{"memory.swap.max", swap})
+	}
+	if o.CPUs > 0 {
+		limits = append(limits, [2]string{"cpu.max", fmt.Sprintf("%d %d", int64(o.CPUs*cgroupCPUPeriod), cgroupCPUPeriod)})
+	}
+	if o.CpusetCpus != "" {
+		limits = append(limits, [2]string{"cpuset.cpus", o.CpusetCpus})
+	}
+	if o.PidsLimit > 0 {
+		limits = append(limits, [2]string{"pids.max", strconv.FormatInt(o.PidsLimit, 10)})
+	}
+	return limits
+}
+
+// cgroupAccounting are the controllers enabled for every container, when available,
+// so that plx stats can report CPU, memory, IO and PID usage.
+var cgroupAccounting = []string{"cpu", "memory", "io", "pids"}
+
+// cgroupSetupFunc defines the shell function setup_cgroup, which creates the cgroup v2
+// subtree pocketlinx/<id> with the container's limits and sets $CG to its path. The
+// shim joins $CG (passed as PLX_CGROUP) before it execs the container process.
+// cgroup2 is mounted at /sys/fs/cgroup/unified when the host (WSL) has only v1.
+// Without limits the cgroup is only used for accounting: if it cannot be created,
+// $CG is left empty and the container runs without one.
+func cgroupSetupFunc(id string, o RunOptions) string {
+	required := o.cgroupControllers()
+	fail, unavailable := `{ CG=""; return 0; }`, `CG=""; return 0`
+	if len(required) > 0 {
+		fail, unavailable = "return 1", `echo "plx: cgroup v2 is not available" >&2; return 1`
+	}
+	controllers := append([]string{}, cgroupAccounting...)
+	for _, c := range required {
+		if c == "cpuset" {
+			controllers = append(controllers, c)
+		}
+	}
+
+	var script strings.Builder
+	fmt.Fprintf(&script, `setup_cgroup() {
+  CG=""
+  CG_ROOT=/sys/fs/cgroup
+  if [ ! -f "$CG_ROOT/cgroup.controllers" ]; then
+    CG_ROOT=/sys/fs/cgroup/unified
+    if [ ! -f "$CG_ROOT/cgroup.controllers" ]; then
+      mkdir -p "$CG_ROOT" 2>/dev/null && mount -t cgroup2 cgroup2 "$CG_ROOT" 2>/dev/null || { %s; }
+    fi
+  fi
+  mkdir -p "$CG_ROOT/pocketlinx" 2>/dev/null || %s
+  for c in %s; do
+    grep -qw "$c" "$CG_ROOT/cgroup.controllers" || continue
+    echo "+$c" > "$CG_ROOT/cgroup.subtree_control" 2>/dev/null
+    echo "+$c" > "$CG_ROOT/pocketlinx/cgroup.subtree_control" 2>/dev/null
+  done
+`, unavailable, fail, strings.Join(controllers, " "))
+	if len(required) > 0 {
+		fmt.Fprintf(&script, "  for c in %s; do\n", strings.Join(required, " "))
+		script.WriteString(`    if ! grep -qw "$c" "$CG_ROOT/pocketlinx/cgroup.subtree_control"; then
+      echo "plx: the cgroup v2 $c controller is not available (on WSL, set kernelCommandLine = cgroup_no_v1=all in .wslconfig)" >&2
+      return 1
+    fi
+  done
+`)
+	}
+	fmt.Fprintf(&script, "  mkdir -p \"$CG_ROOT/pocketlinx/\"%s 2>/dev/null || %s\n", shellQuote(id), fail)
+	fmt.Fprintf(&script, "  CG=\"$CG_ROOT/pocketlinx/\"%s\n", shellQuote(id))
+	for _, l := range o.cgroupLimits() {
+		guard := ""
+		if l[0] == "memory.swap.max" {
+			guard = "[ ! -e \"$CG/memory.swap.max\" ] || " // no swap accounting
+		}
+		fmt.Fprintf(&script, "  %secho %s > \"$CG/%s\" || { echo \"plx: failed to set %s\" >&2; return 1; }\n", guard, shellQuote(l[1]), l[0], l[0])
+	}
+	script.WriteString("}\n")
+	return script.String()
+}
+
+// cgroupSetupScript creates the container's cgroup and prints its path ("" if it has none).
+func cgroupSetupScript(id string, o RunOptions) string {
+	return cgroupSetupFunc(id, o) + "setup_cgroup && echo \"$CG\"\n"
+}
+
+// cgroupCleanupScript kills whatever is left in the container's cgroup and removes it.
+func cgroupCleanupScript(id string) string {
+	return fmt.Sprintf(`for CG in /sys/fs/cgroup/pocketlinx/%s /sys/fs/cgroup/unified/pocketlinx/%s; do
+  [ -d "$CG" ] || continue
+  [ -f "$CG/cgroup.kill" ] && echo 1 > "$CG/cgroup.kill" 2>/dev/null
+  i=0
+  while ! rmdir "$CG" 2>/dev/null && [ "$i" -lt 20 ]; do sleep 0.1; i=$((i + 1)); done
+done
+`, shellQuote(id), shellQuote(id))
+}
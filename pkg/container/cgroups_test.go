@@ -0,0 +1,97 @@
+package container
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMemoryBytes(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+		err  bool
+	}{
+		{"1048576", 1048576, false},
+		{"512m", 512 << 20, false},
+		{"512M", 512 << 20, false},
+		{"1.5g", 3 << 29, false},
+		{"2gb", 2 << 30, false},
+		{"2GiB", 2 << 30, false},
+		{"64k", 64 << 10, false},
+		{"1t", 1 << 40, false},
+		{"100b", 100, false},
+		{" 1 m ", 1 << 20, false},
+		{"", 0, true},
+		{"m", 0, true},
+		{"-1m", 0, true},
+		{"1x", 0, true},
+		{"1.m", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseMemoryBytes(tt.in)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("ParseMemoryBytes(%q) = %d, %v, want %d (error %v)", tt.in, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestValidateResources(t *testing.T) {
+	const mb = 1 << 20
+	tests := []struct {
+		name string
+		opts RunOptions
+		ok   bool
+	}{
+		{"no limits", RunOptions{}, true},
+		{"memory", RunOptions{Memory: 64 * mb}, true},
+		{"memory below the minimum", RunOptions{Memory: 4 * mb}, false},
+		{"negative memory", RunOptions{Memory: -1}, false},
+		{"memory and swap", RunOptions{Memory: 64 * mb, MemorySwap: 128 * mb}, true},
+		{"unlimited swap", RunOptions{Memory: 64 * mb, MemorySwap: -1}, true},
+		{"swap below memory", RunOptions{Memory: 64 * mb, MemorySwap: 32 * mb}, false},
+		{"swap without memory", RunOptions{MemorySwap: 64 * mb}, false},
+		{"invalid swap", RunOptions{Memory: 64 * mb, MemorySwap: -2}, false},
+		{"cpus", RunOptions{CPUs: 0.5}, true},
+		{"cpus below the minimum", RunOptions{CPUs: 0.001}, false},
+		{"negative cpus", RunOptions{CPUs: -1}, false},
+		{"cpuset range", RunOptions{CpusetCpus: "0-3"}, true},
+		{"cpuset list", RunOptions{CpusetCpus: "0,2,4-5"}, true},
+		{"invalid cpuset", RunOptions{CpusetCpus: "0-"}, false},
+	}
+	for _, tt := range tests {
+		if err := ValidateResources(tt.opts); (err == nil) != tt.ok {
+			t.Errorf("%s: ValidateResources = %v, want ok %v", tt.name, err, tt.ok)
+		}
+	}
+}
+
+func TestCgroupLimits(t *testing.T) {
+	const mb = 1 << 20
+	tests := []struct {
+		name        string
+		opts        RunOptions
+		controllers []string
+		limits      [][2]string
+	}{
+		{"none", RunOptions{}, nil, nil},
+		{"memory allows as much swap", RunOptions{Memory: 64 * mb},
+			[]string{"memory"}, [][2]string{{"memory.max", "67108864"}, {"memory.swap.max", "67108864"}}},
+		{"memory-swap is memory plus swap", RunOptions{Memory: 64 * mb, MemorySwap: 96 * mb},
+			[]string{"memory"}, [][2]string{{"memory.max", "67108864"}, {"memory.swap.max", "33554432"}}},
+		{"unlimited swap", RunOptions{Memory: 64 * mb, MemorySwap: -1},
+			[]string{"memory"}, [][2]string{{"memory.max", "67108864"}, {"memory.swap.max", "max"}}},
+		{"cpu, cpuset and pids", RunOptions{CPUs: 1.5, CpusetCpus: "0-1", PidsLimit: 100},
+			[]string{"cpu", "cpuset", "pids"}, [][2]string{{"cpu.max", "150000 100000"}, {"cpuset.cpus", "0-1"}, {"pids.max", "100"}}},
+	}
+	for _, tt := range tests {
+		if got := tt.opts.cgroupControllers(); !reflect.DeepEqual(got, tt.controllers) {
+			t.Errorf("%s: controllers = %q, want %q", tt.name, got, tt.controllers)
+		}
+		if got := tt.opts.cgroupLimits(); !reflect.DeepEqual(got, tt.limits) {
+			t.Errorf("%s: limits = %q, want %q", tt.name, got, tt.limits)
+		}
+		if got := tt.opts.HasResourceLimits(); got != (tt.limits != nil) {
+			t.Errorf("%s: HasResourceLimits = %v", tt.name, got)
+		}
+	}
+}
@@ -1,5 +1,11 @@
 package container
 
+import (
+	"context"
+	"io"
+	"time"
+)
+
 const (
 	DistroName = "pocketlinx"
 )
@@ -52,6 +58,11 @@ func (e *Engine) Images() ([]string, error) {
 	return e.backend.Images()
 }
 
+// InspectImage はイメージのメタデータ（CMD, LABEL, EXPOSE 等）を取得します。
+func (e *Engine) InspectImage(image string) (*ImageMetadata, error) {
+	return e.backend.InspectImage(image)
+}
+
 // Run はコンテナ内でコマンドを実行します。
 func (e *Engine) Run(opts RunOptions) error {
 	return e.backend.Run(opts)
@@ -71,16 +82,17 @@ func (e *Engine) Remove(id string) error {
 	return e.backend.Remove(id)
 }
 
-func (e *Engine) Stop(id string) error {
-	return e.backend.Stop(id)
+// Stop はコンテナに停止シグナルを送り、timeout 経過後も終了しなければ強制終了します。
+func (e *Engine) Stop(id string, timeout time.Duration) error {
+	return e.backend.Stop(id, timeout)
 }
 
-func (e *Engine) Logs(id string) (string, error) {
-	return e.backend.Logs(id)
+func (e *Engine) Logs(ctx context.Context, id string, opts LogOptions, w io.Writer) error {
+	return e.backend.Logs(ctx, id, opts, w)
 }
 
-func (e *Engine) Build(ctxDir string, dockerfile string, tag string) (string, error) {
-	return e.backend.Build(ctxDir, dockerfile, tag)
+func (e *Engine) Build(opts BuildOptions) (string, error) {
+	return e.backend.Build(opts)
 }
 
 func (e *Engine) Prune() error {
@@ -120,3 +132,54 @@ func (e *Engine) Update(id string, opts RunOptions) error {
 func (e *Engine) Exec(id string, cmd []string, interactive bool) error {
 	return e.backend.Exec(id, cmd, interactive)
 }
+
+func (e *Engine) Top(id string, psArgs []string) (*ContainerTop, error) {
+	return e.backend.Top(id, psArgs)
+}
+
+func (e *Engine) CopyToContainer(id, hostPath, containerPath string, copyOwnership bool) error {
+	return e.backend.CopyToContainer(id, hostPath, containerPath, copyOwnership)
+}
+
+func (e *Engine) CopyFromContainer(id, containerPath, hostPath string) error {
+	return e.backend.CopyFromContainer(id, containerPath, hostPath)
+}
+
+func (e *Engine) GetArchive(id, containerPath string, w io.Writer) error {
+	return e.backend.GetArchive(id, containerPath, w)
+}
+
+func (e *Engine) PutArchive(id, containerPath string, r io.Reader, copyOwnership bool) error {
+	return e.backend.PutArchive(id, containerPath, r, copyOwnership)
+}
+
+// RestoreContainers starts the containers with a restart policy that were found dead,
+// e.g. after WSL was restarted. The dashboard calls it from its monitor loop.
+func (e *Engine) RestoreContainers() error {
+	return e.backend.RestoreContainers()
+}
+
+// statsInterval is how far apart the two samples of a one-shot Stats call are taken.
+const statsInterval = time.Second
+
+// Stats samples the resource usage of the running containers. CPU % is computed
+// against prev, an earlier sample; with prev == nil Stats takes two samples itself.
+func (e *Engine) Stats(prev []ContainerStats) ([]ContainerStats, error) {
+	if prev == nil {
+		first, err := e.backend.Stats()
+		if err != nil {
+			return nil, err
+		}
+		prev = first
+		time.Sleep(statsInterval)
+	}
+	stats, err := e.backend.Stats()
+	if err != nil {
+		return nil, err
+	}
+	if stats == nil {
+		stats = []ContainerStats{} // "[]" in JSON, and a valid prev for the next call
+	}
+	computeCPUPercent(stats, prev)
+	return stats, nil
+}
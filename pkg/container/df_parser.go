@@ -2,11 +2,28 @@ package container
 
 import (
 	"bufio"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"regexp"
 	"strings"
 )
 
+// DefaultShell is used for shell-form RUN/CMD/ENTRYPOINT when no SHELL is given.
+var DefaultShell = []string{"/bin/sh", "-c"}
+
+// ParseError reports a Dockerfile syntax error together with its location.
+type ParseError struct {
+	File string
+	Line int
+	Msg  string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Msg)
+}
+
 // ParseDockerfile parses a Dockerfile from the given path
 func ParseDockerfile(path string) (*Dockerfile, error) {
 	file, err := os.Open(path)
@@ -15,107 +32,559 @@ func ParseDockerfile(path string) (*Dockerfile, error) {
 	}
 	defer file.Close()
 
-	df := &Dockerfile{
-		Instructions: make([]Instruction, 0),
+	return ParseDockerfileReader(path, file)
+}
+
+// ParseDockerfileReader parses Dockerfile content. name is only used in error messages.
+func ParseDockerfileReader(name string, r io.Reader) (*Dockerfile, error) {
+	lines, err := readLines(r)
+	if err != nil {
+		return nil, err
 	}
 
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
+	df := &Dockerfile{}
+	p := &dfParser{name: name, lines: lines, escape: '\\'}
+	p.readDirectives()
 
-		// Handle line continuation
-		for strings.HasSuffix(line, "\\") && scanner.Scan() {
-			line = strings.TrimSuffix(line, "\\") + " " + strings.TrimSpace(scanner.Text())
+	for {
+		lineNo, line, ok := p.nextLogicalLine()
+		if !ok {
+			break
 		}
 
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
+		// Dockerfile instructions are case-insensitive by convention
+		keyword, args, _ := strings.Cut(strings.TrimSpace(line), " ")
+		if tab := strings.IndexByte(keyword, '\t'); tab >= 0 {
+			args = keyword[tab+1:] + " " + args
+			keyword = keyword[:tab]
 		}
+		instruction := strings.ToUpper(keyword)
+		args = strings.TrimSpace(args)
 
-		// Dockerfile instructions are case-insensitive by convention
-		parts := strings.Fields(line)
-		if len(parts) == 0 {
+		instr, err := p.parseInstruction(lineNo, instruction, args)
+		if err != nil {
+			return nil, err
+		}
+
+		if instruction == "FROM" {
+			stage := Stage{Base: instr.Args[0], Line: lineNo, Instructions: make([]Instruction, 0)}
+			if len(instr.Args) > 1 {
+				stage.Name = instr.Args[1]
+				if df.StageIndex(stage.Name, len(df.Stages)) >= 0 {
+					return nil, p.errorf(lineNo, "duplicate stage name %q", stage.Name)
+				}
+			}
+			df.Stages = append(df.Stages, stage)
 			continue
 		}
+		if len(df.Stages) == 0 {
+			if instruction != "ARG" {
+				return nil, p.errorf(lineNo, "%s must come after FROM (only ARG may precede the first FROM)", instruction)
+			}
+			df.GlobalArgs = append(df.GlobalArgs, instr)
+			continue
+		}
+		stage := &df.Stages[len(df.Stages)-1]
+		stage.Instructions = append(stage.Instructions, instr)
+	}
 
-		instruction := strings.ToUpper(parts[0])
-		args := line[len(parts[0]):]
-		args = strings.TrimSpace(args)
+	if len(df.Stages) == 0 {
+		return nil, &ParseError{File: name, Line: 1, Msg: "Dockerfile must start with FROM"}
+	}
+	// A stage can only copy from earlier stages
+	for i, stage := range df.Stages {
+		for _, instr := range stage.Instructions {
+			from := instr.Flag("from")
+			if instr.Type != "COPY" || from == "" {
+				continue
+			}
+			if idx := df.StageIndex(from, len(df.Stages)); idx >= i {
+				return nil, p.errorf(instr.Line, "COPY --from=%s refers to the current or a later stage", from)
+			}
+		}
+	}
+
+	return df, nil
+}
+
+// ParseExecForm decodes the JSON exec form (["cmd", "arg"]). ok is false when s is not
+// a JSON array; err is set when s looks like one but is malformed.
+func ParseExecForm(s string) (args []string, ok bool, err error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "[") {
+		return nil, false, nil
+	}
+	if err := json.Unmarshal([]byte(s), &args); err != nil {
+		return nil, false, fmt.Errorf("invalid JSON exec form %s: %v", s, err)
+	}
+	return args, true, nil
+}
 
-		switch instruction {
-		case "FROM":
-			df.Base = args
+// SplitShellWords splits s into words using shell quoting rules: single quotes are
+// literal, double quotes group words, and the escape character escapes the next one.
+// Variable references are left untouched for later expansion.
+func SplitShellWords(s string, escape rune) ([]string, error) {
+	var words []string
+	var cur strings.Builder
+	inWord := false
+	var quote rune
+	runes := []rune(s)
+
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		switch {
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			} else {
+				cur.WriteRune(c)
+			}
+		case quote == '"':
+			if c == '"' {
+				quote = 0
+			} else if c == escape && i+1 < len(runes) && strings.ContainsRune("\"$`\n"+string(escape), runes[i+1]) {
+				i++
+				cur.WriteRune(runes[i])
+			} else {
+				cur.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inWord = true
+		case c == escape:
+			inWord = true
+			if i+1 < len(runes) {
+				i++
+				cur.WriteRune(runes[i])
+			}
+		case c == ' ' || c == '\t' || c == '\n':
+			if inWord {
+				words = append(words, cur.String())
+				cur.Reset()
+				inWord = false
+			}
 		default:
-			// Parse specific args for better structure if needed, but store everything in order
-			parsedArgs := []string{}
-
-			switch instruction {
-			case "ENV":
-				// Handle ENV KEY VALUE and ENV KEY=VALUE
-				if strings.Contains(args, "=") {
-					kv := strings.SplitN(args, "=", 2)
-					parsedArgs = append(parsedArgs, strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1]))
-				} else {
-					kv := strings.Fields(args)
-					if len(kv) >= 2 {
-						parsedArgs = append(parsedArgs, kv[0], strings.Join(kv[1:], " "))
-					}
-				}
-			case "COPY":
-				copyParts := strings.Fields(args)
-				// Filter out flags like --chown
-				nonFlagParts := []string{}
-				for _, p := range copyParts {
-					if !strings.HasPrefix(p, "--") {
-						nonFlagParts = append(nonFlagParts, p)
-					}
-				}
-				if len(nonFlagParts) >= 2 {
-					dest := nonFlagParts[len(nonFlagParts)-1]
-					src := strings.Join(nonFlagParts[:len(nonFlagParts)-1], " ")
-					parsedArgs = append(parsedArgs, src, dest)
-					if os.Getenv("PLX_VERBOSE") != "" {
-						fmt.Printf("[DEBUG] Parsed COPY: src=%q, dest=%q\n", src, dest)
-					}
-				}
-			case "CMD":
-				// Simple shell/exec form detection
-				if strings.HasPrefix(args, "[") && strings.HasSuffix(args, "]") {
-					trimmed := strings.Trim(args, "[]")
-					parts := strings.Split(trimmed, ",")
-					for i, p := range parts {
-						parts[i] = strings.Trim(strings.TrimSpace(p), "\"")
-					}
-					parsedArgs = parts
-				} else {
-					parsedArgs = []string{"sh", "-c", args}
+			cur.WriteRune(c)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inWord {
+		words = append(words, cur.String())
+	}
+	return words, nil
+}
+
+type physicalLine struct {
+	no   int
+	text string
+}
+
+func readLines(r io.Reader) ([]physicalLine, error) {
+	var lines []physicalLine
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		lines = append(lines, physicalLine{no: n, text: strings.TrimRight(scanner.Text(), "\r")})
+	}
+	return lines, scanner.Err()
+}
+
+type dfParser struct {
+	name   string
+	lines  []physicalLine
+	pos    int
+	escape rune
+	shell  []string // set by SHELL; nil means DefaultShell
+
+	// inTrigger is set while an ONBUILD trigger is validated: its heredoc bodies would
+	// have to come from the following lines, which belong to the outer file.
+	inTrigger bool
+}
+
+var directiveRe = regexp.MustCompile(`^#\s*([a-zA-Z][a-zA-Z0-9]*)\s*=\s*(.+?)\s*$`)
+
+// readDirectives consumes parser directives (# escape=`) at the top of the file.
+func (p *dfParser) readDirectives() {
+	for p.pos < len(p.lines) {
+		m := directiveRe.FindStringSubmatch(strings.TrimSpace(p.lines[p.pos].text))
+		if m == nil {
+			return
+		}
+		if strings.EqualFold(m[1], "escape") && (m[2] == "`" || m[2] == "\\") {
+			p.escape = rune(m[2][0])
+		}
+		p.pos++
+	}
+}
+
+// nextLogicalLine joins continuation lines and skips comments and blank lines.
+func (p *dfParser) nextLogicalLine() (int, string, bool) {
+	for p.pos < len(p.lines) {
+		start := p.lines[p.pos]
+		p.pos++
+		trimmed := strings.TrimSpace(start.text)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		line := strings.TrimLeft(start.text, " \t")
+		for p.hasContinuation(line) {
+			line = strings.TrimRight(line, " \t")
+			line = line[:len(line)-len(string(p.escape))]
+			// Comment and empty lines inside a continuation are dropped
+			for p.pos < len(p.lines) {
+				next := strings.TrimSpace(p.lines[p.pos].text)
+				if next != "" && !strings.HasPrefix(next, "#") {
+					break
 				}
-			case "WORKDIR":
-				parsedArgs = []string{args}
-			case "RUN":
-				parsedArgs = []string{args}
-			case "EXPOSE":
-				parsedArgs = strings.Fields(args)
-			default:
-				// Generic fallback
-				parsedArgs = []string{args}
+				p.pos++
+			}
+			if p.pos >= len(p.lines) {
+				break
 			}
+			line += p.lines[p.pos].text
+			p.pos++
+		}
+		return start.no, line, true
+	}
+	return 0, "", false
+}
+
+func (p *dfParser) hasContinuation(line string) bool {
+	return strings.HasSuffix(strings.TrimRight(line, " \t"), string(p.escape))
+}
 
-			df.Instructions = append(df.Instructions, Instruction{
-				Type: instruction,
-				Args: parsedArgs,
-				Raw:  args,
-			})
+var heredocRe = regexp.MustCompile(`<<(-?)(["']?)([A-Za-z_][A-Za-z0-9_]*)(["']?)`)
+
+// readHeredocs collects the bodies of every <<WORD marker on an instruction line.
+func (p *dfParser) readHeredocs(lineNo int, args string) ([]Heredoc, error) {
+	var docs []Heredoc
+	for _, m := range heredocRe.FindAllStringSubmatch(stripQuoted(args), -1) {
+		if m[2] != m[4] {
+			continue
+		}
+		if p.inTrigger {
+			return nil, p.errorf(lineNo, "heredocs are not supported in ONBUILD triggers")
+		}
+		doc := Heredoc{Name: m[3], StripTabs: m[1] == "-"}
+		var body []string
+		found := false
+		for p.pos < len(p.lines) {
+			text := p.lines[p.pos].text
+			p.pos++
+			if doc.StripTabs {
+				text = strings.TrimLeft(text, "\t")
+			}
+			if text == doc.Name {
+				found = true
+				break
+			}
+			body = append(body, text)
+		}
+		if !found {
+			return nil, &ParseError{File: p.name, Line: lineNo, Msg: fmt.Sprintf("unterminated heredoc <<%s", doc.Name)}
 		}
+		doc.Body = strings.Join(body, "\n") + "\n"
+		docs = append(docs, doc)
 	}
+	return docs, nil
+}
 
-	if err := scanner.Err(); err != nil {
+// stripQuoted blanks out quoted sections so heredoc markers inside strings are ignored.
+func stripQuoted(s string) string {
+	out := []rune(s)
+	var quote rune
+	for i, c := range out {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+			out[i] = ' '
+		case c == '\'' || c == '"':
+			quote = c
+			out[i] = ' '
+		}
+	}
+	return string(out)
+}
+
+func (p *dfParser) currentShell() []string {
+	if p.shell == nil {
+		return append([]string{}, DefaultShell...)
+	}
+	return append([]string{}, p.shell...)
+}
+
+// ParseOnBuildTriggers parses ONBUILD triggers stored in a base image's metadata.
+func ParseOnBuildTriggers(image string, triggers []string) ([]Instruction, error) {
+	if len(triggers) == 0 {
+		return nil, nil
+	}
+	src := "FROM " + image + "\n" + strings.Join(triggers, "\n") + "\n"
+	df, err := ParseDockerfileReader(image+" (ONBUILD)", strings.NewReader(src))
+	if err != nil {
 		return nil, err
 	}
+	return df.Final().Instructions, nil
+}
+
+func (p *dfParser) errorf(line int, format string, a ...any) error {
+	return &ParseError{File: p.name, Line: line, Msg: fmt.Sprintf(format, a...)}
+}
+
+func (p *dfParser) parseInstruction(lineNo int, instruction, args string) (Instruction, error) {
+	instr := Instruction{Type: instruction, Line: lineNo}
 
-	if df.Base == "" {
-		return nil, fmt.Errorf("Dockerfile must start with FROM")
+	// Leading --flags (COPY --chown, RUN --mount, FROM --platform, ...)
+	switch instruction {
+	case "FROM", "RUN", "COPY", "ADD", "HEALTHCHECK":
+		flags, rest := parseInstructionFlags(args)
+		instr.Flags = flags
+		args = rest
 	}
+	instr.Raw = args
 
-	return df, nil
+	switch instruction {
+	case "FROM":
+		words := strings.Fields(args)
+		switch {
+		case len(words) == 0:
+			return instr, p.errorf(lineNo, "FROM requires an image name")
+		case len(words) == 1:
+			instr.Args = []string{words[0]}
+		case len(words) == 3 && strings.EqualFold(words[1], "AS") && validStageName.MatchString(words[2]):
+			instr.Args = []string{words[0], strings.ToLower(words[2])}
+		default:
+			return instr, p.errorf(lineNo, "FROM expects an image and an optional 'AS <name>'")
+		}
+		p.shell = nil
+
+	case "RUN":
+		if _, err := ParseRunMounts(instr); err != nil {
+			return instr, p.errorf(lineNo, "RUN %v", err)
+		}
+		if argv, ok, _ := ParseExecForm(args); ok {
+			instr.Args = argv
+			instr.JSONForm = true
+			break
+		}
+		instr.Shell = p.currentShell()
+		docs, err := p.readHeredocs(lineNo, args)
+		if err != nil {
+			return instr, err
+		}
+		instr.Heredocs = docs
+		script := args
+		if len(docs) > 0 {
+			if strings.TrimSpace(heredocRe.ReplaceAllString(args, "")) == "" && len(docs) == 1 {
+				// RUN <<EOF ... EOF runs the heredoc itself as the script
+				script = docs[0].Body
+			} else {
+				// The shell handles heredoc redirections natively, so hand it the whole text
+				script = args + "\n"
+				for _, d := range docs {
+					script += d.Body + d.Name + "\n"
+				}
+			}
+		}
+		instr.Args = []string{script}
+
+	case "CMD", "ENTRYPOINT":
+		if argv, ok, _ := ParseExecForm(args); ok {
+			instr.Args = argv
+			instr.JSONForm = true
+		} else {
+			instr.Args = append(p.currentShell(), args)
+		}
+
+	case "HEALTHCHECK":
+		// Args follow Docker's Test format: ["NONE"], ["CMD", argv...] or ["CMD-SHELL", cmd]
+		keyword, rest, _ := strings.Cut(args, " ")
+		switch strings.ToUpper(keyword) {
+		case "NONE":
+			instr.Args = []string{"NONE"}
+		case "CMD":
+			rest = strings.TrimSpace(rest)
+			if rest == "" {
+				return instr, p.errorf(lineNo, "HEALTHCHECK CMD requires a command")
+			}
+			if argv, ok, _ := ParseExecForm(rest); ok {
+				instr.Args = append([]string{"CMD"}, argv...)
+				instr.JSONForm = true
+			} else {
+				instr.Args = []string{"CMD-SHELL", rest}
+			}
+		default:
+			return instr, p.errorf(lineNo, "HEALTHCHECK must be followed by CMD or NONE")
+		}
+		if _, err := HealthConfigFromInstruction(instr); err != nil {
+			return instr, p.errorf(lineNo, "%v", err)
+		}
+
+	case "SHELL":
+		argv, ok, err := ParseExecForm(args)
+		if err != nil {
+			return instr, p.errorf(lineNo, "%v", err)
+		}
+		if !ok || len(argv) == 0 {
+			return instr, p.errorf(lineNo, "SHELL requires the arguments to be in JSON form")
+		}
+		instr.Args = argv
+		instr.JSONForm = true
+		p.shell = argv
+
+	case "ONBUILD":
+		keyword, rest, _ := strings.Cut(args, " ")
+		switch trigger := strings.ToUpper(keyword); trigger {
+		case "":
+			return instr, p.errorf(lineNo, "ONBUILD requires an instruction")
+		case "ONBUILD", "FROM", "MAINTAINER":
+			return instr, p.errorf(lineNo, "%s isn't allowed as an ONBUILD trigger", trigger)
+		default:
+			// Validate the trigger now so that errors point at this line, not at the child
+			// build. It is kept as written: the child build parses it again.
+			saved := p.shell
+			p.inTrigger = true
+			_, err := p.parseInstruction(lineNo, trigger, strings.TrimSpace(rest))
+			p.shell, p.inTrigger = saved, false
+			if err != nil {
+				return instr, err
+			}
+		}
+		instr.Args = []string{args}
+
+	case "ENV", "LABEL":
+		pairs, err := p.parseKeyValues(lineNo, instruction, args)
+		if err != nil {
+			return instr, err
+		}
+		instr.Args = pairs
+
+	case "COPY", "ADD":
+		words, ok, err := ParseExecForm(args)
+		if err != nil {
+			return instr, p.errorf(lineNo, "%v", err)
+		}
+		if !ok {
+			if words, err = SplitShellWords(args, p.escape); err != nil {
+				return instr, p.errorf(lineNo, "%s: %v", instruction, err)
+			}
+		}
+		if len(words) < 2 {
+			return instr, p.errorf(lineNo, "%s requires at least one source and a destination", instruction)
+		}
+		instr.Args = words
+		if os.Getenv("PLX_VERBOSE") != "" {
+			fmt.Fprintf(os.Stderr, "[DEBUG] Parsed %s: src=%q, dest=%q, flags=%v\n", instruction, instr.Sources(), instr.Dest(), instr.Flags)
+		}
+
+	case "EXPOSE", "VOLUME":
+		words, ok, err := ParseExecForm(args)
+		if err != nil {
+			return instr, p.errorf(lineNo, "%v", err)
+		}
+		if !ok {
+			if words, err = SplitShellWords(args, p.escape); err != nil {
+				return instr, p.errorf(lineNo, "%s: %v", instruction, err)
+			}
+		}
+		instr.Args = words
+
+	case "ARG":
+		// ARG name[=default] ...
+		words, err := SplitShellWords(args, p.escape)
+		if err != nil {
+			return instr, p.errorf(lineNo, "ARG: %v", err)
+		}
+		if len(words) == 0 {
+			return instr, p.errorf(lineNo, "ARG requires at least one argument")
+		}
+		for _, w := range words {
+			if name, _, _ := strings.Cut(w, "="); name == "" {
+				return instr, p.errorf(lineNo, "ARG: invalid argument %q", w)
+			}
+		}
+		instr.Args = words
+
+	case "WORKDIR", "USER", "STOPSIGNAL":
+		words, err := SplitShellWords(args, p.escape)
+		if err != nil {
+			return instr, p.errorf(lineNo, "%s: %v", instruction, err)
+		}
+		if len(words) == 0 {
+			return instr, p.errorf(lineNo, "%s requires exactly one argument", instruction)
+		}
+		instr.Args = []string{strings.Join(words, " ")}
+		if instruction == "STOPSIGNAL" {
+			if _, err := ParseSignal(instr.Args[0]); err != nil {
+				return instr, p.errorf(lineNo, "STOPSIGNAL: %v", err)
+			}
+		}
+
+	default:
+		// Generic fallback
+		instr.Args = []string{args}
+	}
+
+	return instr, nil
+}
+
+// parseKeyValues handles both "KEY=VALUE KEY2=VALUE2" and the legacy "KEY VALUE" form.
+func (p *dfParser) parseKeyValues(lineNo int, instruction, args string) ([]string, error) {
+	words, err := SplitShellWords(args, p.escape)
+	if err != nil {
+		return nil, p.errorf(lineNo, "%s: %v", instruction, err)
+	}
+	if len(words) == 0 {
+		return nil, p.errorf(lineNo, "%s requires at least one argument", instruction)
+	}
+
+	if !strings.Contains(words[0], "=") {
+		// Legacy form: the rest of the line is the value
+		if len(words) < 2 {
+			return nil, p.errorf(lineNo, "%s %s is missing a value", instruction, words[0])
+		}
+		return []string{words[0], strings.Join(words[1:], " ")}, nil
+	}
+
+	var pairs []string
+	for _, w := range words {
+		k, v, found := strings.Cut(w, "=")
+		if !found {
+			return nil, p.errorf(lineNo, "%s: can't find = in %q (must be of the form name=value)", instruction, w)
+		}
+		if k == "" {
+			return nil, p.errorf(lineNo, "%s names can not be blank", instruction)
+		}
+		pairs = append(pairs, k, v)
+	}
+	return pairs, nil
+}
+
+// parseInstructionFlags splits leading "--name=value" options from the remaining text.
+// A bare "--name" is recorded with the value "true".
+func parseInstructionFlags(args string) (map[string][]string, string) {
+	var flags map[string][]string
+	rest := strings.TrimSpace(args)
+	for strings.HasPrefix(rest, "--") {
+		word, remainder, _ := strings.Cut(rest, " ")
+		if word == "--" {
+			break
+		}
+		if flags == nil {
+			flags = make(map[string][]string)
+		}
+		name, value, found := strings.Cut(strings.TrimPrefix(word, "--"), "=")
+		if !found {
+			value = "true"
+		}
+		name = strings.ToLower(name)
+		flags[name] = append(flags[name], value)
+		rest = strings.TrimSpace(remainder)
+	}
+	return flags, rest
 }
@@ -0,0 +1,200 @@
+package container
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func parseString(t *testing.T, src string) *Dockerfile {
+	t.Helper()
+	df, err := ParseDockerfileReader("Dockerfile", strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("parse failed: %v\n%s", err, src)
+	}
+	return df
+}
+
+func TestSplitShellWords(t *testing.T) {
+	tests := []struct {
+		in     string
+		escape rune
+		want   []string
+	}{
+		{`a b  c`, '\\', []string{"a", "b", "c"}},
+		{`"a b" c`, '\\', []string{"a b", "c"}},
+		{`'a "b"' c`, '\\', []string{`a "b"`, "c"}},
+		{`a\ b`, '\\', []string{"a b"}},
+		{`"a \"b\" \$HOME"`, '\\', []string{`a "b" $HOME`}},
+		{`"a \n"`, '\\', []string{`a \n`}},
+		{`$HOME ${X}`, '\\', []string{"$HOME", "${X}"}},
+		{"a`` b", '`', []string{"a`", "b"}},
+		{`C:\dir`, '`', []string{`C:\dir`}},
+		{`""`, '\\', []string{""}},
+		{``, '\\', nil},
+	}
+	for _, tt := range tests {
+		got, err := SplitShellWords(tt.in, tt.escape)
+		if err != nil {
+			t.Errorf("SplitShellWords(%q) error: %v", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SplitShellWords(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+	for _, in := range []string{`"open`, `'open`} {
+		if _, err := SplitShellWords(in, '\\'); err == nil {
+			t.Errorf("SplitShellWords(%q) should fail", in)
+		}
+	}
+}
+
+func TestParseExecForm(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []string
+		ok, err bool
+	}{
+		{`["echo", "hi"]`, []string{"echo", "hi"}, true, false},
+		{`  ["a"]  `, []string{"a"}, true, false},
+		{`echo hi`, nil, false, false},
+		{`["unterminated"`, nil, false, true},
+	}
+	for _, tt := range tests {
+		got, ok, err := ParseExecForm(tt.in)
+		if ok != tt.ok || (err != nil) != tt.err || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseExecForm(%q) = %q, %v, %v", tt.in, got, ok, err)
+		}
+	}
+}
+
+func TestParseInstructions(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want Instruction // compared: Type, Args, JSONForm
+	}{
+		{"exec form", "FROM a\nCMD [\"sh\", \"-c\", \"echo\"]\n",
+			Instruction{Type: "CMD", Args: []string{"sh", "-c", "echo"}, JSONForm: true}},
+		{"shell form", "FROM a\nCMD echo hi\n",
+			Instruction{Type: "CMD", Args: []string{"/bin/sh", "-c", "echo hi"}}},
+		{"lower case keyword", "from a\nrun echo hi\n",
+			Instruction{Type: "RUN", Args: []string{"echo hi"}}},
+		{"continuation", "FROM a\nRUN echo a \\\n  && echo b\n",
+			Instruction{Type: "RUN", Args: []string{"echo a   && echo b"}}},
+		{"comment inside continuation", "FROM a\nRUN echo a \\\n# note\n\n  b\n",
+			Instruction{Type: "RUN", Args: []string{"echo a   b"}}},
+		{"escape directive", "# escape=`\nFROM a\nRUN echo a `\n  b\n",
+			Instruction{Type: "RUN", Args: []string{"echo a   b"}}},
+		{"multi-pair ENV", "FROM a\nENV A=1 B=\"two words\" C=\n",
+			Instruction{Type: "ENV", Args: []string{"A", "1", "B", "two words", "C", ""}}},
+		{"legacy ENV", "FROM a\nENV A one two\n",
+			Instruction{Type: "ENV", Args: []string{"A", "one two"}}},
+		{"COPY quoted", "FROM a\nCOPY --chown=1:1 \"a b\" /dst/\n",
+			Instruction{Type: "COPY", Args: []string{"a b", "/dst/"}}},
+		{"SHELL applies", "FROM a\nSHELL [\"/bin/bash\", \"-c\"]\nCMD echo\n",
+			Instruction{Type: "CMD", Args: []string{"/bin/bash", "-c", "echo"}}},
+		{"heredoc script", "FROM a\nRUN <<EOF\necho 1\necho 2\nEOF\n",
+			Instruction{Type: "RUN", Args: []string{"echo 1\necho 2\n"}}},
+		{"heredoc redirection", "FROM a\nRUN cat > /f <<-EOT\n\thello\n\tEOT\n",
+			Instruction{Type: "RUN", Args: []string{"cat > /f <<-EOT\nhello\nEOT\n"}}},
+		{"quoted heredoc marker ignored", "FROM a\nRUN echo '<<EOF'\n",
+			Instruction{Type: "RUN", Args: []string{"echo '<<EOF'"}}},
+		{"ONBUILD keeps trigger text", "FROM a\nONBUILD RUN --mount=type=cache,target=/c make\n",
+			Instruction{Type: "ONBUILD", Args: []string{"RUN --mount=type=cache,target=/c make"}}},
+	}
+	for _, tt := range tests {
+		df := parseString(t, tt.src)
+		instrs := df.Final().Instructions
+		got := instrs[len(instrs)-1]
+		if got.Type != tt.want.Type || got.JSONForm != tt.want.JSONForm || !reflect.DeepEqual(got.Args, tt.want.Args) {
+			t.Errorf("%s: got %s %q (json %v), want %s %q (json %v)", tt.name,
+				got.Type, got.Args, got.JSONForm, tt.want.Type, tt.want.Args, tt.want.JSONForm)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		line int
+	}{
+		{"no FROM", "RUN echo\n", 1},
+		{"instruction before FROM", "ARG V=1\nRUN echo\nFROM a\n", 2},
+		{"unterminated heredoc", "FROM a\nRUN <<EOF\necho\n", 2},
+		{"bad SHELL", "FROM a\nSHELL /bin/bash\n", 2},
+		{"ONBUILD FROM", "FROM a\nONBUILD FROM b\n", 2},
+		{"ONBUILD invalid trigger", "FROM a\nONBUILD COPY onlyone\n", 2},
+		{"ONBUILD heredoc", "FROM a\nONBUILD RUN <<EOF\necho hi\nEOF\n", 2},
+		{"COPY from later stage", "FROM a AS one\nCOPY --from=two /x /x\nFROM b AS two\n", 2},
+		{"duplicate stage", "FROM a AS x\nFROM b AS x\n", 2},
+	}
+	for _, tt := range tests {
+		_, err := ParseDockerfileReader("Dockerfile", strings.NewReader(tt.src))
+		var perr *ParseError
+		if !errors.As(err, &perr) {
+			t.Errorf("%s: expected a ParseError, got %v", tt.name, err)
+			continue
+		}
+		if perr.Line != tt.line {
+			t.Errorf("%s: error on line %d, want %d (%v)", tt.name, perr.Line, tt.line, err)
+		}
+	}
+}
+
+func TestParseOnBuildTriggers(t *testing.T) {
+	instrs, err := ParseOnBuildTriggers("base", []string{"ENV A=1", "COPY . /app"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(instrs) != 2 || instrs[0].Type != "ENV" || instrs[1].Type != "COPY" {
+		t.Fatalf("unexpected triggers: %+v", instrs)
+	}
+}
+
+func TestGlobalArgs(t *testing.T) {
+	src := "ARG BASE=alpine\nARG VERSION=1\nARG UNSET\n" +
+		"FROM ${BASE}:3 AS build\nARG VERSION\nARG OTHER=x\nRUN echo\n" +
+		"FROM $BASE\nARG VERSION=2\nARG UNSET\n"
+	tests := []struct {
+		name      string
+		buildArgs map[string]string
+		bases     []string
+		stage0    []string
+		stage1    []string
+	}{
+		{"defaults", nil,
+			[]string{"alpine:3", "alpine"}, []string{"VERSION=1", "OTHER=x"}, []string{"VERSION=2", "UNSET"}},
+		{"build args", map[string]string{"BASE": "debian", "VERSION": "9"},
+			[]string{"debian:3", "debian"}, []string{"VERSION=9", "OTHER=x"}, []string{"VERSION=2", "UNSET"}},
+	}
+	for _, tt := range tests {
+		df := parseString(t, src)
+		if len(df.GlobalArgs) != 3 || len(df.Stages[0].Instructions) != 3 {
+			t.Fatalf("%s: global ARGs were not kept apart: %d global, %d in stage 0", tt.name, len(df.GlobalArgs), len(df.Stages[0].Instructions))
+		}
+		df.ApplyGlobalArgs(tt.buildArgs)
+		if got := []string{df.Stages[0].Base, df.Stages[1].Base}; !reflect.DeepEqual(got, tt.bases) {
+			t.Errorf("%s: bases = %q, want %q", tt.name, got, tt.bases)
+		}
+		var stage0 []string
+		for _, instr := range df.Stages[0].Instructions[:2] {
+			for k, v := range ResolveBuildArgs(instr, tt.buildArgs) {
+				stage0 = append(stage0, k+"="+v)
+			}
+		}
+		if !reflect.DeepEqual(stage0, tt.stage0) {
+			t.Errorf("%s: stage 0 args = %q, want %q", tt.name, stage0, tt.stage0)
+		}
+		var stage1 []string
+		for _, instr := range df.Stages[1].Instructions {
+			stage1 = append(stage1, instr.Args...)
+		}
+		if !reflect.DeepEqual(stage1, tt.stage1) {
+			t.Errorf("%s: stage 1 declarations = %q, want %q", tt.name, stage1, tt.stage1)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package container
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Docker's defaults for HEALTHCHECK options that are not given
+const (
+	DefaultHealthInterval = 30 * time.Second
+	DefaultHealthTimeout  = 30 * time.Second
+	DefaultHealthRetries  = 3
+)
+
+// HealthConfigFromInstruction converts a parsed HEALTHCHECK instruction into a HealthConfig.
+func HealthConfigFromInstruction(instr Instruction) (*HealthConfig, error) {
+	hc := &HealthConfig{Test: instr.Args}
+	var err error
+	if v := instr.Flag("interval"); v != "" {
+		if hc.Interval, err = parseHealthDuration("interval", v); err != nil {
+			return nil, err
+		}
+	}
+	if v := instr.Flag("timeout"); v != "" {
+		if hc.Timeout, err = parseHealthDuration("timeout", v); err != nil {
+			return nil, err
+		}
+	}
+	if v := instr.Flag("start-period"); v != "" {
+		if hc.StartPeriod, err = parseHealthDuration("start-period", v); err != nil {
+			return nil, err
+		}
+	}
+	if v := instr.Flag("retries"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("HEALTHCHECK --retries must be a positive integer, got %q", v)
+		}
+		hc.Retries = n
+	}
+	return hc, nil
+}
+
+func parseHealthDuration(name, v string) (time.Duration, error) {
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("HEALTHCHECK --%s: invalid duration %q", name, v)
+	}
+	return d, nil
+}
+
+// MergeHealthConfig applies `plx run --health-*` overrides on top of the image's HEALTHCHECK.
+// Unset override fields keep the image's values.
+func MergeHealthConfig(image, override *HealthConfig) *HealthConfig {
+	if override == nil {
+		return image
+	}
+	merged := HealthConfig{}
+	if image != nil {
+		merged = *image
+	}
+	if len(override.Test) > 0 {
+		merged.Test = override.Test
+	}
+	if override.Interval > 0 {
+		merged.Interval = override.Interval
+	}
+	if override.Timeout > 0 {
+		merged.Timeout = override.Timeout
+	}
+	if override.StartPeriod > 0 {
+		merged.StartPeriod = override.StartPeriod
+	}
+	if override.Retries > 0 {
+		merged.Retries = override.Retries
+	}
+	return &merged
+}
+
+// Enabled reports whether the config describes an actual probe.
+func (hc *HealthConfig) Enabled() bool {
+	return hc != nil && len(hc.Test) > 0 && hc.Test[0] != "NONE"
+}
+
+// ShellCommand returns the probe as a single /bin/sh -c string.
+func (hc *HealthConfig) ShellCommand() string {
+	if !hc.Enabled() {
+		return ""
+	}
+	if hc.Test[0] == "CMD-SHELL" {
+		return strings.Join(hc.Test[1:], " ")
+	}
+	quoted := make([]string, 0, len(hc.Test)-1)
+	for _, a := range hc.Test[1:] {
+		quoted = append(quoted, shellQuote(a))
+	}
+	return strings.Join(quoted, " ")
+}
+
+// seconds returns the probe timings in whole seconds (rounded up), with defaults applied.
+func (hc *HealthConfig) seconds() (interval, timeout, startPeriod int) {
+	ceil := func(d, def time.Duration) int {
+		if d <= 0 {
+			d = def
+		}
+		return int((d + time.Second - 1) / time.Second)
+	}
+	return ceil(hc.Interval, DefaultHealthInterval), ceil(hc.Timeout, DefaultHealthTimeout), int(hc.StartPeriod / time.Second)
+}
+
+func (hc *HealthConfig) retries() int {
+	if hc.Retries > 0 {
+		return hc.Retries
+	}
+	return DefaultHealthRetries
+}
@@ -0,0 +1,173 @@
+package container
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// IgnoreMatcher implements the .dockerignore pattern language (`*`, `?`, `**`, `!`).
+// Paths are matched relative to the build context root using forward slashes.
+type IgnoreMatcher struct {
+	patterns      []ignorePattern
+	hasExceptions bool
+}
+
+type ignorePattern struct {
+	re        *regexp.Regexp
+	exclusion bool // "!pattern" re-includes matching paths
+}
+
+// LoadIgnoreMatcher reads .plxignore (or .dockerignore when absent) from the context root.
+// .git is always ignored.
+func LoadIgnoreMatcher(ctxDir string) (*IgnoreMatcher, error) {
+	lines := []string{".git"}
+	for _, name := range []string{".plxignore", ".dockerignore"} {
+		f, err := os.Open(filepath.Join(ctxDir, name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+		f.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		break
+	}
+	return NewIgnoreMatcher(lines)
+}
+
+// NewIgnoreMatcher compiles ignore patterns. Blank lines and # comments are skipped.
+func NewIgnoreMatcher(lines []string) (*IgnoreMatcher, error) {
+	m := &IgnoreMatcher{}
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p := ignorePattern{}
+		if strings.HasPrefix(line, "!") {
+			p.exclusion = true
+			m.hasExceptions = true
+			line = strings.TrimSpace(line[1:])
+		}
+		line = strings.TrimPrefix(path.Clean(filepath.ToSlash(line)), "/")
+		re, err := compileIgnorePattern(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ignore pattern %q: %w", line, err)
+		}
+		p.re = re
+		m.patterns = append(m.patterns, p)
+	}
+	return m, nil
+}
+
+func compileIgnorePattern(pattern string) (*regexp.Regexp, error) {
+	var sb strings.Builder
+	sb.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				i++
+				if i+1 < len(pattern) && pattern[i+1] == '/' {
+					// "**/" matches zero or more directories
+					i++
+					sb.WriteString("(.*/)?")
+				} else {
+					sb.WriteString(".*")
+				}
+			} else {
+				sb.WriteString("[^/]*")
+			}
+		case '?':
+			sb.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(pattern[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated character class")
+			}
+			class := pattern[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + class + "]")
+			i += end
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+				sb.WriteString(regexp.QuoteMeta(string(pattern[i])))
+			}
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	sb.WriteString("$")
+	return regexp.Compile(sb.String())
+}
+
+// Matches reports whether rel (relative to the context root) is ignored.
+// A pattern that matches a parent directory also matches everything below it,
+// and the last matching pattern wins.
+func (m *IgnoreMatcher) Matches(rel string) bool {
+	if m == nil {
+		return false
+	}
+	rel = strings.TrimPrefix(path.Clean(filepath.ToSlash(rel)), "/")
+	if rel == "." || rel == ".." || strings.HasPrefix(rel, "../") {
+		return false
+	}
+
+	parts := strings.Split(rel, "/")
+	ignored := false
+	for _, p := range m.patterns {
+		for n := 1; n <= len(parts); n++ {
+			if p.re.MatchString(strings.Join(parts[:n], "/")) {
+				ignored = !p.exclusion
+				break
+			}
+		}
+	}
+	return ignored
+}
+
+// ListContextFiles walks src (inside ctxDir) and returns the paths, relative to src,
+// that are not ignored. Directories are listed too so that empty ones are preserved.
+func ListContextFiles(ctxDir, src string, m *IgnoreMatcher) ([]string, error) {
+	var entries []string
+	err := filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		relSrc, _ := filepath.Rel(src, p)
+		if relSrc == "." {
+			return nil
+		}
+		relCtx, err := filepath.Rel(ctxDir, p)
+		if err != nil {
+			return err
+		}
+		if m.Matches(relCtx) {
+			// With "!" exceptions, something below an ignored directory may come back
+			if d.IsDir() && !m.hasExceptions {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		entries = append(entries, filepath.ToSlash(relSrc))
+		return nil
+	})
+	return entries, err
+}
@@ -0,0 +1,142 @@
+package container
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestIgnoreMatcher(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		path     string
+		want     bool
+	}{
+		{"plain name", []string{"secret.txt"}, "secret.txt", true},
+		{"star stays in its directory", []string{"*.log"}, "dir/a.log", false},
+		{"star at the root", []string{"*.log"}, "a.log", true},
+		{"double star any depth", []string{"**/*.log"}, "a/b/c.log", true},
+		{"double star zero directories", []string{"**/*.log"}, "c.log", true},
+		{"double star in the middle", []string{"a/**/c"}, "a/x/y/c", true},
+		{"question mark", []string{"file?.txt"}, "file1.txt", true},
+		{"question mark is one character", []string{"file?.txt"}, "file10.txt", false},
+		{"question mark does not match a slash", []string{"a?b"}, "a/b", false},
+		{"character class", []string{"[ab].txt"}, "b.txt", true},
+		{"negated character class", []string{"[!ab].txt"}, "a.txt", false},
+		{"negated character class matches", []string{"[!ab].txt"}, "c.txt", true},
+		{"escaped star", []string{`\*.txt`}, "*.txt", true},
+		{"escaped star is literal", []string{`\*.txt`}, "a.txt", false},
+		{"directory covers its contents", []string{"build"}, "build/out/app", true},
+		{"prefix is not a parent", []string{"build"}, "builder/app", false},
+		{"leading slash", []string{"/tmp"}, "tmp/x", true},
+		{"trailing slash", []string{"node_modules/"}, "node_modules/pkg/index.js", true},
+		{"dot segments are cleaned", []string{"./a/../b"}, "b", true},
+		{"exception", []string{"*.md", "!README.md"}, "README.md", false},
+		{"exception only for its path", []string{"*.md", "!README.md"}, "CHANGES.md", true},
+		{"last match wins", []string{"!keep", "keep"}, "keep", true},
+		{"exception inside an ignored directory", []string{"docs", "!docs/api"}, "docs/api/index.html", false},
+		{"comment", []string{"# secret.txt"}, "secret.txt", false},
+		{"blank lines", []string{"", "  "}, "a", false},
+		{"everything", []string{"**"}, "a/b", true},
+		{"context root is never ignored", []string{"*"}, ".", false},
+		{"outside the context", []string{"*"}, "../x", false},
+		{"backslash separators", []string{"dir/*.tmp"}, filepath.Join("dir", "a.tmp"), true},
+	}
+	for _, tt := range tests {
+		m, err := NewIgnoreMatcher(tt.patterns)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := m.Matches(tt.path); got != tt.want {
+			t.Errorf("%s: %q matching %q = %v, want %v", tt.name, tt.patterns, tt.path, got, tt.want)
+		}
+	}
+
+	if _, err := NewIgnoreMatcher([]string{"[abc"}); err == nil {
+		t.Error("an unterminated character class should be an error")
+	}
+	var nilMatcher *IgnoreMatcher
+	if nilMatcher.Matches("a") {
+		t.Error("a nil matcher should not ignore anything")
+	}
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLoadIgnoreMatcher(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		path  string
+		want  bool
+	}{
+		{".git is always ignored", nil, ".git/config", true},
+		{".dockerignore", map[string]string{".dockerignore": "*.log\n"}, "a.log", true},
+		{".plxignore wins over .dockerignore", map[string]string{".plxignore": "*.tmp\n", ".dockerignore": "*.log\n"}, "a.log", false},
+		{".plxignore is used", map[string]string{".plxignore": "*.tmp\n", ".dockerignore": "*.log\n"}, "a.tmp", true},
+		{"CRLF line endings", map[string]string{".dockerignore": "*.log\r\nbuild\r\n"}, "build/x", true},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		writeFiles(t, dir, tt.files)
+		m, err := LoadIgnoreMatcher(dir)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := m.Matches(tt.path); got != tt.want {
+			t.Errorf("%s: Matches(%q) = %v, want %v", tt.name, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestListContextFiles(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		want     []string
+	}{
+		{"nothing ignored", nil,
+			[]string{"app", "app/main.go", "app/main_test.go", "docs", "docs/api", "docs/api/index.html", "docs/guide.md"}},
+		{"ignored directory is skipped", []string{"docs"},
+			[]string{"app", "app/main.go", "app/main_test.go"}},
+		{"files by pattern", []string{"**/*_test.go", "**/*.md"},
+			[]string{"app", "app/main.go", "docs", "docs/api", "docs/api/index.html"}},
+		{"exception below an ignored directory", []string{"docs", "!docs/api"},
+			[]string{"app", "app/main.go", "app/main_test.go", "docs/api", "docs/api/index.html"}},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		writeFiles(t, dir, map[string]string{
+			"app/main.go":         "",
+			"app/main_test.go":    "",
+			"docs/guide.md":       "",
+			"docs/api/index.html": "",
+		})
+		m, err := NewIgnoreMatcher(tt.patterns)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ListContextFiles(dir, dir, m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
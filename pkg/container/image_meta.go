@@ -0,0 +1,154 @@
+package container
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// ApplyInstruction records LABEL, EXPOSE, VOLUME, STOPSIGNAL, HEALTHCHECK and ONBUILD
+// declarations in the image metadata. It returns warnings about what it skipped, for
+// the build output.
+func (m *ImageMetadata) ApplyInstruction(instr Instruction) (warnings []string) {
+	switch instr.Type {
+	case "LABEL":
+		if m.Labels == nil {
+			m.Labels = make(map[string]string)
+		}
+		for i := 0; i+1 < len(instr.Args); i += 2 {
+			m.Labels[instr.Args[i]] = instr.Args[i+1]
+		}
+	case "EXPOSE":
+		for _, spec := range instr.Args {
+			port, proto, err := ParseExposedPort(spec)
+			if err != nil {
+				warnings = append(warnings, fmt.Sprintf("ignoring EXPOSE %s: %v", spec, err))
+				continue
+			}
+			m.ExposedPorts = appendUnique(m.ExposedPorts, fmt.Sprintf("%d/%s", port, proto))
+		}
+	case "VOLUME":
+		for _, v := range instr.Args {
+			m.Volumes = appendUnique(m.Volumes, path.Clean("/"+v))
+		}
+	case "ONBUILD":
+		m.OnBuild = append(m.OnBuild, instr.Args...)
+	case "STOPSIGNAL":
+		if len(instr.Args) > 0 {
+			m.StopSignal = instr.Args[0]
+		}
+	case "HEALTHCHECK":
+		// The parser has already validated the options
+		if hc, err := HealthConfigFromInstruction(instr); err == nil {
+			m.Healthcheck = hc
+		}
+	}
+	return warnings
+}
+
+// HasLabel reports whether the image carries the label filter "key" or "key=value".
+func (m *ImageMetadata) HasLabel(filter string) bool {
+	key, value, withValue := strings.Cut(filter, "=")
+	v, ok := m.Labels[key]
+	if !ok {
+		return false
+	}
+	return !withValue || v == value
+}
+
+// ParseExposedPort parses "80", "80/tcp" or "53/udp".
+func ParseExposedPort(spec string) (int, string, error) {
+	portStr, proto, found := strings.Cut(spec, "/")
+	if !found {
+		proto = "tcp"
+	}
+	proto = strings.ToLower(proto)
+	if proto != "tcp" && proto != "udp" {
+		return 0, "", fmt.Errorf("invalid protocol %q", proto)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 1 || port > 65535 {
+		return 0, "", fmt.Errorf("invalid port %q", portStr)
+	}
+	return port, proto, nil
+}
+
+// PublishExposedPorts maps every exposed port that is not published yet to a free host port (plx run -P).
+func PublishExposedPorts(ports []PortMapping, exposed []string) []PortMapping {
+	published := make(map[int]bool)
+	for _, p := range ports {
+		published[p.Container] = true
+	}
+	for _, spec := range exposed {
+		port, _, err := ParseExposedPort(spec)
+		if err != nil || published[port] {
+			continue
+		}
+		hostPort, err := freeHostPort()
+		if err != nil {
+			fmt.Printf("Warning: no free host port for %d: %v\n", port, err)
+			continue
+		}
+		ports = append(ports, PortMapping{Host: hostPort, Container: port})
+		published[port] = true
+		fmt.Printf("Publishing container port %d on host port %d\n", port, hostPort)
+	}
+	return ports
+}
+
+// AnonymousVolumeMounts returns managed volume mounts for declared VOLUME paths
+// that are not already covered by an explicit mount.
+func AnonymousVolumeMounts(mounts []Mount, volumes []string) []Mount {
+	var added []Mount
+	for _, target := range volumes {
+		covered := false
+		for _, m := range mounts {
+			if path.Clean(m.Target) == target {
+				covered = true
+				break
+			}
+		}
+		if covered {
+			continue
+		}
+		buf := make([]byte, 16)
+		if _, err := rand.Read(buf); err != nil {
+			continue
+		}
+		added = append(added, Mount{Source: hex.EncodeToString(buf), Target: target})
+	}
+	return added
+}
+
+func freeHostPort() (int, error) {
+	l, err := net.Listen("tcp", ":0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+func appendUnique(list []string, v string) []string {
+	for _, existing := range list {
+		if existing == v {
+			return list
+		}
+	}
+	return append(list, v)
+}
+
+// applyOnBuildTriggers inserts the base's ONBUILD triggers right after FROM
+// and returns how many were added.
+func applyOnBuildTriggers(stage *Stage, onBuild []string) (int, error) {
+	triggers, err := ParseOnBuildTriggers(stage.Base, onBuild)
+	if err != nil {
+		return 0, fmt.Errorf("invalid ONBUILD trigger in base image %s: %w", stage.Base, err)
+	}
+	stage.Instructions = append(triggers, stage.Instructions...)
+	return len(triggers), nil
+}
@@ -0,0 +1,129 @@
+package container
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Object types of plx inspect --type.
+const (
+	InspectContainer = "container"
+	InspectImage     = "image"
+	InspectVolume    = "volume"
+	InspectNetwork   = "network"
+)
+
+// ImageInfo is an image as shown by plx inspect.
+type ImageInfo struct {
+	Name string `json:"name"`
+	*ImageMetadata
+}
+
+// Volume is a managed volume as shown by plx inspect.
+type Volume struct {
+	Name       string   `json:"name"`
+	Mountpoint string   `json:"mountpoint"` // in the pocketlinx distro on WSL
+	UsedBy     []string `json:"usedBy"`     // IDs of the containers that mount it
+}
+
+// Network is a container network as shown by plx inspect.
+type Network struct {
+	Name       string            `json:"name"`
+	Driver     string            `json:"driver"`
+	Subnet     string            `json:"subnet"`
+	Gateway    string            `json:"gateway"`
+	Containers map[string]string `json:"containers"` // container ID -> IP
+}
+
+// Inspect looks name up as a container (ID, name or unique ID prefix), an image, a
+// volume and a network, in that order, or only as typ when it is given. The result is
+// a *Container, *ImageInfo, *Volume or *Network.
+func (e *Engine) Inspect(name, typ string) (any, error) {
+	switch typ {
+	case "", InspectContainer, InspectImage, InspectVolume, InspectNetwork:
+	default:
+		return nil, fmt.Errorf("invalid --type %s (expected container, image, volume or network)", typ)
+	}
+
+	var containers []Container
+	if typ != InspectImage {
+		var err error
+		if containers, err = e.List(); err != nil {
+			return nil, err
+		}
+	}
+	if typ == "" || typ == InspectContainer {
+		c, err := findContainer(containers, name)
+		if err != nil {
+			return nil, err
+		}
+		if c != nil {
+			return c, nil
+		}
+	}
+	if typ == "" || typ == InspectImage {
+		meta, err := e.InspectImage(name)
+		if err == nil {
+			return &ImageInfo{Name: name, ImageMetadata: meta}, nil
+		}
+		if typ == InspectImage {
+			return nil, err
+		}
+	}
+	if typ == "" || typ == InspectVolume {
+		vol, err := e.backend.InspectVolume(name)
+		if err == nil {
+			vol.UsedBy = []string{}
+			for _, c := range containers {
+				for _, m := range c.Config.Mounts {
+					if m.Source == name {
+						vol.UsedBy = append(vol.UsedBy, c.ID)
+						break
+					}
+				}
+			}
+			return vol, nil
+		}
+		if typ == InspectVolume {
+			return nil, err
+		}
+	}
+	for _, n := range e.backend.Networks() {
+		if (typ != "" && typ != InspectNetwork) || n.Name != name {
+			continue
+		}
+		n.Containers = map[string]string{}
+		for _, c := range containers {
+			if c.IP != "" && (c.Status == "Running" || c.Status == "Restarting") {
+				n.Containers[c.ID] = c.IP
+			}
+		}
+		return &n, nil
+	}
+	if typ != "" {
+		return nil, fmt.Errorf("no such %s: %s", typ, name)
+	}
+	return nil, fmt.Errorf("no such object: %s", name)
+}
+
+// findContainer finds a container by ID, name or unique ID prefix. It returns nil
+// without an error if nothing matches.
+func findContainer(containers []Container, name string) (*Container, error) {
+	var matches []*Container
+	for i := range containers {
+		c := &containers[i]
+		if c.ID == name || c.Name == name {
+			return c, nil
+		}
+		if strings.HasPrefix(c.ID, name) {
+			matches = append(matches, c)
+		}
+	}
+	if len(matches) > 1 {
+		return nil, fmt.Errorf("container ID prefix %s is ambiguous", name)
+	}
+	if len(matches) == 1 {
+		return matches[0], nil
+	}
+	return nil, nil
+}
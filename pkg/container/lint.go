@@ -0,0 +1,289 @@
+package container
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// LintSeverity classifies a lint finding. Errors make `plx lint` exit non-zero.
+type LintSeverity string
+
+const (
+	LintError   LintSeverity = "error"
+	LintWarning LintSeverity = "warning"
+)
+
+// LintDiagnostic is one problem found by `plx lint`.
+type LintDiagnostic struct {
+	File     string
+	Line     int
+	Severity LintSeverity
+	Msg      string
+}
+
+func (d LintDiagnostic) String() string {
+	return fmt.Sprintf("%s:%d: %s: %s", d.File, d.Line, d.Severity, d.Msg)
+}
+
+// lintInstructionFlags lists the --flags plx build understands, per instruction.
+// Keep this (and lintIgnoredInstructions) in sync with the parser and the backends.
+// FROM --platform is accepted but has no effect: images are pulled for the host.
+var lintInstructionFlags = map[string][]string{
+	"FROM":        {"platform"},
+	"RUN":         {"mount"},
+	"COPY":        {"from", "chown", "chmod"},
+	"ADD":         {"chown", "chmod", "checksum"},
+	"HEALTHCHECK": {"interval", "timeout", "start-period", "retries"},
+	"CMD":         nil,
+	"SHELL":       nil,
+	"ONBUILD":     nil,
+	"ENV":         nil,
+	"LABEL":       nil,
+	"EXPOSE":      nil,
+	"VOLUME":      nil,
+	"ARG":         nil,
+	"WORKDIR":     nil,
+	"USER":        nil,
+	"STOPSIGNAL":  nil,
+}
+
+// lintIgnoredInstructions are accepted by the parser but have no effect on the image.
+var lintIgnoredInstructions = map[string]string{
+	"ENTRYPOINT": "ENTRYPOINT is not supported by plx build and is ignored; use CMD",
+	"MAINTAINER": "MAINTAINER is deprecated and ignored; use LABEL maintainer=...",
+}
+
+// LintDockerfile checks the Dockerfile at path against what plx build supports.
+// ctxDir is the build context COPY/ADD sources are resolved in.
+func LintDockerfile(path, ctxDir string) ([]LintDiagnostic, error) {
+	df, err := ParseDockerfile(path)
+	if err != nil {
+		var perr *ParseError
+		if errors.As(err, &perr) {
+			return []LintDiagnostic{{File: perr.File, Line: perr.Line, Severity: LintError, Msg: perr.Msg}}, nil
+		}
+		return nil, err
+	}
+
+	var diags []LintDiagnostic
+	report := func(line int, sev LintSeverity, format string, a ...any) {
+		diags = append(diags, LintDiagnostic{File: path, Line: line, Severity: sev, Msg: fmt.Sprintf(format, a...)})
+	}
+
+	for _, instr := range df.GlobalArgs {
+		lintInstruction(instr, instr.Type, instr.Raw, report)
+	}
+
+	required := make(map[int]bool)
+	for _, i := range df.RequiredStages() {
+		required[i] = true
+	}
+	for i, stage := range df.Stages {
+		if !required[i] {
+			name := stage.Name
+			if name == "" {
+				name = fmt.Sprintf("stage-%d", i)
+			}
+			report(stage.Line, LintWarning, "stage %s is not used by the final stage and will not be built", name)
+		}
+		for _, instr := range stage.Instructions {
+			lintInstruction(instr, instr.Type, instr.Raw, report)
+			if instr.Type == "ONBUILD" {
+				trigger, rest, _ := strings.Cut(instr.Raw, " ")
+				lintInstruction(instr, strings.ToUpper(trigger), strings.TrimSpace(rest), report)
+				continue
+			}
+			if (instr.Type == "COPY" || instr.Type == "ADD") && instr.Flag("from") == "" {
+				if err := lintSources(ctxDir, instr); err != nil {
+					report(instr.Line, LintError, "%s: %v", instr.Type, err)
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(diags, func(a, b int) bool { return diags[a].Line < diags[b].Line })
+	return diags, nil
+}
+
+// lintInstruction reports unknown or ignored instructions, unsupported flags and
+// malformed exec forms. keyword/raw differ from instr for ONBUILD triggers.
+func lintInstruction(instr Instruction, keyword, raw string, report func(int, LintSeverity, string, ...any)) {
+	if msg, ok := lintIgnoredInstructions[keyword]; ok {
+		report(instr.Line, LintWarning, "%s", msg)
+	} else if _, ok := lintInstructionFlags[keyword]; !ok {
+		report(instr.Line, LintError, "unknown instruction %s", keyword)
+		return
+	}
+
+	flags := instr.Flags
+	if keyword != instr.Type {
+		// ONBUILD trigger: its flags are still part of the raw text
+		flags, raw = parseInstructionFlags(raw)
+	}
+	for _, name := range sortedKeys(flags) {
+		supported := false
+		for _, f := range lintInstructionFlags[keyword] {
+			supported = supported || f == name
+		}
+		if !supported {
+			report(instr.Line, LintWarning, "%s --%s is not supported by plx build and is ignored", keyword, name)
+		}
+	}
+
+	switch keyword {
+	case "HEALTHCHECK":
+		kw, rest, _ := strings.Cut(raw, " ")
+		if !strings.EqualFold(kw, "CMD") {
+			return
+		}
+		raw = rest
+		fallthrough
+	case "RUN", "CMD", "ENTRYPOINT":
+		if _, _, err := ParseExecForm(raw); err != nil {
+			report(instr.Line, LintError, "%v (it would run as a shell command)", err)
+		}
+	}
+}
+
+// lintSources checks that the local COPY/ADD sources exist in the build context.
+func lintSources(ctxDir string, instr Instruction) error {
+	sources, err := ExpandSources(ctxDir, instr)
+	if err != nil {
+		return err
+	}
+	for _, src := range sources {
+		if IsRemoteSource(src) {
+			continue
+		}
+		local := ResolveLocalSource(ctxDir, src)
+		if !strings.HasPrefix(src, "file://") {
+			if rel := path.Clean(filepath.ToSlash(src)); rel == ".." || strings.HasPrefix(rel, "../") {
+				return fmt.Errorf("%s is outside the build context", src)
+			}
+		}
+		if _, err := os.Stat(local); err != nil {
+			return fmt.Errorf("%s not found in the build context", src)
+		}
+	}
+	return nil
+}
+
+// LintProjectConfig checks a plx.json file against ProjectConfig: JSON syntax,
+// unknown fields, value types, mounts and the network subnet.
+func LintProjectConfig(path string) ([]LintDiagnostic, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var diags []LintDiagnostic
+	report := func(offset int64, format string, a ...any) {
+		diags = append(diags, LintDiagnostic{File: path, Line: lineAt(data, offset), Severity: LintError, Msg: fmt.Sprintf(format, a...)})
+	}
+
+	var syntax *json.SyntaxError
+	if err := json.Unmarshal(data, new(any)); errors.As(err, &syntax) {
+		report(syntax.Offset, "%v", err)
+		return diags, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		report(0, "plx.json must contain a JSON object")
+		return diags, nil
+	}
+	fields := reflect.TypeOf(ProjectConfig{})
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key := tok.(string)
+		keyOffset := dec.InputOffset()
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, err
+		}
+		valueOffset := keyOffset + int64(bytes.IndexFunc(data[keyOffset:], func(r rune) bool {
+			return r != ':' && r != ' ' && r != '\t' && r != '\r' && r != '\n'
+		}))
+
+		field, ok := projectConfigField(fields, key)
+		if !ok {
+			report(keyOffset, "unknown field %q", key)
+			continue
+		}
+		value := reflect.New(field.Type)
+		vdec := json.NewDecoder(bytes.NewReader(raw))
+		vdec.DisallowUnknownFields()
+		if err := vdec.Decode(value.Interface()); err != nil {
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(err, &typeErr) {
+				report(valueOffset+typeErr.Offset-1, "%s: expected %s, got %s", key, typeErr.Type, typeErr.Value)
+			} else {
+				report(valueOffset, "%s: %s", key, strings.TrimPrefix(err.Error(), "json: "))
+			}
+			continue
+		}
+
+		switch v := value.Elem().Interface().(type) {
+		case []Mount:
+			for i, m := range v {
+				if m.Source == "" {
+					report(valueOffset, "mounts[%d]: source is required", i)
+				}
+				if m.Target == "" {
+					report(valueOffset, "mounts[%d]: target is required", i)
+				} else if !strings.HasPrefix(m.Target, "/") {
+					report(valueOffset, "mounts[%d]: target %s must be an absolute path", i, m.Target)
+				}
+			}
+		case *NetworkConfig:
+			if v != nil && v.Subnet != "" {
+				if _, _, err := net.ParseCIDR(v.Subnet); err != nil {
+					report(valueOffset, "network.subnet: %s is not a valid CIDR (e.g. 10.10.1.0/24)", v.Subnet)
+				}
+			}
+		case string:
+			if field.Name == "Workdir" && v != "" && !strings.HasPrefix(v, "/") {
+				report(valueOffset, "workdir %s must be an absolute path", v)
+			}
+		}
+	}
+	return diags, nil
+}
+
+// projectConfigField finds the ProjectConfig field for a JSON key the way
+// encoding/json does (case-insensitively).
+func projectConfigField(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "" {
+			name = f.Name
+		}
+		if strings.EqualFold(name, key) {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// lineAt returns the 1-based line number of a byte offset in data.
+func lineAt(data []byte, offset int64) int {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return bytes.Count(data[:offset], []byte("\n")) + 1
+}
@@ -0,0 +1,126 @@
+package container
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// lintResult is a LintDiagnostic without its file name, for comparisons; msg is a
+// substring of the message.
+type lintResult struct {
+	line int
+	sev  LintSeverity
+	msg  string
+}
+
+func checkDiagnostics(t *testing.T, name string, got []LintDiagnostic, want []lintResult) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Errorf("%s: got %d diagnostics, want %d: %v", name, len(got), len(want), got)
+		return
+	}
+	for i, d := range got {
+		if d.Line != want[i].line || d.Severity != want[i].sev || !strings.Contains(d.Msg, want[i].msg) {
+			t.Errorf("%s: diagnostic %d = %v, want line %d %s %q", name, i, d, want[i].line, want[i].sev, want[i].msg)
+		}
+	}
+}
+
+func TestLintDockerfile(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []lintResult
+	}{
+		{"clean", "FROM --platform=linux/amd64 alpine\nCOPY app.go /src/\nRUN --mount=type=cache,target=/c make\nCMD [\"/app\"]\n", nil},
+		{"parse error", "FROM a\nRUN <<EOF\necho\n",
+			[]lintResult{{2, LintError, "heredoc"}}},
+		{"unknown instruction", "FROM a\nFOO bar\n",
+			[]lintResult{{2, LintError, "unknown instruction FOO"}}},
+		{"ignored instructions", "FROM a\nMAINTAINER me\nENTRYPOINT [\"/app\"]\n",
+			[]lintResult{{2, LintWarning, "MAINTAINER"}, {3, LintWarning, "ENTRYPOINT"}}},
+		{"unsupported flag", "FROM a\nRUN --network=none make\n",
+			[]lintResult{{2, LintWarning, "RUN --network"}}},
+		{"broken exec form", "FROM a\nCMD [\"/app\",\n",
+			[]lintResult{{2, LintError, "shell command"}}},
+		{"broken HEALTHCHECK exec form", "FROM a\nHEALTHCHECK --interval=5s CMD [\"curl\n",
+			[]lintResult{{2, LintError, "shell command"}}},
+		{"missing COPY source", "FROM a\nCOPY app.go missing.go /src/\n",
+			[]lintResult{{2, LintError, "missing.go not found"}}},
+		{"COPY source outside the context", "FROM a\nCOPY ../secret /\n",
+			[]lintResult{{2, LintError, "outside the build context"}}},
+		{"COPY --from is not checked", "FROM a AS build\nRUN make\nFROM b\nCOPY --from=build /out /out\n", nil},
+		{"ignored COPY source", "FROM a\nCOPY debug.log /\n",
+			[]lintResult{{2, LintError, "excluded"}}},
+		{"unreachable stage", "FROM a AS tools\nRUN make\nFROM b AS build\nFROM build\n",
+			[]lintResult{{1, LintWarning, "stage tools is not used"}}},
+		{"unnamed unreachable stage", "FROM a\nFROM b\n",
+			[]lintResult{{1, LintWarning, "stage stage-0"}}},
+		{"ONBUILD trigger flags", "FROM a\nONBUILD COPY --chmod=755 --link app.go /\nONBUILD RUN --mount=type=cache,target=/c make\n",
+			[]lintResult{{2, LintWarning, "COPY --link"}}},
+		{"ONBUILD trigger exec form", "FROM a\nONBUILD CMD [\"x\"\n",
+			[]lintResult{{2, LintError, "shell command"}}},
+		{"ONBUILD ignored trigger", "FROM a\nONBUILD ENTRYPOINT [\"x\"]\n",
+			[]lintResult{{2, LintWarning, "ENTRYPOINT"}}},
+		{"global ARG", "ARG BASE=alpine\nFROM $BASE\n", nil},
+		{"sorted by line", "FROM a AS unused\nFROM b\nMAINTAINER me\nFOO\n",
+			[]lintResult{{1, LintWarning, "stage unused"}, {3, LintWarning, "MAINTAINER"}, {4, LintError, "unknown instruction"}}},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		writeFiles(t, dir, map[string]string{"Dockerfile": tt.src, "app.go": "", ".dockerignore": "*.log\n", "debug.log": ""})
+		diags, err := LintDockerfile(filepath.Join(dir, "Dockerfile"), dir)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		checkDiagnostics(t, tt.name, diags, tt.want)
+	}
+}
+
+func TestLintProjectConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []lintResult
+	}{
+		{"valid", `{
+  "name": "app",
+  "image": "alpine",
+  "mounts": [{"source": ".", "target": "/app"}],
+  "command": ["sh"],
+  "workdir": "/app",
+  "network": {"bridge": "plx1", "subnet": "10.10.1.0/24"}
+}`, nil},
+		{"syntax error", "{\n  \"name\": \"app\",\n}\n",
+			[]lintResult{{3, LintError, "invalid character"}}},
+		{"not an object", "[]\n",
+			[]lintResult{{1, LintError, "JSON object"}}},
+		{"unknown field", "{\n  \"name\": \"app\",\n  \"imgae\": \"alpine\"\n}\n",
+			[]lintResult{{3, LintError, `unknown field "imgae"`}}},
+		{"field names are case-insensitive", "{\"Name\": \"app\"}\n", nil},
+		{"type error", "{\n  \"name\": \"app\",\n  \"command\": \"sh -c make\"\n}\n",
+			[]lintResult{{3, LintError, "command: expected []string, got string"}}},
+		{"type error inside a value", "{\n  \"mounts\": [\n    {\"source\": \".\", \"target\": \"/a\"},\n    {\"source\": 1, \"target\": \"/b\"}\n  ]\n}\n",
+			[]lintResult{{4, LintError, "got number"}}},
+		{"unknown mount field", "{\n  \"mounts\": [{\"source\": \".\", \"target\": \"/a\", \"ro\": true}]\n}\n",
+			[]lintResult{{2, LintError, "unknown field"}}},
+		{"incomplete mounts", "{\n  \"mounts\": [{\"source\": \".\"}, {\"target\": \"app\", \"source\": \".\"}]\n}\n",
+			[]lintResult{{2, LintError, "mounts[0]: target is required"}, {2, LintError, "mounts[1]: target app must be an absolute path"}}},
+		{"bad subnet", "{\n  \"network\": {\"subnet\": \"10.10.1.0\"}\n}\n",
+			[]lintResult{{2, LintError, "not a valid CIDR"}}},
+		{"relative workdir", "{\n\n  \"workdir\": \"app\"\n}\n",
+			[]lintResult{{3, LintError, "workdir app must be an absolute path"}}},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		writeFiles(t, dir, map[string]string{"plx.json": tt.src})
+		diags, err := LintProjectConfig(filepath.Join(dir, "plx.json"))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		checkDiagnostics(t, tt.name, diags, tt.want)
+	}
+}
@@ -3,9 +3,12 @@
 package container
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"time"
 
 	"PocketLinx/pkg/shim"
 )
@@ -68,18 +71,25 @@ func (b *LinuxBackend) Setup() error {
 // Delegation
 
 // Runtime
-func (b *LinuxBackend) Run(opts RunOptions) error      { return b.Runtime.Run(opts) }
-func (b *LinuxBackend) Start(id string) error          { return b.Runtime.Start(id) }
-func (b *LinuxBackend) List() ([]Container, error)     { return b.Runtime.List() }
-func (b *LinuxBackend) Stop(id string) error           { return b.Runtime.Stop(id) }
-func (b *LinuxBackend) Logs(id string) (string, error) { return b.Runtime.Logs(id) }
-func (b *LinuxBackend) Remove(id string) error         { return b.Runtime.Remove(id) }
+func (b *LinuxBackend) Run(opts RunOptions) error  { return b.Runtime.Run(opts) }
+func (b *LinuxBackend) Start(id string) error      { return b.Runtime.Start(id) }
+func (b *LinuxBackend) List() ([]Container, error) { return b.Runtime.List() }
+func (b *LinuxBackend) Stop(id string, timeout time.Duration) error {
+	return b.Runtime.Stop(id, timeout)
+}
+func (b *LinuxBackend) Logs(ctx context.Context, id string, opts LogOptions, w io.Writer) error {
+	return b.Runtime.Logs(ctx, id, opts, w)
+}
+func (b *LinuxBackend) Remove(id string) error { return b.Runtime.Remove(id) }
 
 // Image
 func (b *LinuxBackend) Pull(image string) error   { return b.Image.Pull(image) }
 func (b *LinuxBackend) Images() ([]string, error) { return b.Image.Images() }
-func (b *LinuxBackend) Build(ctxDir string, dockerfile string, tag string) (string, error) {
-	return b.Image.Build(ctxDir, dockerfile, tag)
+func (b *LinuxBackend) InspectImage(image string) (*ImageMetadata, error) {
+	return b.Image.Inspect(image)
+}
+func (b *LinuxBackend) Build(opts BuildOptions) (string, error) {
+	return b.Image.Build(opts)
 }
 func (b *LinuxBackend) Prune() error { return b.Image.Prune() }
 
@@ -96,8 +106,33 @@ func (b *LinuxBackend) CreateVolume(name string) error { return b.Volume.Create(
 func (b *LinuxBackend) RemoveVolume(name string) error { return b.Volume.Remove(name) }
 func (b *LinuxBackend) ListVolumes() ([]string, error) { return b.Volume.List() }
 
+func (b *LinuxBackend) InspectVolume(name string) (*Volume, error) { return b.Volume.Inspect(name) }
+
+func (b *LinuxBackend) Networks() []Network { return b.Runtime.Networks() }
+
 func (b *LinuxBackend) GetIP(id string) (string, error)         { return b.Runtime.GetIP(id) }
 func (b *LinuxBackend) Update(id string, opts RunOptions) error { return b.Runtime.Update(id, opts) }
 func (b *LinuxBackend) Exec(id string, cmd []string, interactive bool) error {
 	return b.Runtime.Exec(id, cmd, interactive)
 }
+func (b *LinuxBackend) Stats() ([]ContainerStats, error) { return b.Runtime.Stats() }
+func (b *LinuxBackend) RestoreContainers() error         { return b.Runtime.RestoreContainers(false) }
+func (b *LinuxBackend) Top(id string, psArgs []string) (*ContainerTop, error) {
+	return b.Runtime.Top(id, psArgs)
+}
+
+func (b *LinuxBackend) CopyToContainer(id, hostPath, containerPath string, copyOwnership bool) error {
+	return b.Runtime.CopyToContainer(id, hostPath, containerPath, copyOwnership)
+}
+
+func (b *LinuxBackend) CopyFromContainer(id, containerPath, hostPath string) error {
+	return b.Runtime.CopyFromContainer(id, containerPath, hostPath)
+}
+
+func (b *LinuxBackend) GetArchive(id, containerPath string, w io.Writer) error {
+	return b.Runtime.GetArchive(id, containerPath, w)
+}
+
+func (b *LinuxBackend) PutArchive(id, containerPath string, r io.Reader, copyOwnership bool) error {
+	return b.Runtime.PutArchive(id, containerPath, r, copyOwnership)
+}
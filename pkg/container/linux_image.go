@@ -3,11 +3,15 @@
 package container
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"strings"
+	"sync"
 )
 
 // LinuxImageService implements ImageService for native Linux
@@ -20,6 +24,11 @@ func NewLinuxImageService(rootDir string) *LinuxImageService {
 }
 
 func (s *LinuxImageService) Pull(image string) error {
+	return s.pull(image, os.Stdout)
+}
+
+// pull downloads image, writing its progress messages to out (build output during builds).
+func (s *LinuxImageService) pull(image string, out io.Writer) error {
 	url, ok := SupportedImages[image]
 	if !ok {
 		return fmt.Errorf("image '%s' is not supported", image)
@@ -27,11 +36,11 @@ func (s *LinuxImageService) Pull(image string) error {
 
 	targetFile := filepath.Join(s.rootDir, "images", image+".tar.gz")
 	if _, err := os.Stat(targetFile); err == nil {
-		fmt.Printf("Image '%s' already exists.\n", image)
+		fmt.Fprintf(out, "Image '%s' already exists.\n", image)
 		return nil
 	}
 
-	fmt.Printf("Pulling image '%s' from %s...\n", image, url)
+	fmt.Fprintf(out, "Pulling image '%s' from %s...\n", image, url)
 	if err := downloadFile(url, targetFile); err != nil {
 		return fmt.Errorf("error executing download: %w", err)
 	}
@@ -59,21 +68,59 @@ func (s *LinuxImageService) Images() ([]string, error) {
 	return images, nil
 }
 
+// Inspect returns the metadata saved alongside an image (empty for pulled images).
+func (s *LinuxImageService) Inspect(image string) (*ImageMetadata, error) {
+	if _, err := os.Stat(filepath.Join(s.rootDir, "images", image+".tar.gz")); err != nil {
+		return nil, fmt.Errorf("image '%s' not found", image)
+	}
+	meta := &ImageMetadata{}
+	data, err := os.ReadFile(filepath.Join(s.rootDir, "images", image+".json"))
+	if err != nil {
+		return meta, nil
+	}
+	if err := json.Unmarshal(data, meta); err != nil {
+		return nil, fmt.Errorf("failed to parse metadata for image '%s': %w", image, err)
+	}
+	return meta, nil
+}
+
 func (s *LinuxImageService) Prune() error {
+	if err := os.RemoveAll(filepath.Join(s.rootDir, "cache-mounts")); err != nil {
+		return err
+	}
 	return os.RemoveAll(filepath.Join(s.rootDir, "cache"))
 }
 
-func (s *LinuxImageService) Build(ctxDir string, dockerfile string, tag string) (string, error) {
+func (s *LinuxImageService) Build(opts BuildOptions) (_ string, err error) {
+	build := stepReporter{progress: opts.progress()}
+	defer func() {
+		if err != nil {
+			build.reportFailure(err)
+		}
+	}()
+
+	ctxDir := opts.ContextDir
+	dockerfile := opts.Dockerfile
 	if dockerfile == "" {
 		dockerfile = "Dockerfile"
 	}
-	dockerfilePath := filepath.Join(ctxDir, dockerfile)
+	dockerfilePath := dockerfile
+	if !filepath.IsAbs(dockerfilePath) {
+		dockerfilePath = filepath.Join(ctxDir, dockerfile)
+	}
 	df, err := ParseDockerfile(dockerfilePath)
 	if err != nil {
 		return "", fmt.Errorf("failed to parse Dockerfile: %w", err)
 	}
+	df.ApplyGlobalArgs(opts.BuildArgs)
+	if err := applyStageOnBuildTriggers(df, s.Inspect, build); err != nil {
+		return "", err
+	}
+	if unused := UnusedBuildArgs(df.allInstructions(), opts.BuildArgs); len(unused) > 0 {
+		build.Warnf("one or more build-args %v were not consumed", unused)
+	}
 
-	imageName := tag
+	imageName := opts.Tag
 	if imageName == "" {
 		imageName = strings.ToLower(filepath.Base(ctxDir))
 		if imageName == "." {
@@ -82,88 +129,308 @@ func (s *LinuxImageService) Build(ctxDir string, dockerfile string, tag string)
 		}
 	}
 
-	buildId := fmt.Sprintf("build-%d", os.Getpid())
-	buildDir := filepath.Join(s.rootDir, "builds", buildId)
-	rootfsDir := filepath.Join(buildDir, "rootfs")
-	defer os.RemoveAll(buildDir)
-
-	if err := os.MkdirAll(rootfsDir, 0755); err != nil {
-		return "", err
-	}
-
-	// Base image
-	if err := s.Pull(df.Base); err != nil {
-		return "", err
+	// Base images (and images used by COPY --from)
+	for _, i := range df.RequiredStages() {
+		refs := []string{df.Stages[i].Base}
+		for _, instr := range df.Stages[i].Instructions {
+			if instr.Type == "COPY" && instr.Flag("from") != "" {
+				refs = append(refs, instr.Flag("from"))
+			}
+		}
+		for _, ref := range refs {
+			if df.StageIndex(ref, i) >= 0 {
+				continue
+			}
+			if _, err := os.Stat(filepath.Join(s.rootDir, "images", ref+".tar.gz")); err == nil {
+				continue
+			}
+			out := build.Writer()
+			err := s.pull(ref, out)
+			out.Close()
+			if err != nil {
+				return "", err
+			}
+		}
 	}
-	baseTar := filepath.Join(s.rootDir, "images", df.Base+".tar.gz")
-	exec.Command("tar", "-xf", baseTar, "-C", rootfsDir).Run()
 
-	// 2. Build Steps
-	envPrefix := ""
+	build.emit(BuildEvent{Type: BuildStarted, Image: imageName, Message: df.Final().Base})
 
-	for _, instr := range df.Instructions {
-		switch instr.Type {
-		case "ENV":
-			for i := 0; i < len(instr.Args); i += 2 {
-				k := instr.Args[i]
-				v := ""
-				if i+1 < len(instr.Args) {
-					v = instr.Args[i+1]
-				}
-				envPrefix += fmt.Sprintf("export %s=%q; ", k, v)
-			}
-		case "WORKDIR":
-			// Skip for now in simplified linux build
-		case "RUN":
-			runCmd := instr.Raw
-			fmt.Printf("STEP: RUN %s\n", runCmd)
-
-			resolvConfPath := filepath.Join(rootfsDir, "etc/resolv.conf")
-			_ = os.MkdirAll(filepath.Dir(resolvConfPath), 0755)
-			exec.Command("cp", "/etc/resolv.conf", resolvConfPath).Run()
-
-			shimPath := "/usr/local/bin/plx-shim"
-			if _, err := os.Stat(shimPath); os.IsNotExist(err) {
-				return "", fmt.Errorf("plx-shim not found at %s. Please run 'plx setup' first", shimPath)
-			}
+	// Every build gets its own directory, so concurrent builds don't interfere
+	buildDir := filepath.Join(s.rootDir, "builds", newBuildID())
+	defer os.RemoveAll(buildDir)
 
-			fullUserCmd := fmt.Sprintf("%s%s", envPrefix, runCmd)
-			cmdArgs := []string{"--mount", "--pid", "--fork", "--uts", "--propagation", "unchanged"}
-			// args: ROOTFS MOUNTS WORKDIR USER PID_FILE [cmd...]
-			cmdArgs = append(cmdArgs, shimPath, rootfsDir, "none", "none", "root", "none", "/bin/sh", "-c", fullUserCmd)
+	// Build the stages; independent stages run in parallel
+	states := make([]*stageState, len(df.Stages))
+	var fromMu sync.Mutex
+	fromImages := make(map[string]string) // images used by COPY --from, extracted into buildDir
+	imageRootfs := func(image string) (string, error) {
+		fromMu.Lock()
+		defer fromMu.Unlock()
+		if dir, ok := fromImages[image]; ok {
+			return dir, nil
+		}
+		dir := filepath.Join(buildDir, "from", image)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return "", err
+		}
+		if err := exec.Command("tar", "-xf", filepath.Join(s.rootDir, "images", image+".tar.gz"), "-C", dir).Run(); err != nil {
+			return "", fmt.Errorf("failed to extract image %s: %w", image, err)
+		}
+		fromImages[image] = dir
+		return dir, nil
+	}
 
-			runExec := exec.Command("unshare", cmdArgs...)
-			runExec.Stdin = os.Stdin
-			runExec.Stdout = os.Stdout
-			runExec.Stderr = os.Stderr
+	err = runStages(df, func(i int) error {
+		stage := df.Stages[i]
+		report := stepReporter{progress: build.progress, stage: df.StageLabel(i)}
+		if report.stage != "" {
+			report.emit(BuildEvent{Type: BuildInfo, Message: fmt.Sprintf("[%s] FROM %s", report.stage, stage.Base)})
+		}
 
-			if err := runExec.Run(); err != nil {
-				return "", fmt.Errorf("RUN failed: %w", err)
+		state := newStageState(filepath.Join(buildDir, fmt.Sprintf("stage-%d", i), "rootfs"))
+		if err := os.MkdirAll(state.rootfs, 0755); err != nil {
+			return err
+		}
+		if j := df.StageIndex(stage.Base, i); j >= 0 {
+			state.inheritStage(states[j])
+			if out, err := exec.Command("cp", "-a", states[j].rootfs+"/.", state.rootfs+"/").CombinedOutput(); err != nil {
+				return fmt.Errorf("failed to copy stage %s: %s", df.StageLabel(j), strings.TrimSpace(string(out)))
+			}
+		} else {
+			baseTar := filepath.Join(s.rootDir, "images", stage.Base+".tar.gz")
+			exec.Command("tar", "-xf", baseTar, "-C", state.rootfs).Run()
+			// LABEL/EXPOSE/VOLUME/HEALTHCHECK/STOPSIGNAL are inherited from the base image (ONBUILD is not)
+			if baseMeta, err := s.Inspect(stage.Base); err == nil {
+				state.inheritImage(baseMeta)
 			}
+		}
 
-		case "COPY":
-			src := filepath.Join(ctxDir, instr.Args[0])
-			dst := filepath.Join(rootfsDir, instr.Args[1])
-			_ = os.MkdirAll(filepath.Dir(dst), 0755)
-			if err := exec.Command("cp", "-r", src, dst).Run(); err != nil {
-				return "", fmt.Errorf("COPY failed: %w", err)
+		for k, instr := range stage.Instructions {
+			step := report.forStep(k, len(stage.Instructions), instr)
+			step.emit(BuildEvent{Type: StepStarted})
+			state.apply(instr, opts.BuildArgs, step)
+			if err := s.executeStep(opts, state, instr, step, func(from string) (string, error) {
+				if j := df.StageIndex(from, i); j >= 0 {
+					return states[j].rootfs, nil
+				}
+				return imageRootfs(from)
+			}); err != nil {
+				return step.fail(err)
 			}
 		}
+		states[i] = state
+		return nil
+	})
+	if err != nil {
+		return "", err
 	}
+	final := states[len(df.Stages)-1]
 
 	// 4. Save
 	if err := os.MkdirAll(filepath.Join(s.rootDir, "images"), 0755); err != nil {
 		return "", err
 	}
 	outTar := filepath.Join(s.rootDir, "images", imageName+".tar.gz")
-	fmt.Printf("Saving image to %s...\n", outTar)
-	if err := exec.Command("tar", "-czf", outTar, "-C", rootfsDir, ".").Run(); err != nil {
+	if err := build.Track(fmt.Sprintf("Saving image to %s", outTar), exec.Command("sh", "-c", imageArchiveScript(final.rootfs, outTar, opts)).Run); err != nil {
 		return "", fmt.Errorf("failed to save image: %w", err)
 	}
+	metaJSON, _ := json.MarshalIndent(final.metadata(), "", "  ")
+	metaFile := filepath.Join(s.rootDir, "images", imageName+".json")
+	if err := writeFileAtomic(metaFile, metaJSON); err != nil {
+		return "", fmt.Errorf("failed to save image metadata: %w", err)
+	}
 
+	build.emit(BuildEvent{Type: BuildFinished, Image: imageName})
 	return imageName, nil
 }
 
+// executeStep runs one instruction of a stage. fromRootfs resolves COPY --from.
+func (s *LinuxImageService) executeStep(opts BuildOptions, state *stageState, instr Instruction, step stepReporter, fromRootfs func(from string) (string, error)) error {
+	rootfsDir := state.rootfs
+	switch instr.Type {
+	case "RUN":
+		runCmd := instr.ShellCommand()
+
+		resolvConfPath := filepath.Join(rootfsDir, "etc/resolv.conf")
+		_ = os.MkdirAll(filepath.Dir(resolvConfPath), 0755)
+		exec.Command("cp", "/etc/resolv.conf", resolvConfPath).Run()
+
+		shimPath := "/usr/local/bin/plx-shim"
+		if _, err := os.Stat(shimPath); os.IsNotExist(err) {
+			return fmt.Errorf("plx-shim not found at %s. Please run 'plx setup' first", shimPath)
+		}
+
+		mounts, err := resolveRunMounts(instr, opts.Secrets, filepath.Join(s.rootDir, "cache-mounts"), filepath.Abs, step)
+		if err != nil {
+			return err
+		}
+
+		fullUserCmd := fmt.Sprintf("%s%s%s", state.argPrefix, state.envPrefix, runCmd)
+		cmdArgs := []string{"--mount", "--pid", "--fork", "--uts", "--propagation", "unchanged"}
+		if len(mounts) > 0 {
+			// RUN --mount: bind secrets and caches around the shim, then remove the mount points
+			setup, teardown := mountScript(rootfsDir, mounts)
+			cmdArgs = append(cmdArgs, "sh", "-c", setup+"\n\"$0\" \"$@\"\nRET=$?\n"+teardown+"\nexit $RET")
+		}
+		// args: ROOTFS MOUNTS WORKDIR USER PID_FILE [cmd...]
+		cmdArgs = append(cmdArgs, shimPath, rootfsDir, "none", state.workdir, state.user, "none", "/bin/sh", "-c", fullUserCmd)
+
+		out := step.Writer()
+		runExec := exec.Command("unshare", cmdArgs...)
+		runExec.Stdout = out
+		runExec.Stderr = out
+		err = runExec.Run()
+		out.Close()
+		if err != nil {
+			return fmt.Errorf("RUN failed: %w", err)
+		}
+
+	case "COPY", "ADD":
+		if len(instr.Args) < 2 {
+			return fmt.Errorf("%s requires a source and a destination", instr.Type)
+		}
+		if from := instr.Flag("from"); from != "" && instr.Type == "COPY" {
+			srcRoot, err := fromRootfs(from)
+			if err != nil {
+				return err
+			}
+			destPath := instr.Dest()
+			if !path.IsAbs(destPath) {
+				destPath = path.Join(state.workdir, destPath)
+			}
+			step.Logf("COPY --from=%s %s to %s", from, strings.Join(instr.Sources(), " "), instr.Dest())
+			script := stageCopyScript(srcRoot, instr.Sources(), rootfsDir, destPath, strings.HasSuffix(instr.Dest(), "/"), instr.Flag("chmod"), instr.Flag("chown"))
+			if out, err := exec.Command("sh", "-c", script).CombinedOutput(); err != nil {
+				return fmt.Errorf("COPY failed: %s", strings.TrimSpace(string(out)))
+			}
+			break
+		}
+		if err := s.executeBuildCopy(opts.ContextDir, instr, rootfsDir, step); err != nil {
+			return fmt.Errorf("%s failed: %w", instr.Type, err)
+		}
+	}
+	return nil
+}
+
+func (s *LinuxImageService) executeBuildCopy(ctxDir string, instr Instruction, rootfsDir string, step stepReporter) error {
+	sources, err := ExpandSources(ctxDir, instr)
+	if err != nil {
+		return err
+	}
+	for _, src := range sources {
+		if err := s.copyBuildSource(ctxDir, instr, src, instr.Dest(), rootfsDir, step); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *LinuxImageService) copyBuildSource(ctxDir string, instr Instruction, srcArg, destArg, rootfsDir string, step stepReporter) error {
+	dst := filepath.Join(rootfsDir, destArg)
+	destIsDir := strings.HasSuffix(destArg, "/")
+
+	var src, srcName string
+	extract := false
+	if instr.Type == "ADD" && IsRemoteSource(srcArg) {
+		step.Logf("Downloading %s...", srcArg)
+		downloaded, err := FetchRemoteSource(srcArg, instr.Flag("checksum"))
+		if err != nil {
+			return err
+		}
+		src, srcName = downloaded, RemoteSourceName(srcArg)
+	} else {
+		src = ResolveLocalSource(ctxDir, srcArg)
+		srcName = filepath.Base(src)
+		if checksum := instr.Flag("checksum"); checksum != "" {
+			if err := VerifyChecksum(src, checksum); err != nil {
+				return fmt.Errorf("%s: %w", srcArg, err)
+			}
+		}
+		extract = instr.Type == "ADD" && IsArchive(src)
+	}
+
+	info, err := os.Stat(src)
+	if err != nil {
+		return fmt.Errorf("source %s not found: %w", srcArg, err)
+	}
+
+	// Paths created by this step, so that --chown/--chmod only touch what was added
+	var targets []string
+	switch {
+	case extract:
+		step.Logf("%s %s to %s (extracting archive)", instr.Type, srcArg, destArg)
+		if err := os.MkdirAll(dst, 0755); err != nil {
+			return err
+		}
+		if err := exec.Command("tar", "-xf", src, "-C", dst).Run(); err != nil {
+			return fmt.Errorf("failed to extract %s: %w", srcArg, err)
+		}
+		out, _ := exec.Command("tar", "-tf", src).Output()
+		seen := make(map[string]bool)
+		for _, entry := range strings.Split(string(out), "\n") {
+			top := strings.SplitN(strings.TrimPrefix(entry, "./"), "/", 2)[0]
+			if top != "" && !seen[top] {
+				seen[top] = true
+				targets = append(targets, filepath.Join(dst, top))
+			}
+		}
+
+	case info.IsDir():
+		step.Logf("%s %s to %s", instr.Type, srcArg, destArg)
+		if err := os.MkdirAll(dst, 0755); err != nil {
+			return err
+		}
+		ignore, err := LoadIgnoreMatcher(ctxDir)
+		if err != nil {
+			return err
+		}
+		entries, err := ListContextFiles(ctxDir, src, ignore)
+		if err != nil {
+			return fmt.Errorf("failed to scan %s: %w", srcArg, err)
+		}
+		var list strings.Builder
+		for _, e := range entries {
+			list.WriteString(e + "\x00")
+			if !strings.Contains(e, "/") {
+				targets = append(targets, filepath.Join(dst, e))
+			}
+		}
+		copyCmd := exec.Command("sh", "-c", `tar -C "$1" --null --no-recursion -T - -cf - | tar -C "$2" -xf -`, "sh", src, dst)
+		copyCmd.Stdin = strings.NewReader(list.String())
+		if out, err := copyCmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("copy failed: %s", strings.TrimSpace(string(out)))
+		}
+
+	default:
+		step.Logf("%s %s to %s", instr.Type, srcArg, destArg)
+		target := dst
+		if st, err := os.Stat(dst); destIsDir || (err == nil && st.IsDir()) {
+			target = filepath.Join(dst, srcName)
+		}
+		_ = os.MkdirAll(filepath.Dir(target), 0755)
+		if err := exec.Command("cp", src, target).Run(); err != nil {
+			return err
+		}
+		targets = append(targets, target)
+	}
+
+	for _, t := range targets {
+		if mode := instr.Flag("chmod"); mode != "" {
+			if out, err := exec.Command("chmod", "-R", mode, t).CombinedOutput(); err != nil {
+				return fmt.Errorf("chmod %s failed: %s", mode, strings.TrimSpace(string(out)))
+			}
+		}
+		if owner := instr.Flag("chown"); owner != "" {
+			// chown inside the rootfs so that user/group names resolve against the image's /etc/passwd
+			inRootfs := "/" + strings.TrimPrefix(strings.TrimPrefix(t, rootfsDir), "/")
+			if out, err := exec.Command("chroot", rootfsDir, "chown", "-R", owner, inRootfs).CombinedOutput(); err != nil {
+				return fmt.Errorf("chown %s failed: %s", owner, strings.TrimSpace(string(out)))
+			}
+		}
+	}
+	return nil
+}
+
 func (s *LinuxImageService) Diff(image1, image2 string) (string, error) {
 	return "", fmt.Errorf("diff not implemented for native linux yet")
 }
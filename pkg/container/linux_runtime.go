@@ -3,11 +3,14 @@
 package container
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -21,6 +24,23 @@ func NewLinuxRuntimeService(rootDir string) *LinuxRuntimeService {
 }
 
 func (s *LinuxRuntimeService) Run(opts RunOptions) error {
+	policy, err := ParseRestartPolicy(opts.Restart)
+	if err != nil {
+		return err
+	}
+	if err := ValidateResources(opts); err != nil {
+		return err
+	}
+	if err := ValidateLogConfig(opts); err != nil {
+		return err
+	}
+	if opts.PublishAll {
+		// Native containers share the host's network, so their ports are already reachable
+		return fmt.Errorf("-P/--publish-all is not supported by the native Linux backend (containers use the host network)")
+	}
+	if opts.Healthcheck.Enabled() {
+		return fmt.Errorf("health checks (--health-cmd) are not supported by the native Linux backend")
+	}
 	containerId := fmt.Sprintf("c-%x", time.Now().UnixNano())
 
 	containerDir := filepath.Join(s.rootDir, "containers", containerId)
@@ -51,15 +71,31 @@ func (s *LinuxRuntimeService) Run(opts RunOptions) error {
 		return fmt.Errorf("failed to extract rootfs: %w", err)
 	}
 
+	// Declared VOLUMEs get anonymous volumes under the managed volumes dir
+	if data, err := os.ReadFile(filepath.Join(s.rootDir, "images", image+".json")); err == nil {
+		var imgMeta ImageMetadata
+		if err := json.Unmarshal(data, &imgMeta); err == nil {
+			for _, m := range AnonymousVolumeMounts(opts.Mounts, imgMeta.Volumes) {
+				volDir := filepath.Join(s.rootDir, "volumes", m.Source)
+				_ = os.MkdirAll(volDir, 0755)
+				_ = exec.Command("cp", "-a", filepath.Join(rootfsDir, m.Target)+"/.", volDir).Run()
+				opts.Mounts = append(opts.Mounts, Mount{Source: volDir, Target: m.Target})
+			}
+		}
+	}
+
 	// 2. Metadata
 	meta := Container{
 		ID:      containerId,
 		Command: strings.Join(opts.Args, " "),
 		Created: time.Now(),
 		Status:  "Running",
+		Config:  opts,
 	}
+	meta.StartedAt = meta.Created
+	configPath := filepath.Join(containerDir, "config.json")
 	metaJSON, _ := json.Marshal(meta)
-	if err := os.WriteFile(filepath.Join(containerDir, "config.json"), metaJSON, 0644); err != nil {
+	if err := os.WriteFile(configPath, metaJSON, 0644); err != nil {
 		return fmt.Errorf("failed to write config.json: %w", err)
 	}
 
@@ -119,29 +155,83 @@ func (s *LinuxRuntimeService) Run(opts RunOptions) error {
 		user = "none"
 	}
 
-	cmdArgs = append(cmdArgs, "/usr/local/bin/plx-shim", rootfsDir, mountsStr, workdir, user, "none")
+	pidFile := filepath.Join(containerDir, "shim.pid")
+	cmdArgs = append(cmdArgs, "/usr/local/bin/plx-shim", rootfsDir, mountsStr, workdir, user, pidFile)
 	cmdArgs = append(cmdArgs, opts.Args...)
 
-	runCmd := exec.Command("unshare", cmdArgs...)
-
-	// Env & IO
-	runCmd.Stdin = os.Stdin
-	runCmd.Stdout = os.Stdout
-	runCmd.Stderr = os.Stderr
-	runCmd.Env = os.Environ() // Pass current env
-
-	if opts.Interactive {
-		// handle tty checks? For now just inherit
+	// Resource limits and accounting: the shim joins the cgroup (PLX_CGROUP) before it execs the command
+	var cgroupEnv []string
+	cgCmd := exec.Command("sh", "-c", cgroupSetupScript(containerId, opts))
+	cgCmd.Stderr = os.Stderr
+	out, err := cgCmd.Output()
+	if err != nil {
+		return fmt.Errorf("failed to set up resource limits: %w", err)
+	}
+	if cg := strings.TrimSpace(string(out)); cg != "" {
+		cgroupEnv = append(cgroupEnv, "PLX_CGROUP="+cg)
+	}
+	defer exec.Command("sh", "-c", cgroupCleanupScript(containerId)).Run()
+	saveMeta := func() {
+		metaJSON, _ := json.Marshal(meta)
+		_ = os.WriteFile(configPath, metaJSON, 0644)
 	}
 
 	fmt.Printf("Running container %s (Linux)...\n", containerId)
-	err := runCmd.Run()
+	// Native containers run in the foreground, so plx itself applies the restart policy
+	err = superviseForeground(policy, func() error {
+		runCmd := exec.Command("unshare", cmdArgs...)
+
+		// Env & IO
+		runCmd.Stdin = os.Stdin
+		runCmd.Stdout = os.Stdout
+		runCmd.Stderr = os.Stderr
+		runCmd.Env = append(os.Environ(), cgroupEnv...) // Pass current env
+
+		if opts.Interactive {
+			// handle tty checks? For now just inherit
+		}
+		_ = os.Remove(pidFile)
+		if err := runCmd.Start(); err != nil {
+			return err
+		}
+		done := make(chan error, 1)
+		go func() { done <- runCmd.Wait() }()
+		// The shim writes the host PID of the container's PID 1 right after it starts
+		for i := 0; i < 50; i++ {
+			select {
+			case err := <-done:
+				return err
+			case <-time.After(100 * time.Millisecond):
+			}
+			if data, err := os.ReadFile(pidFile); err == nil && len(data) > 0 {
+				meta.Pid, _ = strconv.Atoi(strings.TrimSpace(string(data)))
+				saveMeta()
+				break
+			}
+		}
+		return <-done
+	}, func() bool {
+		_, err := os.Stat(filepath.Join(containerDir, "stopped"))
+		return err == nil
+	}, func(count int) {
+		meta.RestartCount = count
+		meta.Pid = 0
+		meta.StartedAt = time.Now()
+		saveMeta()
+	})
 
 	// Cleanup / Update status
+	oomOut, _ := exec.Command("sh", "-c", oomKillsScript(containerId)).Output()
 	meta.Status = "Exited"
-	metaJSON, _ = json.Marshal(meta)
-	_ = os.WriteFile(filepath.Join(containerDir, "config.json"), metaJSON, 0644)
-
+	meta.Pid = 0
+	meta.ExitCode = exitCodeOf(err)
+	meta.OOMKilled = parseOOMKilled(string(oomOut))
+	meta.FinishedAt = time.Now()
+	saveMeta()
+
+	if meta.ExitCode > 0 {
+		return &ExitError{ID: containerId, Code: meta.ExitCode}
+	}
 	return err
 }
 
@@ -165,24 +255,51 @@ func (s *LinuxRuntimeService) List() ([]Container, error) {
 			}
 		}
 	}
+	s.reconcile(containersDir, containers)
 	return containers, nil
 }
 
+// reconcile marks containers that config.json reports as running but whose process is
+// gone (the plx process running them was killed) Exited, see reconcileScript.
+func (s *LinuxRuntimeService) reconcile(containersDir string, containers []Container) {
+	if len(runningIDs(containers)) == 0 {
+		return
+	}
+	out, err := exec.Command("sh", "-c", reconcileScript(containersDir, "/usr/local/bin/plx-shim")).Output()
+	if err != nil {
+		return
+	}
+	dead := deadContainers(string(out), containers)
+	now := time.Now()
+	for i := range containers {
+		c := &containers[i]
+		if !dead[c.ID] {
+			continue
+		}
+		c.markDead(now)
+		if data, err := json.Marshal(c); err == nil {
+			_ = os.WriteFile(filepath.Join(containersDir, c.ID, "config.json"), data, 0644)
+		}
+		_ = exec.Command("sh", "-c", cgroupCleanupScript(c.ID)).Run()
+	}
+}
+
 func (s *LinuxRuntimeService) Start(id string) error {
 	fmt.Println("Start not fully implemented for Linux Native yet.")
 	return nil
 }
 
-func (s *LinuxRuntimeService) Stop(id string) error {
+func (s *LinuxRuntimeService) Stop(id string, timeout time.Duration) error {
 	fmt.Println("Stop not fully implemented for Linux Native yet (requires PID tracking).")
 	return nil
 }
 
-func (s *LinuxRuntimeService) Logs(id string) (string, error) {
-	return "", fmt.Errorf("logs are not captured in native mode yet (stdout is attached)")
+func (s *LinuxRuntimeService) Logs(ctx context.Context, id string, opts LogOptions, w io.Writer) error {
+	return fmt.Errorf("logs are not captured in native mode yet (stdout is attached)")
 }
 
 func (s *LinuxRuntimeService) Remove(id string) error {
+	_ = exec.Command("sh", "-c", cgroupCleanupScript(id)).Run()
 	containerDir := filepath.Join(s.rootDir, "containers", id)
 	return os.RemoveAll(containerDir)
 }
@@ -194,6 +311,121 @@ func (s *LinuxRuntimeService) Update(id string, opts RunOptions) error {
 	return fmt.Errorf("update not implemented")
 }
 
+// RestoreContainers has nothing to do: native containers only run in the foreground.
+func (s *LinuxRuntimeService) RestoreContainers(all bool) error {
+	return nil
+}
+
+// Stats reads the cgroup counters of the running containers. Native containers share
+// the host network, so there are no per-container network counters.
+func (s *LinuxRuntimeService) Stats() ([]ContainerStats, error) {
+	containers, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	ids := runningIDs(containers)
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	out, err := exec.Command("sh", "-c", statsScript(ids, false)).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read container stats: %w", err)
+	}
+	return parseStats(string(out), containers), nil
+}
+
+// Top lists the processes of a running container, found through its plx-shim parent.
+func (s *LinuxRuntimeService) Top(id string, psArgs []string) (*ContainerTop, error) {
+	rootfsDir := filepath.Join(s.rootDir, "containers", id, "rootfs")
+	out, err := exec.Command("sh", "-c", topScript("/usr/local/bin/plx-shim", rootfsDir, "", psArgs)).Output()
+	if exitCodeOf(err) == 3 {
+		return nil, fmt.Errorf("container %s is not running", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list processes of container %s: %w", id, err)
+	}
+	return parseTop(string(out), psArgs)
+}
+
+// hostCopyPath makes a host path of plx cp absolute, keeping a trailing "/." or "/".
+func hostCopyPath(hostPath string) (string, error) {
+	p, err := filepath.Abs(hostPath)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case hostPath == "." || strings.HasSuffix(hostPath, "/."):
+		p = strings.TrimSuffix(p, "/") + "/."
+	case strings.HasSuffix(hostPath, "/"):
+		p += "/"
+	}
+	return p, nil
+}
+
+// copyCommand prepares a copy script (see archive.go) for the container's rootfs.
+func (s *LinuxRuntimeService) copyCommand(id string, build func(pidScript, rootfsDir string) string) *exec.Cmd {
+	rootfsDir := filepath.Join(s.rootDir, "containers", id, "rootfs")
+	return exec.Command("sh", "-c", build(containerPIDScript("/usr/local/bin/plx-shim", rootfsDir, ""), rootfsDir))
+}
+
+func (s *LinuxRuntimeService) CopyToContainer(id, hostPath, containerPath string, copyOwnership bool) error {
+	if _, err := os.Stat(hostPath); err != nil {
+		return err
+	}
+	src, err := hostCopyPath(hostPath)
+	if err != nil {
+		return err
+	}
+	cmd := s.copyCommand(id, func(pidScript, rootfsDir string) string {
+		return copyToScript(pidScript, src, rootfsDir, containerPath, copyOwnership)
+	})
+	if err := runCopyScript(cmd); err != nil {
+		return fmt.Errorf("failed to copy %s to %s:%s: %w", hostPath, id, containerPath, err)
+	}
+	return nil
+}
+
+func (s *LinuxRuntimeService) CopyFromContainer(id, containerPath, hostPath string) error {
+	dst, err := hostCopyPath(hostPath)
+	if err != nil {
+		return err
+	}
+	cmd := s.copyCommand(id, func(pidScript, rootfsDir string) string {
+		return copyFromScript(pidScript, rootfsDir, containerPath, dst)
+	})
+	if err := runCopyScript(cmd); err != nil {
+		return fmt.Errorf("failed to copy %s:%s to %s: %w", id, containerPath, hostPath, err)
+	}
+	return nil
+}
+
+func (s *LinuxRuntimeService) GetArchive(id, containerPath string, w io.Writer) error {
+	cmd := s.copyCommand(id, func(pidScript, rootfsDir string) string {
+		return getArchiveScript(pidScript, rootfsDir, containerPath)
+	})
+	cmd.Stdout = w
+	if err := runCopyScript(cmd); err != nil {
+		return fmt.Errorf("failed to archive %s:%s: %w", id, containerPath, err)
+	}
+	return nil
+}
+
+func (s *LinuxRuntimeService) PutArchive(id, containerPath string, r io.Reader, copyOwnership bool) error {
+	cmd := s.copyCommand(id, func(pidScript, rootfsDir string) string {
+		return putArchiveScript(pidScript, rootfsDir, containerPath, copyOwnership)
+	})
+	cmd.Stdin = r
+	if err := runCopyScript(cmd); err != nil {
+		return fmt.Errorf("failed to extract the archive to %s:%s: %w", id, containerPath, err)
+	}
+	return nil
+}
+
+// Networks is empty: native Linux containers share the host network.
+func (s *LinuxRuntimeService) Networks() []Network {
+	return []Network{}
+}
+
 func (s *LinuxRuntimeService) Exec(id string, cmd []string, interactive bool) error {
 	return fmt.Errorf("exec not implemented for native linux yet")
 }
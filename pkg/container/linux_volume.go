@@ -4,6 +4,7 @@ package container
 
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 )
@@ -37,3 +38,11 @@ func (s *LinuxVolumeService) List() ([]string, error) {
 	}
 	return vols, nil
 }
+
+func (s *LinuxVolumeService) Inspect(name string) (*Volume, error) {
+	volDir := filepath.Join(s.rootDir, "volumes", name)
+	if fi, err := os.Stat(volDir); err != nil || !fi.IsDir() {
+		return nil, fmt.Errorf("volume '%s' not found", name)
+	}
+	return &Volume{Name: name, Mountpoint: volDir}, nil
+}
@@ -0,0 +1,254 @@
+package container
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LogOptions selects and formats the lines returned by Logs.
+type LogOptions struct {
+	Follow     bool      // keep streaming new lines until the container exits
+	Tail       int       // only the last N lines (-1 = all, 0 = none: only new lines with Follow)
+	Since      time.Time // only lines logged at or after Since (zero = no limit)
+	Until      time.Time // only lines logged before Until (zero = no limit)
+	Timestamps bool      // prefix each line with its RFC 3339 timestamp
+}
+
+// Log drivers (--log-driver). json-file is the default; local is json-file with
+// rotation turned on by default.
+const (
+	LogDriverJSONFile = "json-file"
+	LogDriverLocal    = "local"
+	LogDriverNone     = "none"
+)
+
+// logConfig is the resolved --log-driver/--log-opt configuration.
+type logConfig struct {
+	Driver  string
+	MaxSize int64 // rotate the log after this many bytes (0 = never)
+	MaxFile int   // log files kept, including the current one
+}
+
+// logConfig resolves and checks the container's log driver and --log-opt values.
+func (o RunOptions) logConfig() (logConfig, error) {
+	cfg := logConfig{Driver: o.LogDriver, MaxFile: 1}
+	switch o.LogDriver {
+	case "", LogDriverJSONFile:
+		cfg.Driver = LogDriverJSONFile
+	case LogDriverLocal:
+		cfg.MaxSize, cfg.MaxFile = 20*1024*1024, 5
+	case LogDriverNone:
+		if len(o.LogOpts) > 0 {
+			return logConfig{}, fmt.Errorf("--log-opt is not supported with --log-driver none")
+		}
+		return cfg, nil
+	default:
+		return logConfig{}, fmt.Errorf("invalid --log-driver %s (expected json-file, local or none)", o.LogDriver)
+	}
+	for _, key := range sortedKeys(o.LogOpts) {
+		val := o.LogOpts[key]
+		switch key {
+		case "max-size":
+			n, err := ParseMemoryBytes(val)
+			if err != nil || n <= 0 {
+				return logConfig{}, fmt.Errorf("invalid --log-opt max-size=%s (expected e.g. 10m)", val)
+			}
+			cfg.MaxSize = n
+		case "max-file":
+			n, err := strconv.Atoi(val)
+			if err != nil || n < 1 {
+				return logConfig{}, fmt.Errorf("invalid --log-opt max-file=%s (expected a number >= 1)", val)
+			}
+			cfg.MaxFile = n
+		default:
+			return logConfig{}, fmt.Errorf("unknown --log-opt %s for log driver %s (supported: max-size, max-file)", key, cfg.Driver)
+		}
+	}
+	if _, ok := o.LogOpts["max-file"]; ok && cfg.MaxSize == 0 {
+		return logConfig{}, fmt.Errorf("--log-opt max-file requires max-size")
+	}
+	return cfg, nil
+}
+
+// ValidateLogConfig checks --log-driver and --log-opt before anything is created.
+func ValidateLogConfig(o RunOptions) error {
+	_, err := o.logConfig()
+	return err
+}
+
+// logTagger marks each line with its stream ("o " or "e ") for logWriter.
+// fflush keeps the log current for plx logs -f.
+const logTagger = `awk '{ print "%s " $0; fflush() }'`
+
+// logWriter writes the tagged lines as JSON lines ({"log","stream","time"}, as Docker's
+// json-file driver does) to $file and rotates it to $file.1 ... when it would grow past
+// $maxsize. Control characters are escaped as \u00XX.
+const logWriter = `TZ=UTC0 awk -v file=%s -v maxsize=%d -v maxfile=%d '
+BEGIN {
+  for (i = 1; i < 32; i++) ctl[sprintf("%%c", i)] = sprintf("\\u%%04x", i)
+  ctlre = "[" sprintf("%%c", 1) "-" sprintf("%%c", 31) "]"
+}
+function join(s, sep, rep,   n, p, i, out) {
+  n = split(s, p, sep); out = p[1]
+  for (i = 2; i <= n; i++) out = out rep p[i]
+  return out
+}
+function esc(s,   i, c, out) {
+  s = join(join(s, "\\", "\\\\"), "\"", "\\\"")
+  if (s !~ ctlre) return s
+  out = ""
+  for (i = 1; i <= length(s); i++) { c = substr(s, i, 1); out = out ((c in ctl) ? ctl[c] : c) }
+  return out
+}
+function rotate(   i) {
+  close(file)
+  for (i = maxfile - 1; i >= 1; i--) system("mv -f \"" file (i > 1 ? "." (i - 1) : "") "\" \"" file "." i "\" 2>/dev/null")
+  if (maxfile <= 1) printf "" > file
+  size = 0
+}
+{
+  stream = substr($0, 1, 1) == "e" ? "stderr" : "stdout"
+  line = "{\"log\":\"" esc(substr($0, 3)) "\\n\",\"stream\":\"" stream "\",\"time\":\"" strftime("%%Y-%%m-%%dT%%H:%%M:%%SZ", systime()) "\"}"
+  if (maxsize > 0 && size > 0 && size + length(line) + 1 > maxsize) rotate()
+  print line >> file
+  fflush(file)
+  size += length(line) + 1
+}'`
+
+// loggedCommand wraps a container command for run.sh according to the log driver:
+// stdout and stderr are tagged and merged into one logWriter, so that rotation has a
+// single writer. The exit status of a pipeline is the writer's, so the command's own
+// status is saved in codeFile.
+func loggedCommand(command, logFile, codeFile string, cfg logConfig) string {
+	run := fmt.Sprintf("{ %s; echo $? > %s; }", command, codeFile)
+	if cfg.Driver == LogDriverNone {
+		return run + " > /dev/null 2>&1"
+	}
+	return fmt.Sprintf("{ { %s 2>&3 3>&- 4>&- | %s; } 3>&1 1>&4 | %s; } 4>&1 | %s",
+		run, fmt.Sprintf(logTagger, "o"), fmt.Sprintf(logTagger, "e"),
+		fmt.Sprintf(logWriter, shellQuote(logFile), cfg.MaxSize, cfg.MaxFile))
+}
+
+// logReadScript prints the container's log for Logs, oldest rotated file first. It exits
+// with status 3 if there is no log yet and 4 if logging is disabled. Containers created
+// before log drivers have only console.log. With Follow it keeps printing new lines
+// (across rotations) while config.json says the container is running (the restart
+// policy may start it again).
+func logReadScript(logFile, legacyLogFile, configFile string, opts LogOptions) string {
+	from := "+1"
+	if opts.Tail >= 0 {
+		from = fmt.Sprint(opts.Tail)
+	}
+	script := fmt.Sprintf(`CONFIG=%s
+grep -q '"LogDriver":"none"' "$CONFIG" 2>/dev/null && exit 4
+LOG=%s
+[ -f "$LOG" ] || LOG=%s
+[ -f "$LOG" ] || exit 3
+rotated() { ls -1 "$LOG".[0-9]* 2>/dev/null | awk -F. '{ print $NF, $0 }' | sort -rn | cut -d' ' -f2- | xargs -r cat; }
+SIZE=$(wc -c < "$LOG")
+{ rotated; head -c "$SIZE" "$LOG"; } | tail -n %s
+`, shellQuote(configFile), shellQuote(logFile), shellQuote(legacyLogFile), from)
+	if !opts.Follow {
+		return script
+	}
+	return script + `tail -c +$((SIZE + 1)) -F "$LOG" 2>/dev/null &
+T=$!
+while grep -Eq '"status":"(Running|Restarting)"' "$CONFIG" 2>/dev/null; do sleep 1; done
+sleep 1
+kill "$T"
+`
+}
+
+// errLogsUntil stops copyLogs at the first line after LogOptions.Until.
+var errLogsUntil = errors.New("reached --until")
+
+// copyLogs copies the log lines from r to w that match opts, with or without their
+// timestamps. Lines without a timestamp (written before logs were timestamped, or by
+// run.sh itself) are only shown when no time range is given.
+func copyLogs(r io.Reader, w io.Writer, opts LogOptions) error {
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadString('\n')
+		if line != "" {
+			text, ts, perr := parseLogLine(line)
+			switch {
+			case perr != nil:
+				if !opts.Since.IsZero() || !opts.Until.IsZero() {
+					text = ""
+				}
+			case !opts.Until.IsZero() && !ts.Before(opts.Until):
+				return errLogsUntil
+			case !opts.Since.IsZero() && ts.Before(opts.Since):
+				text = ""
+			case opts.Timestamps:
+				text = ts.Format(time.RFC3339Nano) + " " + text
+			}
+			if text != "" {
+				if _, werr := io.WriteString(w, text); werr != nil {
+					return werr
+				}
+				if f, ok := w.(interface{ Flush() }); ok && opts.Follow {
+					f.Flush()
+				}
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// logEntry is one line written by logWriter.
+type logEntry struct {
+	Log    string    `json:"log"`
+	Stream string    `json:"stream"`
+	Time   time.Time `json:"time"`
+}
+
+// parseLogLine returns the text and time of a log line: a JSON line from logWriter, or
+// "<RFC 3339 time> <text>" as written before log drivers. Other lines are returned as
+// they are, with an error.
+func parseLogLine(line string) (string, time.Time, error) {
+	if strings.HasPrefix(line, "{") {
+		var e logEntry
+		if err := json.Unmarshal([]byte(line), &e); err == nil {
+			if !strings.HasSuffix(e.Log, "\n") {
+				e.Log += "\n"
+			}
+			return e.Log, e.Time, nil
+		}
+	}
+	stamp, rest, _ := strings.Cut(line, " ")
+	ts, err := time.Parse(time.RFC3339, stamp)
+	if err != nil {
+		return line, time.Time{}, err
+	}
+	return rest, ts, nil
+}
+
+// ParseLogTime parses a --since/--until value: an RFC 3339 time, a date (2006-01-02),
+// Unix seconds, or a duration relative to now (10m, 1h30m).
+func ParseLogTime(s string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	var secs int64
+	if _, err := fmt.Sscanf(s, "%d", &secs); err == nil && fmt.Sprint(secs) == s {
+		return time.Unix(secs, 0), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q (expected e.g. 2024-01-02T15:04:05Z, 2024-01-02, Unix seconds or 10m)", s)
+}
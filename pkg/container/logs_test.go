@@ -0,0 +1,218 @@
+package container
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseLogLine(t *testing.T) {
+	at := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name, line, text string
+		ts               time.Time
+		err              bool
+	}{
+		{"json line", `{"log":"hello\n","stream":"stdout","time":"2024-01-02T15:04:05Z"}` + "\n", "hello\n", at, false},
+		{"json line without newline", `{"log":"a \"b\"","stream":"stderr","time":"2024-01-02T15:04:05Z"}`, "a \"b\"\n", at, false},
+		{"legacy timestamped line", "2024-01-02T15:04:05Z legacy text\n", "legacy text\n", at, false},
+		{"plain line", "no timestamp here\n", "no timestamp here\n", time.Time{}, true},
+		{"broken json", "{not json\n", "{not json\n", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		text, ts, err := parseLogLine(tt.line)
+		if text != tt.text || !ts.Equal(tt.ts) || (err != nil) != tt.err {
+			t.Errorf("%s: got %q, %v, %v", tt.name, text, ts, err)
+		}
+	}
+}
+
+func TestParseLogTime(t *testing.T) {
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	tests := []struct {
+		in   string
+		want time.Time
+		err  bool
+	}{
+		{"10m", now.Add(-10 * time.Minute), false},
+		{"1h30m", now.Add(-90 * time.Minute), false},
+		{"2024-01-02T10:00:00Z", time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC), false},
+		{"2024-01-02T10:00:00.5+09:00", time.Date(2024, 1, 2, 1, 0, 0, 5e8, time.UTC), false},
+		{"2024-01-02T10:00:00", time.Date(2024, 1, 2, 10, 0, 0, 0, time.Local), false},
+		{"2024-01-02", time.Date(2024, 1, 2, 0, 0, 0, 0, time.Local), false},
+		{"1704207845", time.Unix(1704207845, 0), false},
+		{"yesterday", time.Time{}, true},
+		{"12abc", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseLogTime(tt.in, now)
+		if (err != nil) != tt.err || !got.Equal(tt.want) {
+			t.Errorf("ParseLogTime(%q) = %v, %v, want %v", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestCopyLogs(t *testing.T) {
+	log := "legacy line without a time\n" +
+		`{"log":"one\n","stream":"stdout","time":"2024-01-02T10:00:00Z"}` + "\n" +
+		"2024-01-02T11:00:00Z two\n" +
+		`{"log":"three\n","stream":"stderr","time":"2024-01-02T12:00:00Z"}` + "\n"
+	at := func(hour int) time.Time { return time.Date(2024, 1, 2, hour, 0, 0, 0, time.UTC) }
+	tests := []struct {
+		name string
+		opts LogOptions
+		want string
+	}{
+		{"all", LogOptions{}, "legacy line without a time\none\ntwo\nthree\n"},
+		{"timestamps", LogOptions{Timestamps: true},
+			"legacy line without a time\n2024-01-02T10:00:00Z one\n2024-01-02T11:00:00Z two\n2024-01-02T12:00:00Z three\n"},
+		{"since drops untimed lines", LogOptions{Since: at(11)}, "two\nthree\n"},
+		{"until is exclusive", LogOptions{Until: at(11)}, "one\n"},
+		{"since and until", LogOptions{Since: at(10), Until: at(12)}, "one\ntwo\n"},
+	}
+	for _, tt := range tests {
+		var out strings.Builder
+		err := copyLogs(strings.NewReader(log), &out, tt.opts)
+		if err != nil && err != errLogsUntil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		if out.String() != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, out.String(), tt.want)
+		}
+	}
+}
+
+func TestLogReadScriptTail(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a POSIX shell")
+	}
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"container.log.2": "1\n2\n",
+		"container.log.1": "3\n",
+		"container.log":   "4\n5\n",
+		"config.json":     `{"status":"Exited"}`,
+	})
+	tests := []struct {
+		tail int
+		want string
+	}{
+		{-1, "1\n2\n3\n4\n5\n"},
+		{0, ""},
+		{2, "4\n5\n"},
+		{4, "2\n3\n4\n5\n"},
+		{10, "1\n2\n3\n4\n5\n"},
+	}
+	for _, tt := range tests {
+		script := logReadScript(filepath.Join(dir, "container.log"), filepath.Join(dir, "console.log"),
+			filepath.Join(dir, "config.json"), LogOptions{Tail: tt.tail})
+		out, err := exec.Command("sh", "-c", script).Output()
+		if err != nil {
+			t.Fatalf("tail %d: %v", tt.tail, err)
+		}
+		if string(out) != tt.want {
+			t.Errorf("tail %d: got %q, want %q", tt.tail, out, tt.want)
+		}
+	}
+}
+
+func TestLogConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		driver string
+		opts   map[string]string
+		want   logConfig
+		err    bool
+	}{
+		{"default", "", nil, logConfig{Driver: LogDriverJSONFile, MaxFile: 1}, false},
+		{"json-file with rotation", LogDriverJSONFile, map[string]string{"max-size": "10m", "max-file": "3"},
+			logConfig{Driver: LogDriverJSONFile, MaxSize: 10 << 20, MaxFile: 3}, false},
+		{"json-file max-size only", LogDriverJSONFile, map[string]string{"max-size": "1k"},
+			logConfig{Driver: LogDriverJSONFile, MaxSize: 1024, MaxFile: 1}, false},
+		{"local defaults", LogDriverLocal, nil, logConfig{Driver: LogDriverLocal, MaxSize: 20 << 20, MaxFile: 5}, false},
+		{"local max-file", LogDriverLocal, map[string]string{"max-file": "2"},
+			logConfig{Driver: LogDriverLocal, MaxSize: 20 << 20, MaxFile: 2}, false},
+		{"none", LogDriverNone, nil, logConfig{Driver: LogDriverNone, MaxFile: 1}, false},
+		{"none with options", LogDriverNone, map[string]string{"max-size": "1m"}, logConfig{}, true},
+		{"unknown driver", "syslog", nil, logConfig{}, true},
+		{"unknown option", LogDriverJSONFile, map[string]string{"compress": "true"}, logConfig{}, true},
+		{"invalid max-size", LogDriverJSONFile, map[string]string{"max-size": "big"}, logConfig{}, true},
+		{"zero max-size", LogDriverJSONFile, map[string]string{"max-size": "0"}, logConfig{}, true},
+		{"invalid max-file", LogDriverJSONFile, map[string]string{"max-size": "1m", "max-file": "0"}, logConfig{}, true},
+		{"max-file without max-size", LogDriverJSONFile, map[string]string{"max-file": "3"}, logConfig{}, true},
+	}
+	for _, tt := range tests {
+		got, err := RunOptions{LogDriver: tt.driver, LogOpts: tt.opts}.logConfig()
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("%s: got %+v, %v", tt.name, got, err)
+		}
+		if verr := ValidateLogConfig(RunOptions{LogDriver: tt.driver, LogOpts: tt.opts}); (verr != nil) != tt.err {
+			t.Errorf("%s: ValidateLogConfig = %v", tt.name, verr)
+		}
+	}
+}
+
+func TestLogWriter(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a POSIX shell")
+	}
+	dir := t.TempDir()
+	logFile := filepath.Join(dir, "container.log")
+	lines := []string{
+		"plain",
+		`back\slash and "quotes"`,
+		"tab\there, bell\a and escape\033[0m",
+		"unicode ✓",
+	}
+	var input strings.Builder
+	for i, l := range lines {
+		stream := "o"
+		if i%2 == 1 {
+			stream = "e"
+		}
+		fmt.Fprintf(&input, "%s %s\n", stream, l)
+	}
+	cmd := exec.Command("sh", "-c", "printf '%b' \"$1\" | "+fmt.Sprintf(logWriter, shellQuote(logFile), 0, 1), "sh", input.String())
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("logWriter failed: %v\n%s", err, out)
+	}
+	data, err := os.ReadFile(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	written := strings.SplitAfter(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(written) != len(lines) {
+		t.Fatalf("wrote %d lines, want %d:\n%s", len(written), len(lines), data)
+	}
+	for i, line := range written {
+		text, ts, err := parseLogLine(line)
+		if err != nil {
+			t.Errorf("line %d is not valid JSON: %v\n%s", i, err, line)
+			continue
+		}
+		if text != lines[i]+"\n" || time.Since(ts) > time.Minute {
+			t.Errorf("line %d: got %q at %v, want %q", i, text, ts, lines[i])
+		}
+	}
+
+	// Rotation keeps max-file files of at most max-size bytes
+	rotated := filepath.Join(dir, "rotated.log")
+	script := fmt.Sprintf("for i in 1 2 3 4 5 6; do echo \"o line $i\"; done | "+logWriter, shellQuote(rotated), 150, 2)
+	if out, err := exec.Command("sh", "-c", script).CombinedOutput(); err != nil {
+		t.Fatalf("logWriter failed: %v\n%s", err, out)
+	}
+	files, _ := filepath.Glob(rotated + "*")
+	if len(files) != 2 {
+		t.Errorf("rotation kept %q, want 2 files", files)
+	}
+	for _, f := range files {
+		if st, err := os.Stat(f); err != nil || st.Size() > 150 {
+			t.Errorf("%s is larger than max-size", f)
+		}
+	}
+}
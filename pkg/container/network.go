@@ -100,6 +100,11 @@ func (m *BridgeNetworkManager) SetupBridge() error {
 	return nil
 }
 
+// Info describes the bridge for plx inspect (without its containers).
+func (m *BridgeNetworkManager) Info() Network {
+	return Network{Name: m.bridgeName, Driver: "bridge", Subnet: m.subnet, Gateway: m.gatewayIP}
+}
+
 func (m *BridgeNetworkManager) AllocateIP() (string, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
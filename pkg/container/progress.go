@@ -0,0 +1,330 @@
+package container
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// BuildEventType identifies a build progress event.
+type BuildEventType string
+
+const (
+	BuildStarted   BuildEventType = "build"      // Image, Message: base image
+	StepStarted    BuildEventType = "step"       // Instruction
+	StepCached     BuildEventType = "cached"     // Instruction
+	StepOutput     BuildEventType = "output"     // Message: one line of output
+	StepCheckpoint BuildEventType = "checkpoint" // Message: summary of the saved layer
+	BuildStatus    BuildEventType = "status"     // long-running work; repeated while it runs, Done when finished
+	BuildInfo      BuildEventType = "info"
+	BuildWarning   BuildEventType = "warning"
+	BuildFinished  BuildEventType = "finished" // Image
+	BuildFailed    BuildEventType = "error"    // Message: the error
+)
+
+// BuildEvent is a single build progress notification.
+type BuildEvent struct {
+	Type        BuildEventType `json:"type"`
+	Time        time.Time      `json:"time"`
+	Stage       string         `json:"stage,omitempty"` // stage name in multi-stage builds
+	Step        int            `json:"step,omitempty"`  // 1-based step index within the stage, 0 for build-level events
+	Total       int            `json:"total,omitempty"`
+	Instruction string         `json:"instruction,omitempty"` // e.g. "RUN apk add git"
+	Image       string         `json:"image,omitempty"`
+	Message     string         `json:"message,omitempty"`
+	Elapsed     time.Duration  `json:"elapsed,omitempty"`
+	Done        bool           `json:"done,omitempty"`
+}
+
+// BuildProgress receives build events. Implementations must be safe for concurrent use.
+type BuildProgress interface {
+	Event(e BuildEvent)
+}
+
+// NewBuildProgress returns the renderer for `plx build --progress`:
+// "tty" (interactive, redraws status lines), "plain" (one line per event), "json"
+// (one JSON object per line) or "auto" (tty on a terminal, plain otherwise).
+func NewBuildProgress(mode string, w io.Writer) (BuildProgress, error) {
+	switch mode {
+	case "", "auto":
+		if isTerminal(w) {
+			return &ttyProgress{w: w}, nil
+		}
+		return &plainProgress{w: w}, nil
+	case "tty":
+		return &ttyProgress{w: w}, nil
+	case "plain":
+		return &plainProgress{w: w}, nil
+	case "json":
+		return &jsonProgress{enc: json.NewEncoder(w)}, nil
+	}
+	return nil, fmt.Errorf("invalid progress mode %q (expected auto, tty, plain or json)", mode)
+}
+
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	st, err := f.Stat()
+	return err == nil && st.Mode()&os.ModeCharDevice != 0
+}
+
+// ttyProgress reproduces the interactive output: status lines are redrawn in place.
+type ttyProgress struct {
+	mu         sync.Mutex
+	w          io.Writer
+	statusOpen bool
+}
+
+func (p *ttyProgress) Event(e BuildEvent) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if e.Type == BuildStatus && !e.Done {
+		fmt.Fprintf(p.w, "\x1b[2K\r%s... (%ds elapsed)", e.Message, int(e.Elapsed.Seconds()))
+		p.statusOpen = true
+		return
+	}
+	if p.statusOpen {
+		fmt.Fprint(p.w, "\x1b[2K\r")
+		p.statusOpen = false
+	}
+	switch e.Type {
+	case BuildStarted:
+		fmt.Fprintf(p.w, "Building image '%s' from %s...\n", e.Image, e.Message)
+	case StepStarted:
+		fmt.Fprintf(p.w, "[%s] %s\n", stepPosition(e), e.Instruction)
+	case StepCached:
+		fmt.Fprintf(p.w, "[%s] CACHED %s\n", stepPosition(e), e.Instruction)
+	case StepOutput, BuildInfo:
+		fmt.Fprintln(p.w, e.Message)
+	case StepCheckpoint:
+		fmt.Fprintf(p.w, "Checkpoint saved (step %s): %s\n", stepPosition(e), e.Message)
+	case BuildStatus:
+		fmt.Fprintf(p.w, "%s... done. (%s)\n", e.Message, e.Elapsed.Round(time.Second))
+	case BuildWarning:
+		fmt.Fprintf(p.w, "Warning: %s\n", e.Message)
+	case BuildFinished:
+		fmt.Fprintf(p.w, "\nSuccessfully built image '%s'\n", e.Image)
+	}
+	// BuildFailed: the caller prints the returned error
+}
+
+// plainProgress writes one line per event, prefixed with the step number, for CI logs.
+type plainProgress struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (p *plainProgress) Event(e BuildEvent) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	prefix := "#0"
+	if e.Step > 0 {
+		prefix = fmt.Sprintf("#%d", e.Step)
+	}
+	if e.Stage != "" {
+		// Stages run in parallel: keep their lines apart
+		prefix = "#" + e.Stage
+		if e.Step > 0 {
+			prefix += fmt.Sprintf("/%d", e.Step)
+		}
+	}
+	switch e.Type {
+	case BuildStarted:
+		fmt.Fprintf(p.w, "%s building %s from %s\n", prefix, e.Image, e.Message)
+	case StepStarted:
+		fmt.Fprintf(p.w, "%s [%s] %s\n", prefix, stepPosition(e), e.Instruction)
+	case StepCached:
+		fmt.Fprintf(p.w, "%s [%s] CACHED %s\n", prefix, stepPosition(e), e.Instruction)
+	case StepOutput, BuildInfo:
+		fmt.Fprintf(p.w, "%s %s\n", prefix, e.Message)
+	case StepCheckpoint:
+		fmt.Fprintf(p.w, "%s checkpoint: %s\n", prefix, e.Message)
+	case BuildStatus:
+		// Only the start and the end, no periodic redraws
+		if e.Done {
+			fmt.Fprintf(p.w, "%s %s done (%s)\n", prefix, e.Message, e.Elapsed.Round(time.Millisecond))
+		} else if e.Elapsed == 0 {
+			fmt.Fprintf(p.w, "%s %s...\n", prefix, e.Message)
+		}
+	case BuildWarning:
+		fmt.Fprintf(p.w, "%s WARNING: %s\n", prefix, e.Message)
+	case BuildFinished:
+		fmt.Fprintf(p.w, "%s DONE image %s\n", prefix, e.Image)
+	case BuildFailed:
+		fmt.Fprintf(p.w, "%s ERROR: %s\n", prefix, e.Message)
+	}
+}
+
+// jsonProgress writes every event as a JSON object on its own line.
+type jsonProgress struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func (p *jsonProgress) Event(e BuildEvent) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_ = p.enc.Encode(e)
+}
+
+// stepPosition formats "2/5", or "builder 2/5" in multi-stage builds.
+func stepPosition(e BuildEvent) string {
+	if e.Stage != "" {
+		return fmt.Sprintf("%s %d/%d", e.Stage, e.Step, e.Total)
+	}
+	return fmt.Sprintf("%d/%d", e.Step, e.Total)
+}
+
+// stepReporter tags events with the step they belong to (Step 0 = the whole build).
+type stepReporter struct {
+	progress    BuildProgress
+	stage       string
+	step, total int
+	instruction string
+}
+
+func (r stepReporter) emit(e BuildEvent) {
+	e.Time = time.Now()
+	if e.Step == 0 {
+		e.Step, e.Total, e.Instruction = r.step, r.total, r.instruction
+	}
+	if e.Stage == "" {
+		e.Stage = r.stage
+	}
+	r.progress.Event(e)
+}
+
+// forStep returns a reporter for step i (0-based) of n in the same stage.
+func (r stepReporter) forStep(i, n int, instr Instruction) stepReporter {
+	return stepReporter{progress: r.progress, stage: r.stage, step: i + 1, total: n, instruction: instr.Type + " " + instr.Raw}
+}
+
+// BuildStepError is returned when a build step fails.
+type BuildStepError struct {
+	Stage       string // "" for single-stage builds
+	Step, Total int
+	Instruction string
+	Err         error
+}
+
+func (e *BuildStepError) Error() string {
+	if e.Stage != "" {
+		return fmt.Sprintf("stage %s, step %d/%d (%s): %v", e.Stage, e.Step, e.Total, e.Instruction, e.Err)
+	}
+	return fmt.Sprintf("step %d/%d (%s): %v", e.Step, e.Total, e.Instruction, e.Err)
+}
+
+func (e *BuildStepError) Unwrap() error {
+	return e.Err
+}
+
+// fail attaches the step to err.
+func (r stepReporter) fail(err error) error {
+	if r.step == 0 {
+		return err
+	}
+	return &BuildStepError{Stage: r.stage, Step: r.step, Total: r.total, Instruction: r.instruction, Err: err}
+}
+
+// reportFailure emits the error event for a failed build.
+func (r stepReporter) reportFailure(err error) {
+	e := BuildEvent{Type: BuildFailed, Message: err.Error()}
+	var stepErr *BuildStepError
+	if errors.As(err, &stepErr) {
+		e.Stage, e.Step, e.Total, e.Instruction, e.Message = stepErr.Stage, stepErr.Step, stepErr.Total, stepErr.Instruction, stepErr.Err.Error()
+	}
+	r.emit(e)
+}
+
+// Logf reports one line of step output.
+func (r stepReporter) Logf(format string, a ...any) {
+	r.emit(BuildEvent{Type: StepOutput, Message: fmt.Sprintf(format, a...)})
+}
+
+// Warnf reports a warning.
+func (r stepReporter) Warnf(format string, a ...any) {
+	r.emit(BuildEvent{Type: BuildWarning, Message: fmt.Sprintf(format, a...)})
+}
+
+// Track runs fn and reports its elapsed time every second until it returns.
+func (r stepReporter) Track(msg string, fn func() error) error {
+	start := time.Now()
+	r.emit(BuildEvent{Type: BuildStatus, Message: msg})
+
+	done := make(chan error, 1)
+	go func() {
+		done <- fn()
+	}()
+
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case err := <-done:
+			if err == nil {
+				r.emit(BuildEvent{Type: BuildStatus, Message: msg, Elapsed: time.Since(start), Done: true})
+			}
+			return err
+		case <-ticker.C:
+			r.emit(BuildEvent{Type: BuildStatus, Message: msg, Elapsed: time.Since(start)})
+		}
+	}
+}
+
+// Writer returns a writer that reports every line written to it as step output.
+// Close flushes a trailing line without a newline.
+func (r stepReporter) Writer() io.WriteCloser {
+	return &lineWriter{report: r}
+}
+
+type lineWriter struct {
+	mu     sync.Mutex
+	report stepReporter
+	buf    []byte
+}
+
+func (w *lineWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf = append(w.buf, b...)
+	for {
+		// Progress bars redraw with \r: treat it as a line break too
+		i := bytes.IndexAny(w.buf, "\r\n")
+		if i < 0 {
+			break
+		}
+		if line := string(w.buf[:i]); line != "" {
+			w.report.Logf("%s", line)
+		}
+		w.buf = w.buf[i+1:]
+	}
+	return len(b), nil
+}
+
+func (w *lineWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.buf) > 0 {
+		w.report.Logf("%s", string(w.buf))
+		w.buf = nil
+	}
+	return nil
+}
+
+// progress returns the configured renderer, defaulting to auto-detection on stdout.
+func (o BuildOptions) progress() BuildProgress {
+	if o.Progress != nil {
+		return o.Progress
+	}
+	p, _ := NewBuildProgress("auto", os.Stdout)
+	return p
+}
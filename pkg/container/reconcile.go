@@ -0,0 +1,68 @@
+package container
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// reconcileGrace is how long after its config.json was written a container is left
+// alone by reconcileScript: it is being started and its process may not exist yet.
+const reconcileGrace = 10 * time.Second
+
+// reconcileScript prints "state <id> <alive> <netns>" (1 or 0) for every container in
+// containersDir whose config.json says it is running or restarting. A container is alive
+// while its supervisor (run.sh) or its process (the recorded PID, checked against the
+// command line of shim, see containerPIDFunc) exists; netns tells whether its network
+// namespace does.
+func reconcileScript(containersDir, shim string) string {
+	return containerPIDFunc + fmt.Sprintf(`NOW=$(date +%%s)
+for C in %s/*/config.json; do
+  [ -f "$C" ] || continue
+  grep -Eq '"status":"(Running|Restarting)"' "$C" || continue
+  [ $((NOW - $(stat -c %%Y "$C"))) -ge %d ] || continue
+  D=${C%%/config.json}
+  ID=${D##*/}
+  ALIVE=1
+  if ! pgrep -f "$D/run[.]sh" >/dev/null; then
+    container_pid %s "$D/rootfs" "$D/shim.pid"
+    [ -n "$PID" ] || ALIVE=0
+  fi
+  NETNS=0
+  [ -e "/run/netns/$ID" ] && NETNS=1
+  echo "state $ID $ALIVE $NETNS"
+done
+`, shellQuote(containersDir), int(reconcileGrace/time.Second), shellQuote(shim))
+}
+
+// deadContainers reads the output of reconcileScript and returns the IDs of the
+// containers that are no longer running: their process is gone or, for a container on
+// the bridge network, its network namespace is (WSL was shut down).
+func deadContainers(out string, containers []Container) map[string]bool {
+	bridged := map[string]bool{}
+	for _, c := range containers {
+		bridged[c.ID] = c.IP != "" && c.IP != "127.0.0.1"
+	}
+	dead := map[string]bool{}
+	for _, line := range strings.Split(out, "\n") {
+		f := strings.Fields(line)
+		if len(f) != 4 || f[0] != "state" {
+			continue
+		}
+		if f[2] == "0" || (bridged[f[1]] && f[3] == "0") {
+			dead[f[1]] = true
+		}
+	}
+	return dead
+}
+
+// markDead records that the container's process was found gone: it exited for an
+// unknown reason with an unknown exit code (-1). FinishedAt is when it was found.
+func (c *Container) markDead(now time.Time) {
+	c.Status = "Exited"
+	c.Health = ""
+	c.ExitReason = "unknown"
+	c.ExitCode = -1
+	c.Pid = 0
+	c.FinishedAt = now
+}
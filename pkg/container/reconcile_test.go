@@ -0,0 +1,87 @@
+package container
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDeadContainers(t *testing.T) {
+	containers := []Container{
+		{ID: "bridged", IP: "10.10.0.2"},
+		{ID: "host", IP: "127.0.0.1"},
+		{ID: "none"},
+		{ID: "bridged-alive", IP: "10.10.0.3"},
+	}
+	out := "state bridged 1 0\n" + // alive, but its network namespace is gone
+		"state host 1 0\n" +
+		"state none 0 0\n" +
+		"state bridged-alive 1 1\n" +
+		"garbage\nstate short 0\n" +
+		"state unknown 0 1\n"
+	want := map[string]bool{"bridged": true, "none": true, "unknown": true}
+	if got := deadContainers(out, containers); !reflect.DeepEqual(got, want) {
+		t.Errorf("deadContainers = %v, want %v", got, want)
+	}
+}
+
+func TestMarkDead(t *testing.T) {
+	now := time.Now()
+	c := Container{Status: "Running", Health: "healthy", ExitReason: "stopped", ExitCode: 0, Pid: 42}
+	c.markDead(now)
+	want := Container{Status: "Exited", ExitReason: "unknown", ExitCode: -1, FinishedAt: now}
+	if !reflect.DeepEqual(c, want) {
+		t.Errorf("markDead: got %+v, want %+v", c, want)
+	}
+}
+
+func TestReconcileScript(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("needs /proc and procps")
+	}
+	if _, err := exec.LookPath("pgrep"); err != nil {
+		t.Skip("pgrep is not available")
+	}
+	dir := t.TempDir()
+	old := time.Now().Add(-2 * reconcileGrace)
+	write := func(id, status string, mtime time.Time) string {
+		d := filepath.Join(dir, id)
+		data, _ := json.Marshal(Container{ID: id, Status: status})
+		writeFiles(t, d, map[string]string{"config.json": string(data), "run.sh": "sleep 10\n"})
+		if err := os.Chtimes(filepath.Join(d, "config.json"), mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+	write("dead", "Running", old)
+	write("restarting", "Restarting", old)
+	write("starting", "Running", time.Now()) // inside the grace window
+	write("exited", "Exited", old)
+	alive := write("alive", "Running", old)
+	supervisor := exec.Command("sh", filepath.Join(alive, "run.sh"))
+	if err := supervisor.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		supervisor.Process.Kill()
+		supervisor.Wait()
+	}()
+
+	out, err := exec.Command("sh", "-c", reconcileScript(dir, "container-shim")).Output()
+	if err != nil {
+		t.Fatalf("reconcile script failed: %v\n%s", err, out)
+	}
+	want := map[string]bool{"dead": true, "restarting": true}
+	if got := deadContainers(string(out), nil); !reflect.DeepEqual(got, want) {
+		t.Errorf("dead containers = %v, want %v\n%s", got, want, out)
+	}
+	if !strings.Contains(string(out), "state alive 1 ") || strings.Contains(string(out), "state starting ") {
+		t.Errorf("alive should be checked and starting left alone:\n%s", out)
+	}
+}
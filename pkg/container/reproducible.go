@@ -0,0 +1,22 @@
+package container
+
+import "fmt"
+
+// imageArchiveScript returns the shell pipeline that saves rootfs as the gzipped image
+// tarball out. It writes a unique temporary file and renames it, so snapshots
+// hard-linked to the previous image stay intact and concurrent builds of the same
+// tag never interleave.
+//
+// With --reproducible the archive only depends on the rootfs contents: entries are
+// sorted by name, owners are stored as numeric ids only, mtimes newer than
+// SOURCE_DATE_EPOCH are clamped to it (everything, when no epoch is given) and gzip
+// omits the file name and timestamp from its header. Requires GNU tar.
+func imageArchiveScript(rootfs, out string, opts BuildOptions) string {
+	tarFlags, gzipFlags := "", ""
+	if opts.Reproducible {
+		tarFlags = fmt.Sprintf(" --sort=name --format=gnu --numeric-owner --mtime=@%d --clamp-mtime", opts.SourceDateEpoch)
+		gzipFlags = " -n"
+	}
+	return fmt.Sprintf("T=$(mktemp %s) && tar -C %s%s -cf - . | gzip%s > \"$T\" && chmod 644 \"$T\" && mv \"$T\" %s",
+		shellQuote(out+".XXXXXX"), shellQuote(rootfs), tarFlags, gzipFlags, shellQuote(out))
+}
@@ -0,0 +1,54 @@
+package container
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestImageArchiveScriptReproducible(t *testing.T) {
+	if out, err := exec.Command("tar", "--version").Output(); err != nil || !bytes.Contains(out, []byte("GNU tar")) {
+		t.Skip("GNU tar is not available")
+	}
+	if _, err := exec.LookPath("gzip"); err != nil {
+		t.Skip("gzip is not available")
+	}
+	archive := func(opts BuildOptions, mtime time.Time) []byte {
+		t.Helper()
+		dir := t.TempDir()
+		rootfs := filepath.Join(dir, "rootfs")
+		writeFiles(t, rootfs, map[string]string{"b/c": "c", "a": "a", "z/y/x": "x"})
+		filepath.Walk(rootfs, func(p string, _ os.FileInfo, _ error) error {
+			return os.Chtimes(p, mtime, mtime)
+		})
+		out := filepath.Join(dir, "image.tar.gz")
+		if msg, err := exec.Command("sh", "-c", imageArchiveScript(rootfs, out, opts)).CombinedOutput(); err != nil {
+			t.Fatalf("archive script failed: %v\n%s", err, msg)
+		}
+		data, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	then, now := time.Unix(1_000_000_000, 0), time.Now()
+	tests := []struct {
+		name string
+		opts BuildOptions
+		same bool
+	}{
+		{"plain archives keep mtimes", BuildOptions{}, false},
+		{"reproducible without an epoch", BuildOptions{Reproducible: true}, true},
+		{"reproducible clamps to the epoch", BuildOptions{Reproducible: true, SourceDateEpoch: then.Unix() - 1}, true},
+	}
+	for _, tt := range tests {
+		a, b := archive(tt.opts, then), archive(tt.opts, now)
+		if bytes.Equal(a, b) != tt.same {
+			t.Errorf("%s: archives identical = %v, want %v", tt.name, !tt.same, tt.same)
+		}
+	}
+}
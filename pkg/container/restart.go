@@ -0,0 +1,193 @@
+package container
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Restart back-off: the delay starts at restartMinDelay and doubles after every
+// restart up to restartMaxDelay. A run that lasted restartResetAfter resets it.
+const (
+	restartMinDelay   = time.Second
+	restartMaxDelay   = time.Minute
+	restartResetAfter = 10 * time.Second
+)
+
+// RestartPolicy is a parsed `--restart` value.
+type RestartPolicy struct {
+	Name       string // "no", "on-failure", "always" or "unless-stopped"
+	MaxRetries int    // on-failure:N (0 = no limit)
+}
+
+// ParseRestartPolicy accepts "no", "on-failure[:N]", "always" and "unless-stopped".
+// "" is the same as "no".
+func ParseRestartPolicy(s string) (RestartPolicy, error) {
+	name, count, hasCount := strings.Cut(strings.TrimSpace(s), ":")
+	p := RestartPolicy{Name: name}
+	switch name {
+	case "", "no":
+		p.Name = "no"
+	case "on-failure":
+		if hasCount {
+			n, err := strconv.Atoi(count)
+			if err != nil || n < 0 {
+				return RestartPolicy{}, fmt.Errorf("invalid restart policy %s: the retry count must be a non-negative integer", s)
+			}
+			p.MaxRetries = n
+		}
+		return p, nil
+	case "always", "unless-stopped":
+	default:
+		return RestartPolicy{}, fmt.Errorf("invalid restart policy %s (expected no, on-failure[:N], always or unless-stopped)", s)
+	}
+	if hasCount {
+		return RestartPolicy{}, fmt.Errorf("invalid restart policy %s: only on-failure takes a retry count", s)
+	}
+	return p, nil
+}
+
+// Enabled reports whether the policy restarts containers at all.
+func (p RestartPolicy) Enabled() bool {
+	return p.Name != "" && p.Name != "no"
+}
+
+// ShouldRestart decides whether a container that exited with exitCode after
+// restarts previous restarts is started again.
+func (p RestartPolicy) ShouldRestart(exitCode, restarts int) bool {
+	switch p.Name {
+	case "always", "unless-stopped":
+		return true
+	case "on-failure":
+		return exitCode != 0 && (p.MaxRetries == 0 || restarts < p.MaxRetries)
+	}
+	return false
+}
+
+// shellCondition returns a shell test for ShouldRestart over $CODE and $RESTARTS,
+// for the supervisor loop of detached containers.
+func (p RestartPolicy) shellCondition() string {
+	switch p.Name {
+	case "always", "unless-stopped":
+		return "true"
+	case "on-failure":
+		if p.MaxRetries == 0 {
+			return `[ "$CODE" -ne 0 ]`
+		}
+		return fmt.Sprintf(`[ "$CODE" -ne 0 ] && [ "$RESTARTS" -lt %d ]`, p.MaxRetries)
+	}
+	return "false"
+}
+
+// restoreCandidates returns the detached containers with a restart policy that
+// RestoreContainers starts: those found dead now (dead, see deadContainers) or by an
+// earlier reconcile (ExitReason "unknown"), and with all the stopped "always" ones.
+func restoreCandidates(containers []Container, dead map[string]bool, all bool) []string {
+	var ids []string
+	for _, c := range containers {
+		policy, err := ParseRestartPolicy(c.Config.Restart)
+		if err != nil || !policy.Enabled() || !c.Config.Detach {
+			continue
+		}
+		lost := dead[c.ID] || (c.Status == "Exited" && c.ExitReason == "unknown")
+		if lost || (all && policy.Name == "always" && c.Status == "Exited") {
+			ids = append(ids, c.ID)
+		}
+	}
+	return ids
+}
+
+// restartSupervisorScript runs the container command (see loggedCommand, which saves its
+// exit status in codeFile) in a loop and restarts it as the restart policy asks, with
+// exponential back-off. plx stop creates stoppedFile first, so the container is not
+// restarted after it. Every run is recorded with containerStateFuncs.
+func restartSupervisorScript(command, codeFile, stoppedFile string, policy RestartPolicy, health bool) string {
+	var script strings.Builder
+	script.WriteString(`set_count() { sed -i "s/\"restartCount\":[0-9]*/\"restartCount\":$1/" "$CONFIG"; }` + "\n")
+	fmt.Fprintf(&script, "STOPPED=%s\nRESTARTS=0\nDELAY=0\n", shellQuote(stoppedFile))
+	script.WriteString("while :; do\n  STARTED=$(date +%s)\n")
+	fmt.Fprintf(&script, "  rm -f %s\n  %s &\n  MAIN=$!\n", codeFile, command)
+	if health {
+		script.WriteString("  health_loop &\n  HEALTH=$!\n")
+	}
+	script.WriteString("  started\n")
+	fmt.Fprintf(&script, "  wait \"$MAIN\"\n  CODE=$(cat %s 2>/dev/null || echo 1)\n  finished \"$CODE\"\n", codeFile)
+	if health {
+		script.WriteString("  kill \"$HEALTH\" 2>/dev/null\n")
+	}
+	fmt.Fprintf(&script, `  if [ -e "$STOPPED" ] || [ ! -f "$CONFIG" ]; then break; fi
+  if ! { %s; }; then break; fi
+  if [ "$DELAY" -eq 0 ] || [ $(( $(date +%%s) - STARTED )) -ge %d ]; then
+    DELAY=%d
+  else
+    DELAY=$((DELAY * 2))
+    if [ "$DELAY" -gt %d ]; then DELAY=%d; fi
+  fi
+  set_field status Restarting
+  sleep "$DELAY"
+  if [ -e "$STOPPED" ] || [ ! -f "$CONFIG" ]; then break; fi
+  RESTARTS=$((RESTARTS + 1))
+  set_count "$RESTARTS"
+  set_field status Running
+`, policy.shellCondition(), int(restartResetAfter/time.Second), int(restartMinDelay/time.Second), int(restartMaxDelay/time.Second), int(restartMaxDelay/time.Second))
+	if health {
+		script.WriteString("  set_field health starting\n")
+	}
+	script.WriteString("done\n")
+	return script.String()
+}
+
+// nextRestartDelay returns the back-off before the next restart, given the previous
+// delay and how long the container ran.
+func nextRestartDelay(prev, ran time.Duration) time.Duration {
+	if prev == 0 || ran >= restartResetAfter {
+		return restartMinDelay
+	}
+	if prev*2 > restartMaxDelay {
+		return restartMaxDelay
+	}
+	return prev * 2
+}
+
+// exitCodeOf returns the exit status carried by err: 0 for nil, 128 + N for a process
+// killed by signal N, -1 if unknown.
+func exitCodeOf(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if ws, ok := exitErr.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+			return 128 + int(ws.Signal())
+		}
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
+// superviseForeground runs a foreground container's process with run and starts it
+// again as policy asks, unless stopped reports that plx stop ended it (the stopped file,
+// as in restartSupervisorScript). onRestart is called with the new restart count before
+// each restart.
+func superviseForeground(policy RestartPolicy, run func() error, stopped func() bool, onRestart func(count int)) error {
+	var delay time.Duration
+	for restarts := 0; ; restarts++ {
+		started := time.Now()
+		err := run()
+		code := exitCodeOf(err)
+		if !policy.ShouldRestart(code, restarts) || stopped() {
+			return err
+		}
+		delay = nextRestartDelay(delay, time.Since(started))
+		fmt.Printf("Container exited with code %d, restarting in %s (restart policy %s)...\n", code, delay, policy.Name)
+		time.Sleep(delay)
+		if stopped() {
+			return err
+		}
+		onRestart(restarts + 1)
+	}
+}
@@ -0,0 +1,188 @@
+package container
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestParseRestartPolicy(t *testing.T) {
+	tests := []struct {
+		in   string
+		want RestartPolicy
+		err  bool
+	}{
+		{"", RestartPolicy{Name: "no"}, false},
+		{"no", RestartPolicy{Name: "no"}, false},
+		{" always ", RestartPolicy{Name: "always"}, false},
+		{"unless-stopped", RestartPolicy{Name: "unless-stopped"}, false},
+		{"on-failure", RestartPolicy{Name: "on-failure"}, false},
+		{"on-failure:3", RestartPolicy{Name: "on-failure", MaxRetries: 3}, false},
+		{"on-failure:0", RestartPolicy{Name: "on-failure"}, false},
+		{"on-failure:-1", RestartPolicy{}, true},
+		{"on-failure:x", RestartPolicy{}, true},
+		{"always:3", RestartPolicy{}, true},
+		{"no:1", RestartPolicy{}, true},
+		{"sometimes", RestartPolicy{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseRestartPolicy(tt.in)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("ParseRestartPolicy(%q) = %+v, %v", tt.in, got, err)
+		}
+	}
+}
+
+func TestShouldRestart(t *testing.T) {
+	tests := []struct {
+		policy         string
+		code, restarts int
+		want           bool
+	}{
+		{"no", 1, 0, false},
+		{"always", 0, 100, true},
+		{"unless-stopped", 0, 0, true},
+		{"on-failure", 0, 0, false},
+		{"on-failure", 1, 100, true},
+		{"on-failure", 137, 0, true},
+		{"on-failure:2", 1, 1, true},
+		{"on-failure:2", 1, 2, false},
+	}
+	for _, tt := range tests {
+		p, err := ParseRestartPolicy(tt.policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := p.ShouldRestart(tt.code, tt.restarts); got != tt.want {
+			t.Errorf("%s: ShouldRestart(%d, %d) = %v, want %v", tt.policy, tt.code, tt.restarts, got, tt.want)
+		}
+		if _, err := exec.LookPath("sh"); err != nil {
+			continue
+		}
+		cond := fmt.Sprintf("CODE=%d RESTARTS=%d; %s", tt.code, tt.restarts, p.shellCondition())
+		if got := exec.Command("sh", "-c", cond).Run() == nil; got != tt.want {
+			t.Errorf("%s: shell condition for code %d after %d restarts = %v, want %v", tt.policy, tt.code, tt.restarts, got, tt.want)
+		}
+	}
+}
+
+func TestNextRestartDelay(t *testing.T) {
+	tests := []struct {
+		prev, ran, want time.Duration
+	}{
+		{0, 0, restartMinDelay},
+		{time.Second, time.Second, 2 * time.Second},
+		{8 * time.Second, 0, 16 * time.Second},
+		{40 * time.Second, 0, restartMaxDelay},
+		{restartMaxDelay, 0, restartMaxDelay},
+		{restartMaxDelay, restartResetAfter, restartMinDelay},
+	}
+	for _, tt := range tests {
+		if got := nextRestartDelay(tt.prev, tt.ran); got != tt.want {
+			t.Errorf("nextRestartDelay(%s, %s) = %s, want %s", tt.prev, tt.ran, got, tt.want)
+		}
+	}
+}
+
+func TestSuperviseForeground(t *testing.T) {
+	failed := errors.New("exited")
+	tests := []struct {
+		name     string
+		policy   string
+		stopped  []bool // answers to successive stopped() calls, then false
+		runs     int
+		restarts []int
+	}{
+		{"no policy", "no", nil, 1, nil},
+		{"stopped before the back-off", "always", []bool{true}, 1, nil},
+		{"stopped during the back-off", "always", []bool{false, true}, 1, nil},
+		{"retries until the limit", "on-failure:1", nil, 2, []int{1}},
+	}
+	for _, tt := range tests {
+		policy, err := ParseRestartPolicy(tt.policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		runs, checks := 0, 0
+		var restarts []int
+		err = superviseForeground(policy, func() error {
+			runs++
+			return failed
+		}, func() bool {
+			checks++
+			return checks <= len(tt.stopped) && tt.stopped[checks-1]
+		}, func(count int) {
+			restarts = append(restarts, count)
+		})
+		if err != failed || runs != tt.runs || !reflect.DeepEqual(restarts, tt.restarts) {
+			t.Errorf("%s: err %v, %d runs, restarts %v; want %d runs, restarts %v", tt.name, err, runs, restarts, tt.runs, tt.restarts)
+		}
+	}
+}
+
+func TestExitCodeOf(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a POSIX shell and signals")
+	}
+	tests := []struct {
+		script string
+		want   int
+	}{
+		{"exit 0", 0},
+		{"exit 3", 3},
+		{"kill -TERM $$", 128 + 15},
+		{"kill -KILL $$", 128 + 9},
+	}
+	for _, tt := range tests {
+		if got := exitCodeOf(exec.Command("sh", "-c", tt.script).Run()); got != tt.want {
+			t.Errorf("exitCodeOf(%q) = %d, want %d", tt.script, got, tt.want)
+		}
+	}
+	if got := exitCodeOf(errors.New("no exit status")); got != -1 {
+		t.Errorf("exitCodeOf(other error) = %d, want -1", got)
+	}
+}
+
+func TestRestoreCandidates(t *testing.T) {
+	container := func(id, restart, status string, detach bool) Container {
+		c := Container{ID: id, Status: status}
+		c.Config.Restart = restart
+		c.Config.Detach = detach
+		return c
+	}
+	containers := []Container{
+		container("always-dead", "always", "Running", true),
+		container("always-alive", "always", "Running", true),
+		container("always-stopped", "always", "Exited", true),
+		container("unless-stopped-dead", "unless-stopped", "Restarting", true),
+		container("unless-stopped-stopped", "unless-stopped", "Exited", true),
+		container("on-failure-dead", "on-failure:3", "Running", true),
+		container("no-dead", "no", "Running", true),
+		container("foreground-dead", "always", "Running", false),
+		container("unless-stopped-reconciled", "unless-stopped", "Exited", true),
+		container("on-failure-exited", "on-failure", "Exited", true),
+		container("reconciled-then-stopped", "unless-stopped", "Exited", true),
+	}
+	containers[len(containers)-3].ExitReason = "unknown"
+	containers[len(containers)-1].ExitReason = "stopped" // plx stop after reconcile marked it "unknown"
+	dead := map[string]bool{
+		"always-dead": true, "unless-stopped-dead": true, "on-failure-dead": true,
+		"no-dead": true, "foreground-dead": true,
+	}
+	tests := []struct {
+		all  bool
+		want []string
+	}{
+		{false, []string{"always-dead", "unless-stopped-dead", "on-failure-dead", "unless-stopped-reconciled"}},
+		{true, []string{"always-dead", "always-stopped", "unless-stopped-dead", "on-failure-dead", "unless-stopped-reconciled"}},
+	}
+	for _, tt := range tests {
+		if got := restoreCandidates(containers, dead, tt.all); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("all=%v: got %q, want %q", tt.all, got, tt.want)
+		}
+	}
+}
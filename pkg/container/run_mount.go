@@ -0,0 +1,181 @@
+package container
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// RunMount is a `RUN --mount=type=secret|cache,...` option.
+type RunMount struct {
+	Type     string // "secret" or "cache"
+	ID       string
+	Target   string
+	Required bool // secret: fail instead of skipping when the secret is not provided
+	ReadOnly bool
+}
+
+// ParseRunMounts parses the --mount flags of a RUN instruction.
+func ParseRunMounts(instr Instruction) ([]RunMount, error) {
+	var mounts []RunMount
+	for _, spec := range instr.Flags["mount"] {
+		m := RunMount{Type: "bind"}
+		for _, field := range strings.Split(spec, ",") {
+			key, value, _ := strings.Cut(strings.TrimSpace(field), "=")
+			switch strings.ToLower(key) {
+			case "type":
+				m.Type = value
+			case "id":
+				m.ID = value
+			case "target", "dst", "destination":
+				m.Target = value
+			case "required":
+				m.Required = value == "" || value == "true"
+			case "ro", "readonly":
+				m.ReadOnly = value == "" || value == "true"
+			case "":
+			default:
+				return nil, fmt.Errorf("--mount: unsupported option %q", key)
+			}
+		}
+
+		switch m.Type {
+		case "secret":
+			if m.ID == "" && m.Target != "" {
+				m.ID = path.Base(m.Target)
+			}
+			if m.ID == "" {
+				return nil, fmt.Errorf("--mount=type=secret requires id or target")
+			}
+			if m.Target == "" {
+				m.Target = "/run/secrets/" + m.ID
+			}
+			m.ReadOnly = true
+		case "cache":
+			if m.Target == "" {
+				return nil, fmt.Errorf("--mount=type=cache requires target")
+			}
+			if m.ID == "" {
+				m.ID = m.Target
+			}
+		default:
+			return nil, fmt.Errorf("--mount: unsupported type %q (expected secret or cache)", m.Type)
+		}
+		m.Target = path.Clean("/" + m.Target)
+		if m.Target == "/" {
+			return nil, fmt.Errorf("--mount: target must not be /")
+		}
+		mounts = append(mounts, m)
+	}
+	return mounts, nil
+}
+
+// ParseBuildSecret parses `plx build --secret id=npmrc,src=./.npmrc`.
+func ParseBuildSecret(spec string) (id, src string, err error) {
+	for _, field := range strings.Split(spec, ",") {
+		key, value, _ := strings.Cut(field, "=")
+		switch key {
+		case "id":
+			id = value
+		case "src", "source":
+			src = value
+		default:
+			return "", "", fmt.Errorf("--secret: unsupported option %q (expected id=...,src=...)", key)
+		}
+	}
+	if id == "" || src == "" {
+		return "", "", fmt.Errorf("--secret requires id=... and src=...")
+	}
+	return id, src, nil
+}
+
+// CacheMountDir returns the directory name that persists a cache mount between builds.
+func (m RunMount) CacheMountDir() string {
+	sum := sha256.Sum256([]byte(m.ID))
+	return hex.EncodeToString(sum[:16])
+}
+
+// buildMount is a resolved RUN --mount: Source is a path in the build environment.
+type buildMount struct {
+	Source   string
+	Target   string // absolute path inside the rootfs
+	Dir      bool
+	ReadOnly bool
+}
+
+// mountScript returns shell commands that bind-mount each mount into rootfs and the
+// commands that undo it. Mount points that did not exist are created and removed
+// again afterwards, so neither the mounted data nor empty mount points end up in
+// the layer. Symlinks on the way to a target are refused, as they could lead out of rootfs.
+func mountScript(rootfs string, mounts []buildMount) (setup, teardown string) {
+	var up, down []string
+	for i, m := range mounts {
+		var undo []string
+		rel := strings.TrimPrefix(path.Clean(m.Target), "/")
+		parts := strings.Split(rel, "/")
+		for k := range parts {
+			p := shellQuote(path.Join(rootfs, strings.Join(parts[:k+1], "/")))
+			flag := fmt.Sprintf("PLX_MP_%d_%d", i, k)
+			up = append(up, fmt.Sprintf("if [ -L %s ]; then echo %s >&2; exit 1; fi", p, shellQuote("--mount: /"+strings.Join(parts[:k+1], "/")+" is a symlink")))
+			create, remove := "mkdir "+p, "rmdir "+p
+			if k == len(parts)-1 && !m.Dir {
+				create, remove = ": > "+p, "rm -f "+p
+			}
+			up = append(up, fmt.Sprintf("if [ ! -e %s ]; then %s || exit 1; %s=1; fi", p, create, flag))
+			undo = append([]string{fmt.Sprintf("if [ -n \"$%s\" ]; then %s; fi", flag, remove)}, undo...)
+		}
+		target := shellQuote(path.Join(rootfs, rel))
+		if m.Dir {
+			up = append(up, fmt.Sprintf("mkdir -p %s || exit 1", shellQuote(m.Source)))
+		}
+		up = append(up, fmt.Sprintf("mount --bind %s %s || exit 1", shellQuote(m.Source), target))
+		if m.ReadOnly {
+			up = append(up, fmt.Sprintf("mount -o remount,bind,ro %s || exit 1", target))
+		}
+		undo = append([]string{fmt.Sprintf("umount %s", target)}, undo...)
+		down = append(undo, down...)
+	}
+	return strings.Join(up, "\n"), strings.Join(down, "\n")
+}
+
+// resolveRunMounts maps the RUN --mount options of instr to bind sources.
+// hostPath converts a host file into a path of the build environment and
+// cacheRoot is where cache mounts persist between builds.
+func resolveRunMounts(instr Instruction, secrets map[string]string, cacheRoot string, hostPath func(string) (string, error), step stepReporter) ([]buildMount, error) {
+	mounts, err := ParseRunMounts(instr)
+	if err != nil {
+		return nil, err
+	}
+	var resolved []buildMount
+	for _, m := range mounts {
+		switch m.Type {
+		case "secret":
+			src, ok := secrets[m.ID]
+			if !ok {
+				if m.Required {
+					return nil, fmt.Errorf("secret %s is required but was not provided (use plx build --secret id=%s,src=<file>)", m.ID, m.ID)
+				}
+				step.Logf("Secret %s not provided, skipping mount at %s", m.ID, m.Target)
+				continue
+			}
+			info, err := os.Stat(src)
+			if err != nil {
+				return nil, fmt.Errorf("secret %s: %w", m.ID, err)
+			}
+			if info.IsDir() {
+				return nil, fmt.Errorf("secret %s: %s is a directory", m.ID, src)
+			}
+			source, err := hostPath(src)
+			if err != nil {
+				return nil, fmt.Errorf("secret %s: %w", m.ID, err)
+			}
+			resolved = append(resolved, buildMount{Source: source, Target: m.Target, ReadOnly: true})
+		case "cache":
+			resolved = append(resolved, buildMount{Source: path.Join(cacheRoot, m.CacheMountDir()), Target: m.Target, Dir: true, ReadOnly: m.ReadOnly})
+		}
+	}
+	return resolved, nil
+}
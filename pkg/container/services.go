@@ -1,23 +1,50 @@
 package container
 
+import (
+	"context"
+	"io"
+	"time"
+)
+
 // RuntimeService handles container lifecycle operations (execution, process management)
 type RuntimeService interface {
 	Run(opts RunOptions) error
 	Start(id string) error
-	Stop(id string) error
+	Stop(id string, timeout time.Duration) error
 	List() ([]Container, error)
-	Logs(id string) (string, error)
+	// Logs writes the container's log to w (streaming with opts.Follow until ctx is done)
+	Logs(ctx context.Context, id string, opts LogOptions, w io.Writer) error
 	Remove(id string) error
 	GetIP(id string) (string, error)
 	Update(id string, opts RunOptions) error
 	Exec(id string, cmd []string, interactive bool) error
+	// Stats samples the resource usage of the running containers (CPUPercent is left 0)
+	Stats() ([]ContainerStats, error)
+	// Top lists the processes of a running container (psArgs: optional ps options)
+	Top(id string, psArgs []string) (*ContainerTop, error)
+	// CopyToContainer copies a host file or directory ("dir/." for its contents) into
+	// the container, running or not (plx cp); copyOwnership keeps the UID/GID
+	CopyToContainer(id, hostPath, containerPath string, copyOwnership bool) error
+	// CopyFromContainer copies a file or directory of the container to the host (plx cp)
+	CopyFromContainer(id, containerPath, hostPath string) error
+	// GetArchive writes a tar archive of a path of the container to w
+	GetArchive(id, containerPath string, w io.Writer) error
+	// PutArchive extracts the tar archive r into a directory of the container
+	PutArchive(id, containerPath string, r io.Reader, copyOwnership bool) error
+	// Networks lists the networks containers are attached to
+	Networks() []Network
+	// RestoreContainers starts the containers whose restart policy wants them running
+	// again but that were found dead (WSL restart); with all (plx setup), also "always"
+	// containers stopped with plx stop
+	RestoreContainers(all bool) error
 }
 
 // ImageService handles image management (pull, build, cache)
 type ImageService interface {
 	Pull(image string) error
-	Build(ctxDir string, dockerfile string, tag string) (string, error)
+	Build(opts BuildOptions) (string, error)
 	Images() ([]string, error)
+	Inspect(image string) (*ImageMetadata, error)
 	Prune() error
 	Diff(image1, image2 string) (string, error)
 	ExportDiff(baseImage, targetImage, outputPath string) error
@@ -28,6 +55,7 @@ type VolumeService interface {
 	Create(name string) error
 	Remove(name string) error
 	List() ([]string, error)
+	Inspect(name string) (*Volume, error)
 }
 
 // NetworkService handles container network isolation and connectivity
@@ -37,4 +65,5 @@ type NetworkService interface {
 	ReleaseIP(ip string)
 	GetSetupScript(containerID, ip string) (string, string, error)
 	CleanupContainerNetwork(containerID, ip string) error
+	Info() Network
 }
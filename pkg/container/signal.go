@@ -0,0 +1,48 @@
+package container
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultStopSignal is sent by `plx stop` unless the image or container sets STOPSIGNAL.
+const DefaultStopSignal = "SIGTERM"
+
+// DefaultStopTimeout is how long `plx stop` waits before falling back to SIGKILL.
+const DefaultStopTimeout = 10 * time.Second
+
+// Linux signal numbers (x86_64 / arm64)
+var signalNumbers = map[string]int{
+	"SIGHUP": 1, "SIGINT": 2, "SIGQUIT": 3, "SIGILL": 4, "SIGTRAP": 5, "SIGABRT": 6,
+	"SIGBUS": 7, "SIGFPE": 8, "SIGKILL": 9, "SIGUSR1": 10, "SIGSEGV": 11, "SIGUSR2": 12,
+	"SIGPIPE": 13, "SIGALRM": 14, "SIGTERM": 15, "SIGSTKFLT": 16, "SIGCHLD": 17,
+	"SIGCONT": 18, "SIGSTOP": 19, "SIGTSTP": 20, "SIGTTIN": 21, "SIGTTOU": 22,
+	"SIGURG": 23, "SIGXCPU": 24, "SIGXFSZ": 25, "SIGVTALRM": 26, "SIGPROF": 27,
+	"SIGWINCH": 28, "SIGIO": 29, "SIGPWR": 30, "SIGSYS": 31,
+}
+
+// ParseSignal accepts "SIGTERM", "TERM", "term" or "15" and returns the signal number.
+func ParseSignal(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	if n, err := strconv.Atoi(s); err == nil {
+		if n < 1 || n > 64 {
+			return 0, fmt.Errorf("invalid signal: %s", s)
+		}
+		return n, nil
+	}
+	name := strings.ToUpper(s)
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+	if n, ok := signalNumbers[name]; ok {
+		return n, nil
+	}
+	if strings.HasPrefix(name, "SIGRTMIN+") {
+		if off, err := strconv.Atoi(strings.TrimPrefix(name, "SIGRTMIN+")); err == nil && off >= 0 && off <= 30 {
+			return 34 + off, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid signal: %s", s)
+}
@@ -0,0 +1,33 @@
+package container
+
+import "testing"
+
+func TestParseSignal(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int
+	}{
+		{"SIGTERM", 15},
+		{"TERM", 15},
+		{"term", 15},
+		{" SIGKILL ", 9},
+		{"sigusr1", 10},
+		{"15", 15},
+		{"1", 1},
+		{"64", 64},
+		{"SIGRTMIN+0", 34},
+		{"RTMIN+3", 37},
+		{"SIGRTMIN+30", 64},
+	}
+	for _, tt := range tests {
+		got, err := ParseSignal(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseSignal(%q) = %d, %v, want %d", tt.in, got, err, tt.want)
+		}
+	}
+	for _, in := range []string{"", "0", "65", "-1", "SIGFOO", "SIGRTMIN+31", "SIGRTMIN+x", "SIGRTMIN"} {
+		if n, err := ParseSignal(in); err == nil {
+			t.Errorf("ParseSignal(%q) = %d, want an error", in, n)
+		}
+	}
+}
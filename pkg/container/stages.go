@@ -0,0 +1,374 @@
+package container
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var validStageName = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_.-]*$`)
+
+// StageIndex resolves a FROM base or COPY --from value to one of the stages before
+// the given index: by name, or by its 0-based position. -1 means ref is an image.
+func (df *Dockerfile) StageIndex(ref string, before int) int {
+	if n, err := strconv.Atoi(ref); err == nil {
+		if n >= 0 && n < before && n < len(df.Stages) {
+			return n
+		}
+		return -1
+	}
+	ref = strings.ToLower(ref)
+	for i := 0; i < before && i < len(df.Stages); i++ {
+		if df.Stages[i].Name != "" && df.Stages[i].Name == ref {
+			return i
+		}
+	}
+	return -1
+}
+
+// ApplyGlobalArgs resolves the ARGs declared before the first FROM (a --build-arg
+// overrides their default) and substitutes them in the FROM lines. Inside a stage a
+// global ARG is only seen when it is declared again without a value (ARG NAME), which
+// then defaults to the global value, as in Docker.
+func (df *Dockerfile) ApplyGlobalArgs(buildArgs map[string]string) {
+	globals := make(map[string]string)
+	for _, instr := range df.GlobalArgs {
+		for k, v := range ResolveBuildArgs(instr, buildArgs) {
+			globals[k] = v
+		}
+	}
+	for i := range df.Stages {
+		stage := &df.Stages[i]
+		stage.Base = os.Expand(stage.Base, func(name string) string { return globals[name] })
+		for j, instr := range stage.Instructions {
+			if instr.Type != "ARG" {
+				continue
+			}
+			args := append([]string(nil), instr.Args...)
+			for k, decl := range args {
+				if v, ok := globals[decl]; ok {
+					args[k] = decl + "=" + v
+				}
+			}
+			stage.Instructions[j].Args = args
+		}
+	}
+}
+
+// StageDeps returns the earlier stages stage i uses as its base or copies from.
+func (df *Dockerfile) StageDeps(i int) []int {
+	var deps []int
+	add := func(ref string) {
+		if j := df.StageIndex(ref, i); j >= 0 {
+			for _, d := range deps {
+				if d == j {
+					return
+				}
+			}
+			deps = append(deps, j)
+		}
+	}
+	add(df.Stages[i].Base)
+	for _, instr := range df.Stages[i].Instructions {
+		if instr.Type == "COPY" && instr.Flag("from") != "" {
+			add(instr.Flag("from"))
+		}
+	}
+	return deps
+}
+
+// RequiredStages returns the indices of the stages the final image depends on, in
+// Dockerfile order. Stages nothing refers to are not built.
+func (df *Dockerfile) RequiredStages() []int {
+	needed := make([]bool, len(df.Stages))
+	var mark func(i int)
+	mark = func(i int) {
+		if needed[i] {
+			return
+		}
+		needed[i] = true
+		for _, d := range df.StageDeps(i) {
+			mark(d)
+		}
+	}
+	mark(len(df.Stages) - 1)
+
+	var order []int
+	for i, n := range needed {
+		if n {
+			order = append(order, i)
+		}
+	}
+	return order
+}
+
+// StageLabel names stage i in progress output: "" for single-stage builds, so their
+// output is unchanged, otherwise the stage name or "stage-N".
+func (df *Dockerfile) StageLabel(i int) string {
+	if len(df.Stages) == 1 {
+		return ""
+	}
+	if df.Stages[i].Name != "" {
+		return df.Stages[i].Name
+	}
+	return fmt.Sprintf("stage-%d", i)
+}
+
+var errStageSkipped = errors.New("stage skipped")
+
+// runStages calls build for every required stage. A stage starts as soon as the
+// stages it depends on have finished, so independent stages run in parallel.
+// After a failure no further stages are started; the first error is returned once
+// the running ones have finished.
+func runStages(df *Dockerfile, build func(i int) error) error {
+	required := df.RequiredStages()
+	done := make([]chan struct{}, len(df.Stages))
+	errs := make([]error, len(df.Stages))
+	for _, i := range required {
+		done[i] = make(chan struct{})
+	}
+
+	var failed sync.Once
+	failedCh := make(chan struct{})
+	var wg sync.WaitGroup
+	for _, i := range required {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer close(done[i])
+			for _, d := range df.StageDeps(i) {
+				<-done[d]
+				if errs[d] != nil {
+					errs[i] = errStageSkipped
+					return
+				}
+			}
+			select {
+			case <-failedCh:
+				errs[i] = errStageSkipped
+				return
+			default:
+			}
+			if err := build(i); err != nil {
+				errs[i] = err
+				failed.Do(func() { close(failedCh) })
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for _, i := range required {
+		if errs[i] != nil && errs[i] != errStageSkipped {
+			return errs[i]
+		}
+	}
+	return nil
+}
+
+// stageOnBuildTriggers returns the ONBUILD triggers a stage based on another stage
+// inherits: the ONBUILD instructions of that stage.
+func stageOnBuildTriggers(parent Stage) []string {
+	var triggers []string
+	for _, instr := range parent.Instructions {
+		if instr.Type == "ONBUILD" {
+			triggers = append(triggers, instr.Args...)
+		}
+	}
+	return triggers
+}
+
+// applyStageOnBuildTriggers inserts into every stage the ONBUILD triggers of its
+// base: those saved in the base image's metadata, or the ONBUILD instructions of
+// the stage it is built on.
+func applyStageOnBuildTriggers(df *Dockerfile, inspect func(image string) (*ImageMetadata, error), report stepReporter) error {
+	for i := range df.Stages {
+		stage := &df.Stages[i]
+		var triggers []string
+		if j := df.StageIndex(stage.Base, i); j >= 0 {
+			triggers = stageOnBuildTriggers(df.Stages[j])
+		} else if meta, err := inspect(stage.Base); err == nil {
+			triggers = meta.OnBuild
+		}
+		n, err := applyOnBuildTriggers(stage, triggers)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			report.emit(BuildEvent{Type: BuildInfo, Message: fmt.Sprintf("Executing %d ONBUILD trigger(s) from %s", n, stage.Base)})
+		}
+	}
+	return nil
+}
+
+// allInstructions returns the instructions of every stage.
+func (df *Dockerfile) allInstructions() []Instruction {
+	all := append([]Instruction(nil), df.GlobalArgs...)
+	for _, stage := range df.Stages {
+		all = append(all, stage.Instructions...)
+	}
+	return all
+}
+
+// newBuildID returns a unique name for a build's working directory, so that
+// concurrent builds (several CLI processes or API requests) never share one.
+func newBuildID() string {
+	buf := make([]byte, 6)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("build-%d", os.Getpid())
+	}
+	return fmt.Sprintf("build-%d-%s", os.Getpid(), hex.EncodeToString(buf))
+}
+
+// stageState is the build-local state of one stage: what the instructions so far
+// set up for the ones that follow. Each build (and each stage) has its own, so
+// concurrent builds don't affect each other.
+type stageState struct {
+	rootfs    string
+	user      string
+	workdir   string
+	env       map[string]string
+	envPrefix string            // "export K=V; " for RUN
+	args      map[string]string // ARG values are visible to RUN and ENV, but not saved in the image
+	argPrefix string
+	config    ImageMetadata // LABEL, EXPOSE, CMD, ... saved with the image
+}
+
+func newStageState(rootfs string) *stageState {
+	return &stageState{
+		rootfs:  rootfs,
+		user:    "root",
+		workdir: "/",
+		env:     make(map[string]string),
+		args:    make(map[string]string),
+	}
+}
+
+// inheritImage takes over what a base image passes on: LABEL, EXPOSE, VOLUME,
+// HEALTHCHECK and STOPSIGNAL (ONBUILD is not inherited).
+func (st *stageState) inheritImage(base *ImageMetadata) {
+	st.config.Labels = base.Labels
+	st.config.ExposedPorts = base.ExposedPorts
+	st.config.Volumes = base.Volumes
+	st.config.Healthcheck = base.Healthcheck
+	st.config.StopSignal = base.StopSignal
+}
+
+// inheritStage starts from the final state of an earlier stage. ARGs are scoped
+// to their stage and start empty.
+func (st *stageState) inheritStage(parent *stageState) {
+	st.user = parent.user
+	st.workdir = parent.workdir
+	for k, v := range parent.env {
+		st.env[k] = v
+	}
+	st.envPrefix = parent.envPrefix
+	st.config = parent.config
+	// Copy what ApplyInstruction modifies in place; parallel stages may share a parent
+	st.config.Labels = nil
+	for k, v := range parent.config.Labels {
+		if st.config.Labels == nil {
+			st.config.Labels = make(map[string]string)
+		}
+		st.config.Labels[k] = v
+	}
+	st.config.ExposedPorts = append([]string(nil), parent.config.ExposedPorts...)
+	st.config.Volumes = append([]string(nil), parent.config.Volumes...)
+	st.config.OnBuild = nil
+}
+
+// apply updates the state for instr. It must run for cached steps too. Warnings
+// (see ApplyInstruction) are reported to step.
+func (st *stageState) apply(instr Instruction, buildArgs map[string]string, step stepReporter) {
+	switch instr.Type {
+	case "ENV":
+		for j := 0; j < len(instr.Args); j += 2 {
+			k := instr.Args[j]
+			v := ""
+			if j+1 < len(instr.Args) {
+				v = instr.Args[j+1]
+			}
+			st.env[k] = v
+			// Expand variables in the value using the current ENV and ARG values (v1.0.8)
+			expandedV := os.Expand(v, func(name string) string {
+				if val, ok := st.env[name]; ok {
+					return val
+				}
+				if val, ok := st.args[name]; ok {
+					return val
+				}
+				// If not in our map, it might be a system/base image env
+				// For now, return the literal to avoid accidental clearing
+				// but Docker-style $PATH will be handled if it's in env
+				return "$" + name
+			})
+			st.env[k] = expandedV
+			st.envPrefix += fmt.Sprintf("export %s=%q; ", k, expandedV)
+		}
+	case "ARG":
+		values := ResolveBuildArgs(instr, buildArgs)
+		for _, k := range sortedKeys(values) {
+			st.args[k] = values[k]
+			st.argPrefix += fmt.Sprintf("export %s=%q; ", k, values[k])
+		}
+	case "WORKDIR":
+		if len(instr.Args) > 0 {
+			st.workdir = ResolveWorkdir(st.workdir, instr.Args[0])
+		}
+	case "USER":
+		if len(instr.Args) > 0 {
+			st.user = instr.Args[0]
+		}
+	case "CMD":
+		st.config.Command = instr.Args
+	}
+	for _, w := range st.config.ApplyInstruction(instr) {
+		step.Warnf("%s", w)
+	}
+}
+
+// metadata returns the image configuration to save for the stage.
+func (st *stageState) metadata() ImageMetadata {
+	meta := st.config
+	meta.User = st.user
+	meta.Workdir = st.workdir
+	meta.Env = st.env
+	return meta
+}
+
+// stageCopyScript returns a shell script for COPY --from: it copies srcs (paths in
+// the source rootfs srcRoot) to dest, an absolute path inside rootfs, following the
+// COPY rules (directories are copied by content, a trailing slash or several
+// sources mean "into"). --chown/--chmod only touch the paths it added.
+func stageCopyScript(srcRoot string, srcs []string, rootfs, dest string, destIsDir bool, chmod, chown string) string {
+	var script strings.Builder
+	script.WriteString("set -e\nLIST=$(mktemp)\n")
+	fmt.Fprintf(&script, "D=%s\n", shellQuote(rootfs+"/"+strings.TrimPrefix(dest, "/")))
+	into := destIsDir || len(srcs) > 1
+	for _, src := range srcs {
+		fmt.Fprintf(&script, "S=%s\n", shellQuote(srcRoot+"/"+strings.TrimPrefix(src, "/")))
+		fmt.Fprintf(&script, "if [ ! -e \"$S\" ] && [ ! -L \"$S\" ]; then echo %s >&2; exit 1; fi\n", shellQuote(src+": no such file or directory"))
+		script.WriteString("if [ -d \"$S\" ] && [ ! -L \"$S\" ]; then\n" +
+			"  mkdir -p \"$D\"\n" +
+			"  for e in \"$S\"/* \"$S\"/.[!.]* \"$S\"/..?*; do if [ -e \"$e\" ] || [ -L \"$e\" ]; then cp -a \"$e\" \"$D\"/; printf '%s\\n' \"$D/${e##*/}\" >> \"$LIST\"; fi; done\n")
+		fmt.Fprintf(&script, "elif [ %t = true ] || [ -d \"$D\" ]; then\n", into)
+		script.WriteString("  mkdir -p \"$D\"; cp -a \"$S\" \"$D\"/; printf '%s\\n' \"$D/${S##*/}\" >> \"$LIST\"\n" +
+			"else\n" +
+			"  mkdir -p \"$(dirname \"$D\")\"; cp -a \"$S\" \"$D\"; printf '%s\\n' \"$D\" >> \"$LIST\"\n" +
+			"fi\n")
+	}
+	if chmod != "" {
+		fmt.Fprintf(&script, "while IFS= read -r t; do chmod -R %s \"$t\"; done < \"$LIST\"\n", shellQuote(chmod))
+	}
+	if chown != "" {
+		// chown inside the rootfs so that user/group names resolve against the image's /etc/passwd
+		fmt.Fprintf(&script, "R=%s\nwhile IFS= read -r t; do chroot \"$R\" chown -R %s \"${t#\"$R\"}\"; done < \"$LIST\"\n", shellQuote(rootfs), shellQuote(chown))
+	}
+	script.WriteString("rm -f \"$LIST\"\n")
+	return script.String()
+}
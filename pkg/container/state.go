@@ -0,0 +1,111 @@
+package container
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// waitInterval is how often Wait checks whether the container is still running.
+const waitInterval = 500 * time.Millisecond
+
+// ExitError is returned by Run when a foreground container exits with a non-zero
+// code, so that plx run can exit with the same code.
+type ExitError struct {
+	ID   string
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("container %s exited with code %d", e.ID, e.Code)
+}
+
+// containerStateFuncs defines the shell functions run.sh records the state of each run
+// in $CONFIG with: started, called once the command runs as $MAIN, and finished CODE.
+// They need set_field and $CG (setup_cgroup). OOMKilled compares the oom_kill count of
+// the cgroup with the one at the start of the run, as the cgroup outlives restarts.
+func containerStateFuncs(pidFile string) string {
+	return fmt.Sprintf(`PIDFILE=%s
+now() { date -u +%%Y-%%m-%%dT%%H:%%M:%%SZ; }
+set_value() { sed -i "s/\"$1\":[0-9a-z-]*/\"$1\":$2/" "$CONFIG"; }
+oom_kills() { K=$(awk '$1 == "oom_kill" { print $2 }' "$CG/memory.events" 2>/dev/null); echo "${K:-0}"; }
+started() {
+  OOM=$(oom_kills)
+  set_field startedAt "$(now)"
+  set_value exitCode 0
+  set_value oomKilled false
+  i=0
+  while [ ! -s "$PIDFILE" ] && kill -0 "$MAIN" 2>/dev/null && [ "$i" -lt 50 ]; do sleep 0.1; i=$((i + 1)); done
+  set_value pid "$(cat "$PIDFILE" 2>/dev/null || echo 0)"
+}
+finished() {
+  O=false
+  [ "$(oom_kills)" -gt "${OOM:-0}" ] && O=true
+  set_value exitCode "$1"
+  set_value oomKilled "$O"
+  set_value pid 0
+  set_field finishedAt "$(now)"
+  rm -f "$PIDFILE"
+}
+`, shellQuote(pidFile))
+}
+
+// pidRecordScript waits up to 5 seconds for the shim to write the container's host PID
+// to pidFile and saves it in configFile (foreground containers; run.sh uses started).
+func pidRecordScript(pidFile, configFile string) string {
+	return fmt.Sprintf(`i=0
+while [ ! -s %[1]s ] && [ "$i" -lt 50 ]; do sleep 0.1; i=$((i + 1)); done
+[ -s %[1]s ] && sed -i "s/\"pid\":[0-9]*/\"pid\":$(cat %[1]s)/" %[2]s
+`, shellQuote(pidFile), shellQuote(configFile))
+}
+
+// oomKillsScript prints how often the OOM killer has killed a process of the
+// container's cgroup. Run it before cgroupCleanupScript.
+func oomKillsScript(id string) string {
+	return fmt.Sprintf(`for CG in /sys/fs/cgroup/pocketlinx/%s /sys/fs/cgroup/unified/pocketlinx/%s; do
+  awk '$1 == "oom_kill" { print $2 }' "$CG/memory.events" 2>/dev/null
+done
+`, shellQuote(id), shellQuote(id))
+}
+
+// parseOOMKilled reads the output of oomKillsScript.
+func parseOOMKilled(out string) bool {
+	for _, f := range strings.Fields(out) {
+		if n, err := strconv.Atoi(f); err == nil && n > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// stopExitCode is the exit code of a container stopped by plx stop whose command did
+// not report one: 128 + the signal that ended it, like a shell.
+func stopExitCode(reason string, sig int) int {
+	if reason == "killed" {
+		return 128 + 9
+	}
+	return 128 + sig
+}
+
+// Wait blocks until the container has exited (a restart policy may keep it running)
+// and returns its exit code.
+func (e *Engine) Wait(id string) (int, error) {
+	for {
+		containers, err := e.List()
+		if err != nil {
+			return -1, err
+		}
+		c, err := findContainer(containers, id)
+		if err != nil {
+			return -1, err
+		}
+		if c == nil {
+			return -1, fmt.Errorf("container '%s' not found", id)
+		}
+		if c.Status != "Running" && c.Status != "Restarting" {
+			return c.ExitCode, nil
+		}
+		time.Sleep(waitInterval)
+	}
+}
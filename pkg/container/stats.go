@@ -0,0 +1,137 @@
+package container
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ContainerStats is one resource usage sample of a running container (plx stats, /api/stats).
+type ContainerStats struct {
+	ID            string    `json:"id"`
+	Name          string    `json:"name"`
+	CPUPercent    float64   `json:"cpuPercent"` // 100% = one full CPU
+	MemoryUsage   int64     `json:"memoryUsage"`
+	MemoryLimit   int64     `json:"memoryLimit"` // --memory, or the memory of the VM/host
+	MemoryPercent float64   `json:"memoryPercent"`
+	NetRx         int64     `json:"netRx"`
+	NetTx         int64     `json:"netTx"`
+	BlockRead     int64     `json:"blockRead"`
+	BlockWrite    int64     `json:"blockWrite"`
+	Pids          int64     `json:"pids"`
+	Read          time.Time `json:"read"`
+
+	// Raw counters for the CPU % of the next sample
+	cpuUsec    int64
+	uptimeUsec int64
+}
+
+// statsScript prints "uptime <seconds>" and then one line per container:
+// "stats <id> <cpu usage_usec> <memory> <limit> <rbytes> <wbytes> <pids> <rx> <tx>".
+// With netns the network counters are read in the container's network namespace.
+func statsScript(ids []string, netns bool) string {
+	quoted := make([]string, len(ids))
+	for i, id := range ids {
+		quoted[i] = shellQuote(id)
+	}
+	var script strings.Builder
+	script.WriteString(`read UP _ < /proc/uptime
+echo "uptime $UP"
+MEMTOTAL=$(awk '$1 == "MemTotal:" { printf "%d", $2 * 1024 }' /proc/meminfo)
+`)
+	fmt.Fprintf(&script, "for ID in %s; do\n", strings.Join(quoted, " "))
+	script.WriteString(`  CPU=0 MEM=0 LIMIT=$MEMTOTAL RB=0 WB=0 PIDS=0 RX=0 TX=0
+  for CG in /sys/fs/cgroup/pocketlinx/$ID /sys/fs/cgroup/unified/pocketlinx/$ID ""; do
+    [ -z "$CG" ] || [ -d "$CG" ] && break
+  done
+  if [ -n "$CG" ]; then
+    CPU=$(awk '$1 == "usage_usec" { print $2 }' "$CG/cpu.stat" 2>/dev/null)
+    MEM=$(cat "$CG/memory.current" 2>/dev/null)
+    L=$(cat "$CG/memory.max" 2>/dev/null)
+    if [ -n "$L" ] && [ "$L" != max ]; then LIMIT=$L; fi
+    set -- $(awk '{ for (i = 2; i <= NF; i++) { split($i, kv, "="); if (kv[1] == "rbytes") r += kv[2]; if (kv[1] == "wbytes") w += kv[2] } } END { print r + 0, w + 0 }' "$CG/io.stat" 2>/dev/null)
+    RB=${1:-0} WB=${2:-0}
+    PIDS=$(cat "$CG/pids.current" 2>/dev/null || wc -l < "$CG/cgroup.procs")
+  fi
+`)
+	if netns {
+		script.WriteString(`  set -- $(ip netns exec "$ID" cat /proc/net/dev 2>/dev/null | awk 'NR > 2 { sub(/^ +/, ""); split($0, f, /[: ]+/); if (f[1] != "lo") { rx += f[2]; tx += f[10] } } END { print rx + 0, tx + 0 }')
+  RX=${1:-0} TX=${2:-0}
+`)
+	}
+	script.WriteString(`  echo "stats $ID ${CPU:-0} ${MEM:-0} ${LIMIT:-0} $RB $WB ${PIDS:-0} $RX $TX"
+done
+`)
+	return script.String()
+}
+
+// parseStats reads the output of statsScript for the given containers.
+func parseStats(out string, containers []Container) []ContainerStats {
+	names := make(map[string]string, len(containers))
+	for _, c := range containers {
+		names[c.ID] = c.Name
+	}
+	now := time.Now()
+	var uptime int64
+	var stats []ContainerStats
+	for _, line := range strings.Split(out, "\n") {
+		f := strings.Fields(line)
+		switch {
+		case len(f) == 2 && f[0] == "uptime":
+			secs, _ := strconv.ParseFloat(f[1], 64)
+			uptime = int64(secs * 1e6)
+		case len(f) == 10 && f[0] == "stats":
+			n := make([]int64, 8)
+			for i := range n {
+				n[i], _ = strconv.ParseInt(f[i+2], 10, 64)
+			}
+			st := ContainerStats{
+				ID: f[1], Name: names[f[1]], Read: now,
+				cpuUsec: n[0], MemoryUsage: n[1], MemoryLimit: n[2],
+				BlockRead: n[3], BlockWrite: n[4], Pids: n[5], NetRx: n[6], NetTx: n[7],
+				uptimeUsec: uptime,
+			}
+			if st.MemoryLimit > 0 {
+				st.MemoryPercent = float64(st.MemoryUsage) / float64(st.MemoryLimit) * 100
+			}
+			stats = append(stats, st)
+		}
+	}
+	return stats
+}
+
+// runningIDs returns the IDs of the containers stats are sampled for.
+func runningIDs(containers []Container) []string {
+	var ids []string
+	for _, c := range containers {
+		if c.Status == "Running" || c.Status == "Restarting" {
+			ids = append(ids, c.ID)
+		}
+	}
+	return ids
+}
+
+// computeCPUPercent sets CPUPercent of cur from the CPU time used since prev.
+func computeCPUPercent(cur, prev []ContainerStats) {
+	before := make(map[string]ContainerStats, len(prev))
+	for _, p := range prev {
+		before[p.ID] = p
+	}
+	for i, c := range cur {
+		p, ok := before[c.ID]
+		if !ok {
+			continue
+		}
+		elapsed := c.uptimeUsec - p.uptimeUsec
+		used := c.cpuUsec - p.cpuUsec
+		if elapsed > 0 && used >= 0 {
+			cur[i].CPUPercent = float64(used) / float64(elapsed) * 100
+		}
+	}
+}
+
+// FormatBytes renders a byte count the way plx prints sizes (e.g. 12.5MB).
+func FormatBytes(b int64) string {
+	return formatSize(b)
+}
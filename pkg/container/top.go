@@ -0,0 +1,144 @@
+package container
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ContainerTop is the process list of a container (plx top, /api/containers/{id}/top).
+type ContainerTop struct {
+	Titles    []string   `json:"titles"`
+	Processes [][]string `json:"processes"`
+}
+
+// topTitles are the columns of plx top without ps options.
+var topTitles = []string{"PID", "CONTAINER PID", "USER", "TIME", "COMMAND"}
+
+// containerPIDFunc defines container_pid SHIM ROOTFS PIDFILE, which sets $PID to the
+// host PID of the container's PID 1, or to "" when the container is not running.
+// PIDFILE (shim.pid) is trusted only if the process's parent is the unshare process
+// running SHIM for ROOTFS; otherwise the process is looked up by that parent, the same
+// way Exec does. The pattern is built from the arguments so that it does not match the
+// calling script itself.
+const containerPIDFunc = `container_pid() {
+  PID=$(cat "$3" 2>/dev/null)
+  if [ -n "$PID" ] && [ -r "/proc/$PID/stat" ]; then
+    PP=$(sed 's/.*) //' "/proc/$PID/stat" | cut -d' ' -f2)
+    tr '\0' ' ' < "/proc/$PP/cmdline" 2>/dev/null | grep -q "$1 $2 " && return 0
+  fi
+  P=$(pgrep -f "$1 $2 " | head -n 1)
+  PID=""
+  [ -n "$P" ] && PID=$(pgrep -P "$P" | head -n 1)
+  return 0
+}
+`
+
+// containerPIDScript sets $PID (see containerPIDFunc), $SHIM and $ROOTFS for one container.
+func containerPIDScript(shim, rootfsDir, pidFile string) string {
+	return containerPIDFunc + fmt.Sprintf("SHIM=%s\nROOTFS=%s\ncontainer_pid \"$SHIM\" \"$ROOTFS\" %s\n",
+		shellQuote(shim), shellQuote(rootfsDir), shellQuote(pidFile))
+}
+
+// topScript lists the process tree under the container's PID 1. It exits with status 3
+// if the container is not running. Without psArgs it prints "hz <CLK_TCK>" and one
+// tab-separated line per process: host PID, namespace PID, user (from the container's
+// /etc/passwd), CPU ticks and command line. With psArgs it runs ps and keeps the header
+// and the rows whose PID column belongs to the container.
+func topScript(shim, rootfsDir, pidFile string, psArgs []string) string {
+	var script strings.Builder
+	script.WriteString(containerPIDScript(shim, rootfsDir, pidFile))
+	script.WriteString(`[ -n "$PID" ] || exit 3
+TREE=$(for d in /proc/[0-9]*; do
+  S=$(sed 's/.*) //' "$d/stat" 2>/dev/null) || continue
+  set -- $S
+  echo "${d#/proc/} $2 $((${12} + ${13}))"
+done | awk -v root="$PID" '
+  { parent[$1] = $2; ticks[$1] = $3; order[NR] = $1 }
+  END {
+    tree[root] = 1
+    for (changed = 1; changed; ) {
+      changed = 0
+      for (p in parent) if (!(p in tree) && (parent[p] in tree)) { tree[p] = 1; changed = 1 }
+    }
+    for (i = 1; i <= NR; i++) if (order[i] in tree) print order[i], ticks[order[i]]
+  }')
+`)
+	if len(psArgs) > 0 {
+		quoted := make([]string, len(psArgs))
+		for i, a := range psArgs {
+			quoted[i] = shellQuote(a)
+		}
+		fmt.Fprintf(&script, `PIDS=" $(echo "$TREE" | cut -d' ' -f1 | tr '\n' ' ') "
+ps %s | awk -v pids="$PIDS" 'NR == 1 { for (i = 1; i <= NF; i++) if ($i == "PID") col = i; print; next } col && index(pids, " " $col " ")'
+`, strings.Join(quoted, " "))
+		return script.String()
+	}
+	script.WriteString(`echo "hz $(getconf CLK_TCK 2>/dev/null || echo 100)"
+echo "$TREE" | while read -r P T; do
+  [ -r "/proc/$P/status" ] || continue
+  U=$(awk '$1 == "Uid:" { print $2 }' "/proc/$P/status")
+  NS=$(awk '$1 == "NSpid:" { print $NF }' "/proc/$P/status")
+  NAME=$(awk -F: -v u="$U" '$3 == u { print $1; exit }' "$ROOTFS/etc/passwd" 2>/dev/null)
+  CMD=$(tr '\0' ' ' < "/proc/$P/cmdline" 2>/dev/null)
+  [ -n "$CMD" ] || CMD="[$(cat "/proc/$P/comm" 2>/dev/null)]"
+  printf '%s\t%s\t%s\t%s\t%s\n' "$P" "${NS:--}" "${NAME:-$U}" "$T" "$CMD"
+done
+`)
+	return script.String()
+}
+
+// parseTop reads the output of topScript.
+func parseTop(out string, psArgs []string) (*ContainerTop, error) {
+	lines := strings.Split(strings.TrimRight(out, "\n"), "\n")
+	if len(psArgs) > 0 {
+		titles := strings.Fields(lines[0])
+		pidColumn := false
+		for _, t := range titles {
+			pidColumn = pidColumn || t == "PID"
+		}
+		if !pidColumn {
+			return nil, fmt.Errorf("ps %s: the output has no PID column", strings.Join(psArgs, " "))
+		}
+		top := &ContainerTop{Titles: titles, Processes: [][]string{}}
+		for _, line := range lines[1:] {
+			// The last column (usually the command) may contain spaces
+			fields := strings.Fields(line)
+			if len(fields) > len(titles) {
+				fields = append(fields[:len(titles)-1], strings.Join(fields[len(titles)-1:], " "))
+			}
+			top.Processes = append(top.Processes, fields)
+		}
+		return top, nil
+	}
+
+	hz := int64(100)
+	top := &ContainerTop{Titles: topTitles, Processes: [][]string{}}
+	for _, line := range lines {
+		if v, ok := strings.CutPrefix(line, "hz "); ok {
+			if n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64); err == nil && n > 0 {
+				hz = n
+			}
+			continue
+		}
+		f := strings.SplitN(line, "\t", 5)
+		if len(f) != 5 {
+			continue
+		}
+		ticks, _ := strconv.ParseInt(f[3], 10, 64)
+		f[3] = formatCPUTime(ticks / hz)
+		f[4] = strings.TrimSpace(f[4])
+		top.Processes = append(top.Processes, f)
+	}
+	return top, nil
+}
+
+// formatCPUTime renders CPU seconds like the TIME column of ps ([dd-]hh:mm:ss).
+func formatCPUTime(secs int64) string {
+	days, secs := secs/86400, secs%86400
+	t := fmt.Sprintf("%02d:%02d:%02d", secs/3600, secs%3600/60, secs%60)
+	if days > 0 {
+		t = fmt.Sprintf("%d-%s", days, t)
+	}
+	return t
+}
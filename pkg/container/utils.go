@@ -6,12 +6,13 @@ import (
 	"net/http"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"runtime"
 	"strings"
 	"time"
 )
 
-func downloadFile(url string, filepath string) error {
+func downloadFile(url string, dest string) error {
 	resp, err := http.Get(url)
 	if err != nil {
 		return err
@@ -22,13 +23,25 @@ func downloadFile(url string, filepath string) error {
 		return fmt.Errorf("bad status: %s", resp.Status)
 	}
 
-	out, err := os.Create(filepath)
+	// Download into a temporary file and rename it, so a concurrent download of the
+	// same URL or a failed one never leaves a truncated file at dest
+	out, err := os.CreateTemp(filepath.Dir(dest), filepath.Base(dest)+".*")
 	if err != nil {
 		return err
 	}
-	defer out.Close()
-
 	_, err = io.Copy(out, resp.Body)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(out.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(out.Name(), dest)
+	}
+	if err != nil {
+		os.Remove(out.Name())
+	}
 	return err
 }
 
@@ -171,3 +184,36 @@ func formatSize(b int64) string {
 	}
 	return fmt.Sprintf("%.1f%cB", float64(b)/float64(div), "KMGTPE"[exp])
 }
+
+// shellQuote wraps s in single quotes so it is passed to sh as one literal word.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "'\\''") + "'"
+}
+
+// atomicWriteScript returns a shell command that writes its stdin to out through a
+// unique temporary file and a rename, so readers never see a partial file.
+func atomicWriteScript(out string) string {
+	return fmt.Sprintf("T=$(mktemp %s) && cat > \"$T\" && chmod 644 \"$T\" && mv \"$T\" %s", shellQuote(out+".XXXXXX"), shellQuote(out))
+}
+
+// writeFileAtomic writes data to a temporary file next to name and renames it into place.
+func writeFileAtomic(name string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".*")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), name)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
@@ -4,7 +4,10 @@ package container
 
 import (
 	"PocketLinx/pkg/wsl"
+	"context"
 	"fmt"
+	"io"
+	"time"
 )
 
 // WSLBackend is the composite backend that delegates to specific services
@@ -63,7 +66,7 @@ EOF
 
 		# C. Update and Install core tools
 		apk update
-		apk add --no-cache tzdata util-linux socat iproute2 iptables
+		apk add --no-cache tzdata util-linux socat iproute2 iptables tar findutils
 
 		# D. Set Timezone (Copy instead of link for early boot stability)
 		if [ -f /usr/share/zoneinfo/Asia/Tokyo ]; then
@@ -92,24 +95,36 @@ EOF
 	}
 
 	fmt.Println("Environment is now healthy.")
+
+	// Containers with --restart always (or unless-stopped) come back after setup
+	if err := b.Runtime.RestoreContainers(true); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
 	return nil
 }
 
 // Delegation Methods
 
 // Runtime
-func (b *WSLBackend) Run(opts RunOptions) error      { return b.Runtime.Run(opts) }
-func (b *WSLBackend) Start(id string) error          { return b.Runtime.Start(id) }
-func (b *WSLBackend) List() ([]Container, error)     { return b.Runtime.List() }
-func (b *WSLBackend) Stop(id string) error           { return b.Runtime.Stop(id) }
-func (b *WSLBackend) Logs(id string) (string, error) { return b.Runtime.Logs(id) }
-func (b *WSLBackend) Remove(id string) error         { return b.Runtime.Remove(id) }
+func (b *WSLBackend) Run(opts RunOptions) error  { return b.Runtime.Run(opts) }
+func (b *WSLBackend) Start(id string) error      { return b.Runtime.Start(id) }
+func (b *WSLBackend) List() ([]Container, error) { return b.Runtime.List() }
+func (b *WSLBackend) Stop(id string, timeout time.Duration) error {
+	return b.Runtime.Stop(id, timeout)
+}
+func (b *WSLBackend) Logs(ctx context.Context, id string, opts LogOptions, w io.Writer) error {
+	return b.Runtime.Logs(ctx, id, opts, w)
+}
+func (b *WSLBackend) Remove(id string) error { return b.Runtime.Remove(id) }
 
 // Image
 func (b *WSLBackend) Pull(image string) error   { return b.Image.Pull(image) }
 func (b *WSLBackend) Images() ([]string, error) { return b.Image.Images() }
-func (b *WSLBackend) Build(ctxDir string, dockerfile string, tag string) (string, error) {
-	return b.Image.Build(ctxDir, dockerfile, tag)
+func (b *WSLBackend) InspectImage(image string) (*ImageMetadata, error) {
+	return b.Image.Inspect(image)
+}
+func (b *WSLBackend) Build(opts BuildOptions) (string, error) {
+	return b.Image.Build(opts)
 }
 func (b *WSLBackend) Prune() error { return b.Image.Prune() }
 func (b *WSLBackend) Diff(image1, image2 string) (string, error) {
@@ -124,8 +139,33 @@ func (b *WSLBackend) CreateVolume(name string) error { return b.Volume.Create(na
 func (b *WSLBackend) RemoveVolume(name string) error { return b.Volume.Remove(name) }
 func (b *WSLBackend) ListVolumes() ([]string, error) { return b.Volume.List() }
 
+func (b *WSLBackend) InspectVolume(name string) (*Volume, error) { return b.Volume.Inspect(name) }
+
+func (b *WSLBackend) Networks() []Network { return b.Runtime.Networks() }
+
 func (b *WSLBackend) GetIP(id string) (string, error)         { return b.Runtime.GetIP(id) }
 func (b *WSLBackend) Update(id string, opts RunOptions) error { return b.Runtime.Update(id, opts) }
 func (b *WSLBackend) Exec(id string, cmd []string, interactive bool) error {
 	return b.Runtime.Exec(id, cmd, interactive)
 }
+func (b *WSLBackend) Stats() ([]ContainerStats, error) { return b.Runtime.Stats() }
+func (b *WSLBackend) RestoreContainers() error         { return b.Runtime.RestoreContainers(false) }
+func (b *WSLBackend) Top(id string, psArgs []string) (*ContainerTop, error) {
+	return b.Runtime.Top(id, psArgs)
+}
+
+func (b *WSLBackend) CopyToContainer(id, hostPath, containerPath string, copyOwnership bool) error {
+	return b.Runtime.CopyToContainer(id, hostPath, containerPath, copyOwnership)
+}
+
+func (b *WSLBackend) CopyFromContainer(id, containerPath, hostPath string) error {
+	return b.Runtime.CopyFromContainer(id, containerPath, hostPath)
+}
+
+func (b *WSLBackend) GetArchive(id, containerPath string, w io.Writer) error {
+	return b.Runtime.GetArchive(id, containerPath, w)
+}
+
+func (b *WSLBackend) PutArchive(id, containerPath string, r io.Reader, copyOwnership bool) error {
+	return b.Runtime.PutArchive(id, containerPath, r, copyOwnership)
+}
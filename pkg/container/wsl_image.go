@@ -3,15 +3,16 @@
 package container
 
 import (
-	"crypto/sha256"
+	"bufio"
 	"encoding/json"
 	"fmt"
-	"io/fs"
+	"io"
 	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"PocketLinx/pkg/shim"
@@ -20,8 +21,7 @@ import (
 
 // WSLImageService implements ImageService using WSL2
 type WSLImageService struct {
-	wslClient   *wsl.Client
-	currentUser string
+	wslClient *wsl.Client
 }
 
 func NewWSLImageService(client *wsl.Client) *WSLImageService {
@@ -53,7 +53,29 @@ func (s *WSLImageService) Images() ([]string, error) {
 	return images, nil
 }
 
+// Inspect returns the metadata saved alongside an image. Pulled images have none,
+// so an empty ImageMetadata is returned for them.
+func (s *WSLImageService) Inspect(image string) (*ImageMetadata, error) {
+	if err := s.wslClient.RunDistroCommand("test", "-f", path.Join(GetWslImagesDir(), image+".tar.gz")); err != nil {
+		return nil, fmt.Errorf("image '%s' not found", image)
+	}
+	meta := &ImageMetadata{}
+	data, err := s.wslClient.RunDistroCommandOutput("cat", path.Join(GetWslImagesDir(), image+".json"))
+	if err != nil {
+		return meta, nil
+	}
+	if err := json.Unmarshal([]byte(data), meta); err != nil {
+		return nil, fmt.Errorf("failed to parse metadata for image '%s': %w", image, err)
+	}
+	return meta, nil
+}
+
 func (s *WSLImageService) Pull(image string) error {
+	return s.pull(image, os.Stdout)
+}
+
+// pull downloads image, writing its progress messages to out (build output during builds).
+func (s *WSLImageService) pull(image string, out io.Writer) error {
 	url, ok := SupportedImages[image]
 	if !ok {
 		return fmt.Errorf("image '%s' is not supported", image)
@@ -65,7 +87,7 @@ func (s *WSLImageService) Pull(image string) error {
 	if image == "alpine" {
 		targetFile := filepath.Join(GetImagesDir(), image+".tar.gz")
 		if _, err := os.Stat(targetFile); err != nil {
-			fmt.Printf("Downloading bootstrap image '%s'...\n", image)
+			fmt.Fprintf(out, "Downloading bootstrap image '%s'...\n", image)
 			cmd := exec.Command("powershell.exe", "-Command", fmt.Sprintf("Invoke-WebRequest -Uri %s -OutFile %s", url, targetFile))
 			if err := cmd.Run(); err != nil {
 				return fmt.Errorf("error downloading bootstrap image: %w", err)
@@ -82,11 +104,11 @@ func (s *WSLImageService) Pull(image string) error {
 		checkCmd := exec.Command("wsl.exe", "-l", "-q", "-d", s.wslClient.DistroName)
 		if err := checkCmd.Run(); err == nil {
 			exists = true
-			fmt.Printf("System distro '%s' already exists. Keeping existing data.\n", s.wslClient.DistroName)
+			fmt.Fprintf(out, "System distro '%s' already exists. Keeping existing data.\n", s.wslClient.DistroName)
 		}
 
 		if !exists {
-			fmt.Printf("Importing system distro '%s'...\n", s.wslClient.DistroName)
+			fmt.Fprintf(out, "Importing system distro '%s'...\n", s.wslClient.DistroName)
 			s.wslClient.Run("--unregister", s.wslClient.DistroName)
 			os.RemoveAll(absInstallDir)
 			os.MkdirAll(absInstallDir, 0755)
@@ -96,7 +118,7 @@ func (s *WSLImageService) Pull(image string) error {
 			}
 		}
 
-		fmt.Println("Installing container-shim...")
+		fmt.Fprintln(out, "Installing container-shim...")
 		if err := s.wslClient.RunDistroCommandWithInput(shim.Content, "sh", "-c", "cat > /usr/local/bin/container-shim && chmod +x /usr/local/bin/container-shim"); err != nil {
 			return err
 		}
@@ -107,7 +129,7 @@ func (s *WSLImageService) Pull(image string) error {
 		}
 
 		// Cache this image into WSL storage for Run/Build to use
-		fmt.Println("Caching bootstrap image to WSL storage...")
+		fmt.Fprintln(out, "Caching bootstrap image to WSL storage...")
 		wslWinPath, _ := wsl.WindowsToWslPath(targetFile)
 		targetWslFile := path.Join(wslImagesDir, image+".tar.gz")
 		s.wslClient.RunDistroCommand("cp", wslWinPath, targetWslFile)
@@ -123,12 +145,12 @@ func (s *WSLImageService) Pull(image string) error {
 
 	// Check if exists in WSL
 	if err := s.wslClient.RunDistroCommand("test", "-f", targetWslFile); err == nil {
-		fmt.Printf("Image '%s' already exists.\n", image)
+		fmt.Fprintf(out, "Image '%s' already exists.\n", image)
 		return nil
 	}
 
 	// Native Download for other images
-	fmt.Printf("Pulling image '%s' inside WSL...\n", image)
+	fmt.Fprintf(out, "Pulling image '%s' inside WSL...\n", image)
 	downloadCmd := fmt.Sprintf("wget -O %s %s || curl -L -o %s %s", targetWslFile, url, targetWslFile, url)
 	if err := s.wslClient.RunDistroCommand("sh", "-c", downloadCmd); err != nil {
 		return fmt.Errorf("error downloading image in WSL: %w", err)
@@ -137,251 +159,445 @@ func (s *WSLImageService) Pull(image string) error {
 	return nil
 }
 
-func (s *WSLImageService) Build(ctxDir string, dockerfile string, tag string) (string, error) {
+// wslBuild is the state of one Build call, shared by its stages. Nothing build-specific
+// lives on WSLImageService, so concurrent builds don't interfere.
+type wslBuild struct {
+	s       *WSLImageService
+	opts    BuildOptions
+	df      *Dockerfile
+	report  stepReporter
+	dir     string            // working directory of this build inside WSL
+	digests map[string]string // image -> sha256 of its tarball
+	stages  []*wslStage       // by stage index; nil for stages that are not needed
+
+	fromMu     sync.Mutex
+	fromImages map[string]string // images used by COPY --from, extracted into dir
+}
+
+// wslStage is a stage of the build and, once built, its result.
+type wslStage struct {
+	index      int
+	report     stepReporter
+	baseStage  *wslStage         // FROM <stage>; nil when the base is an image
+	rootImage  string            // image at the root of the layer chain
+	rootDigest string            // its digest
+	key        string            // cache key of the stage's final state
+	hashes     []string          // cache key of every step
+	from       map[string]string // COPY --from value -> key of that stage or image
+
+	state       *stageState
+	manifest    string // rootfs state at parentLayer
+	parentLayer string // last checkpoint ("" = the root image)
+	shortcut    string // full snapshot of the final state when every step hit the cache
+}
+
+func (s *WSLImageService) Build(opts BuildOptions) (_ string, err error) {
+	build := stepReporter{progress: opts.progress()}
+	defer func() {
+		if err != nil {
+			build.reportFailure(err)
+		}
+	}()
+
+	ctxDir := opts.ContextDir
+	dockerfile := opts.Dockerfile
 	if dockerfile == "" {
 		dockerfile = "Dockerfile"
 	}
-	dockerfilePath := filepath.Join(ctxDir, dockerfile)
+	dockerfilePath := dockerfile
+	if !filepath.IsAbs(dockerfilePath) {
+		dockerfilePath = filepath.Join(ctxDir, dockerfile)
+	}
 	df, err := ParseDockerfile(dockerfilePath)
 	if err != nil {
 		return "", fmt.Errorf("failed to parse Dockerfile: %w", err)
 	}
+	df.ApplyGlobalArgs(opts.BuildArgs)
+	if err := applyStageOnBuildTriggers(df, s.Inspect, build); err != nil {
+		return "", err
+	}
+	if unused := UnusedBuildArgs(df.allInstructions(), opts.BuildArgs); len(unused) > 0 {
+		build.Warnf("one or more build-args %v were not consumed", unused)
+	}
 
-	// 1. Calculate Hash Chain to determine where to resume
-	// parentHash starts with the Base Image + "FROM"
-	parentHash := fmt.Sprintf("%x", sha256.Sum256([]byte("FROM "+df.Base)))
-
-	// Hashes for each instruction index
-	stepHashes := make([]string, len(df.Instructions))
-
-	for i, instr := range df.Instructions {
-		h, err := CalculateInstructionHash(parentHash, instr, ctxDir)
-		if err != nil {
-			return "", fmt.Errorf("failed to calculate hash for step %d: %w", i, err)
-		}
-		stepHashes[i] = h
-		parentHash = h
+	b := &wslBuild{
+		s:          s,
+		opts:       opts,
+		df:         df,
+		report:     build,
+		digests:    make(map[string]string),
+		stages:     make([]*wslStage, len(df.Stages)),
+		fromImages: make(map[string]string),
 	}
 
-	// 2. Find the last cache hit (Fast Forward)
-	lastHitIndex := -1
-	for i := len(stepHashes) - 1; i >= 0; i-- {
-		cacheFile := path.Join(GetWslCacheDir(), stepHashes[i]+".tar.gz")
-		if err := s.wslClient.RunDistroCommand("test", "-f", cacheFile); err == nil {
-			lastHitIndex = i
-			break
+	// 1. Calculate Hash Chains to determine where to resume
+	for _, i := range df.RequiredStages() {
+		if err := b.planStage(i); err != nil {
+			return "", err
 		}
 	}
 
-	// 3. Prepare Build Directory
-	imageName := tag
+	// 2. Prepare Build Directory (unique per build)
+	imageName := opts.Tag
 	if imageName == "" {
 		imageName = strings.ToLower(filepath.Base(ctxDir))
 	}
-	fmt.Printf("Building image '%s' from %s...\n", imageName, df.Base)
-
-	buildId := fmt.Sprintf("build-%d", os.Getpid())
-	buildDir := fmt.Sprintf("/var/lib/pocketlinx/builds/%s", buildId)
-	rootfsDir := path.Join(buildDir, "rootfs")
-	s.wslClient.RunDistroCommand("mkdir", "-p", rootfsDir)
-	defer s.wslClient.RunDistroCommand("rm", "-rf", buildDir)
-
-	// 4. Restore state OR Initialize Base
-	allCached := false
-	if lastHitIndex >= 0 {
-		hitHash := stepHashes[lastHitIndex]
-		if lastHitIndex == len(df.Instructions)-1 {
-			allCached = true
-			fmt.Printf("CACHED: Entire Dockerfile hit cache. Enabling Build Shortcut (instant save).\n")
-		} else {
-			fmt.Printf("CACHED: Resuming from step %d (Hash: %s)\n", lastHitIndex+1, hitHash[:12])
-			if _, err := s.LoadCache(hitHash, rootfsDir); err != nil {
-				return "", fmt.Errorf("failed to load cache %s: %w", hitHash, err)
-			}
+	build.emit(BuildEvent{Type: BuildStarted, Image: imageName, Message: df.Final().Base})
+
+	b.dir = path.Join("/var/lib/pocketlinx/builds", newBuildID())
+	if err := s.wslClient.RunDistroCommand("mkdir", "-p", b.dir); err != nil {
+		return "", fmt.Errorf("failed to create build directory: %w", err)
+	}
+	defer s.wslClient.RunDistroCommand("rm", "-rf", b.dir)
+
+	// 3. Build the stages; independent stages run in parallel
+	if err := runStages(df, b.buildStage); err != nil {
+		return "", err
+	}
+	final := b.stages[len(df.Stages)-1]
+
+	// 4. Final Save
+	outputTarWsl := path.Join(GetWslImagesDir(), imageName+".tar.gz")
+
+	if final.shortcut != "" {
+		build.emit(BuildEvent{Type: BuildInfo, Message: "Shortcut: Mapping last cache layer to final image..."})
+		if err := s.wslClient.RunDistroCommand("sh", "-c", fmt.Sprintf("cat %s | %s", shellQuote(final.shortcut), atomicWriteScript(outputTarWsl))); err != nil {
+			return "", build.fail(fmt.Errorf("build shortcut failed: %w", err))
 		}
 	} else {
-		// Initialize from Base Image
-		baseTarWsl := path.Join(GetWslImagesDir(), df.Base+".tar.gz")
-		if err := s.wslClient.RunDistroCommand("test", "-f", baseTarWsl); err != nil {
-			fmt.Printf("Base image not found, pulling %s...\n", df.Base)
-			if err := s.Pull(df.Base); err != nil {
-				return "", fmt.Errorf("failed to pull base image %s: %w", df.Base, err)
-			}
+		// Move pipe INSIDE WSL to prevent CRLF corruption via wsl.exe stdout (v0.7.3)
+		saveCmd := s.wslClient.PrepareDistroCommand("sh", "-c", imageArchiveScript(final.state.rootfs, outputTarWsl, opts))
+		// Simple progress (elapsed time) since we can't safely monitor bytes via Go stdout
+		if err := build.Track(fmt.Sprintf("Saving image to %s", outputTarWsl), saveCmd.Run); err != nil {
+			return "", build.fail(fmt.Errorf("save failed: %w", err))
 		}
-		if err := s.wslClient.RunDistroCommand("tar", "-xzf", baseTarWsl, "-C", rootfsDir); err != nil {
-			return "", fmt.Errorf("failed to extract base image: %w", err)
+
+		// The image is the full rootfs of the last step: keep it (hard-linked, no extra space)
+		// as that step's snapshot so an all-cached rebuild can skip replaying the layer chain
+		if len(final.hashes) > 0 && final.parentLayer == final.hashes[len(final.hashes)-1] {
+			snapshot := path.Join(GetWslCacheDir(), final.parentLayer+".full.tar.gz")
+			_ = s.wslClient.RunDistroCommand("sh", "-c", fmt.Sprintf("T=%s.$$ && { ln -f %s \"$T\" 2>/dev/null || cp %s \"$T\"; } && mv \"$T\" %s",
+				shellQuote(snapshot), shellQuote(outputTarWsl), shellQuote(outputTarWsl), shellQuote(snapshot)))
 		}
 	}
 
-	// 5. Execute Remaining Steps
-	currentWorkdir := "/"
-	s.currentUser = "root" // Reset to root for new build
-	envMap := make(map[string]string)
-	envPrefix := ""
+	// 5. Save Image Metadata
+	metaJSON, _ := json.MarshalIndent(final.state.metadata(), "", "  ")
+	metaFileWsl := path.Join(GetWslImagesDir(), imageName+".json")
+	_ = s.wslClient.RunDistroCommandWithInput(string(metaJSON), "sh", "-c", atomicWriteScript(metaFileWsl))
 
-	for i, instr := range df.Instructions {
-		if instr.Type == "ENV" {
-			for j := 0; j < len(instr.Args); j += 2 {
-				k := instr.Args[j]
-				v := ""
-				if j+1 < len(instr.Args) {
-					v = instr.Args[j+1]
-				}
-				envMap[k] = v
-				// Expand variables in the value using current envMap (v1.0.8)
-				expandedV := os.Expand(v, func(name string) string {
-					if val, ok := envMap[name]; ok {
-						return val
-					}
-					// If not in our map, it might be a system/base image env
-					// For now, return the literal to avoid accidental clearing
-					// but Docker-style $PATH will be handled if it's in envMap
-					return "$" + name
-				})
-				envMap[k] = expandedV
-				envPrefix += fmt.Sprintf("export %s=%q; ", k, expandedV)
-			}
-		}
+	build.emit(BuildEvent{Type: BuildFinished, Image: imageName})
+	return imageName, nil
+}
 
-		// Update state even if we skip execution because of cache
-		if instr.Type == "WORKDIR" && len(instr.Args) > 0 {
-			currentWorkdir = instr.Args[0]
+// imageDigest returns the digest of a local image, pulling it first if needed.
+// The cache is keyed on image contents, so a re-pulled image invalidates it.
+func (b *wslBuild) imageDigest(image string) (string, error) {
+	if digest, ok := b.digests[image]; ok {
+		return digest, nil
+	}
+	tarWsl := path.Join(GetWslImagesDir(), image+".tar.gz")
+	if err := b.s.wslClient.RunDistroCommand("test", "-f", tarWsl); err != nil {
+		b.report.emit(BuildEvent{Type: BuildInfo, Message: fmt.Sprintf("Base image not found, pulling %s...", image)})
+		out := b.report.Writer()
+		err := b.s.pull(image, out)
+		out.Close()
+		if err != nil {
+			return "", fmt.Errorf("failed to pull base image %s: %w", image, err)
 		}
-		if instr.Type == "USER" && len(instr.Args) > 0 {
-			s.currentUser = instr.Args[0]
+	}
+	digest, err := b.s.wslClient.RunDistroCommandOutput("sh", "-c", fmt.Sprintf("sha256sum %s | cut -d' ' -f1", shellQuote(tarWsl)))
+	if err != nil {
+		return "", fmt.Errorf("failed to hash base image %s: %w", image, err)
+	}
+	b.digests[image] = strings.TrimSpace(digest)
+	return b.digests[image], nil
+}
+
+// planStage computes the cache keys of stage i. Stages it depends on are planned first.
+func (b *wslBuild) planStage(i int) error {
+	stage := b.df.Stages[i]
+	st := &wslStage{
+		index:  i,
+		report: stepReporter{progress: b.report.progress, stage: b.df.StageLabel(i)},
+		from:   make(map[string]string),
+	}
+
+	baseKey := ""
+	if j := b.df.StageIndex(stage.Base, i); j >= 0 {
+		st.baseStage = b.stages[j]
+		st.rootImage, st.rootDigest = st.baseStage.rootImage, st.baseStage.rootDigest
+		baseKey = "stage:" + st.baseStage.key
+	} else {
+		digest, err := b.imageDigest(stage.Base)
+		if err != nil {
+			return err
 		}
+		st.rootImage, st.rootDigest = stage.Base, digest
+		baseKey = "sha256:" + digest
+	}
 
-		// Skip execution if covered by cache
-		if i <= lastHitIndex {
+	for _, instr := range stage.Instructions {
+		from := instr.Flag("from")
+		if instr.Type != "COPY" || from == "" {
 			continue
 		}
+		if j := b.df.StageIndex(from, i); j >= 0 {
+			st.from[from] = "stage:" + b.stages[j].key
+			continue
+		}
+		digest, err := b.imageDigest(from)
+		if err != nil {
+			return err
+		}
+		st.from[from] = "sha256:" + digest
+	}
 
-		// Execute Step
-		fmt.Printf("[%d/%d] %s %s\n", i+1, len(df.Instructions), instr.Type, instr.Raw)
+	hashes, err := CalculateBuildHashes(baseKey, stage.Instructions, b.opts.ContextDir, b.opts.BuildArgs, st.from)
+	if err != nil {
+		return err
+	}
+	st.hashes = hashes
+	st.key = StageBaseKey(baseKey)
+	if len(hashes) > 0 {
+		st.key = hashes[len(hashes)-1]
+	}
+	b.stages[i] = st
+	return nil
+}
 
-		isSkippable := false
-		switch strings.ToUpper(instr.Type) {
-		case "ENV", "USER", "WORKDIR", "LABEL", "COPY", "ADD":
-			isSkippable = true
-		}
+// buildStage builds stage i into its own rootfs. The stages it depends on have finished.
+func (b *wslBuild) buildStage(i int) error {
+	s := b.s
+	st := b.stages[i]
+	stage := b.df.Stages[i]
+	isFinal := i == len(b.df.Stages)-1
+	report := st.report
+	if report.stage != "" {
+		report.emit(BuildEvent{Type: BuildInfo, Message: fmt.Sprintf("[%s] FROM %s", report.stage, stage.Base)})
+	}
 
-		switch instr.Type {
-		case "RUN":
-			if err := s.executeBuildRun(envPrefix, instr.Raw, rootfsDir, currentWorkdir); err != nil {
-				return "", fmt.Errorf("RUN failed: %w", err)
-			}
+	stageDir := path.Join(b.dir, fmt.Sprintf("stage-%d", i))
+	st.state = newStageState(path.Join(stageDir, "rootfs"))
+	st.manifest = path.Join(stageDir, "state.manifest")
+	rootfsDir := st.state.rootfs
+	if err := s.wslClient.RunDistroCommand("mkdir", "-p", rootfsDir); err != nil {
+		return fmt.Errorf("failed to create stage directory: %w", err)
+	}
+	if st.baseStage != nil {
+		st.state.inheritStage(st.baseStage.state)
+	} else if baseMeta, err := s.Inspect(stage.Base); err == nil {
+		// LABEL/EXPOSE/VOLUME/HEALTHCHECK/STOPSIGNAL are inherited from the base image (ONBUILD is not)
+		st.state.inheritImage(baseMeta)
+	}
 
-		case "COPY":
-			if err := s.executeBuildCopy(ctxDir, instr.Args[0], instr.Args[1], rootfsDir, currentWorkdir); err != nil {
-				return "", fmt.Errorf("COPY failed: %w", err)
-			}
+	// Find the last cache hit (Fast Forward)
+	// Steps selected by --no-cache / --no-cache-filter (and everything after them) are rebuilt
+	lookupLimit := CacheLookupLimit(b.opts, stage)
+	lastHitIndex := -1
+	for k := lookupLimit - 1; k >= 0; k-- {
+		if s.cacheExists(st.hashes[k]) {
+			lastHitIndex = k
+			break
+		}
+	}
 
-		case "USER":
-			s.currentUser = instr.Args[0]
-			fmt.Printf("Switching build user to %s\n", s.currentUser)
+	// Restore state OR Initialize Base
+	// Cache entries are diffs against the previous checkpoint; parentLayer is the
+	// checkpoint the next one builds on ("" = the root image).
+	switch {
+	case lastHitIndex >= 0:
+		hitHash := st.hashes[lastHitIndex]
+		st.parentLayer = hitHash
+		// Only the image can come from a snapshot: other stages need their rootfs
+		if isFinal && lastHitIndex == len(stage.Instructions)-1 && !b.opts.Reproducible {
+			st.shortcut = s.fullSnapshot(hitHash)
+		}
+		if st.shortcut != "" {
+			report.emit(BuildEvent{Type: BuildInfo, Message: "Entire Dockerfile hit cache. Enabling Build Shortcut (instant save)."})
+			break
+		}
+		report.emit(BuildEvent{Type: BuildInfo, Message: fmt.Sprintf("Resuming from step %d (Hash: %s)", lastHitIndex+1, hitHash[:12])})
+		if _, err := s.LoadCache(hitHash, rootfsDir, report); err != nil {
+			return fmt.Errorf("failed to load cache %s: %w", hitHash, err)
+		}
+		if err := s.writeManifest(rootfsDir, st.manifest); err != nil {
+			return fmt.Errorf("failed to scan rootfs: %w", err)
+		}
 
-		case "WORKDIR":
-			if len(instr.Args) > 0 {
-				currentWorkdir = instr.Args[0]
-				workdirPath := path.Join(rootfsDir, strings.TrimPrefix(currentWorkdir, "/"))
-				_ = s.wslClient.RunDistroCommand("mkdir", "-p", workdirPath)
-			}
+	case st.baseStage != nil:
+		// Continue from the base stage's rootfs, and its layer chain
+		base := st.baseStage
+		st.parentLayer = base.parentLayer
+		if err := s.wslClient.RunDistroCommand("sh", "-c", fmt.Sprintf("cp -a %s/. %s/ && cp %s %s",
+			shellQuote(base.state.rootfs), shellQuote(rootfsDir), shellQuote(base.manifest), shellQuote(st.manifest))); err != nil {
+			return fmt.Errorf("failed to copy stage %s: %w", b.df.StageLabel(base.index), err)
 		}
 
-		// Save Cache after execution
-		// Optimization: Skip caching for non-RUN steps UNLESS it's the last step.
-		isLastStep := (i == len(df.Instructions)-1)
-		if !isSkippable || isLastStep {
-			fmt.Printf("Checkpointing state (Step %d/%d)...\n", i+1, len(df.Instructions))
-			stepHash := stepHashes[i]
-			if err := s.SaveCache(stepHash, rootfsDir); err != nil {
-				fmt.Printf("Warning: Failed to save cache for step %d: %v\n", i, err)
-			}
-		} else {
-			fmt.Println("Lightweight step, skipping intermediate checkpoint to save time.")
+	default:
+		// Initialize from Base Image
+		baseTarWsl := path.Join(GetWslImagesDir(), stage.Base+".tar.gz")
+		if err := s.wslClient.RunDistroCommand("tar", "-xzf", baseTarWsl, "-C", rootfsDir); err != nil {
+			return fmt.Errorf("failed to extract base image: %w", err)
+		}
+		if err := s.writeManifest(rootfsDir, st.manifest); err != nil {
+			return fmt.Errorf("failed to scan rootfs: %w", err)
 		}
 	}
 
-	// 6. Final Save
-	outputTarWsl := path.Join(GetWslImagesDir(), imageName+".tar.gz")
+	// Execute Remaining Steps
+	for k, instr := range stage.Instructions {
+		step := report.forStep(k, len(stage.Instructions), instr)
 
-	if allCached {
-		fmt.Printf("Shortcut: Mapping last cache layer to final image...\n")
-		lastHash := stepHashes[lastHitIndex]
-		cacheFile := path.Join(GetWslCacheDir(), lastHash+".tar.gz")
-		if err := s.wslClient.RunDistroCommand("cp", cacheFile, outputTarWsl); err != nil {
-			return "", fmt.Errorf("build shortcut failed: %w", err)
-		}
-	} else {
-		fmt.Printf("Saving image to %s (WSL)...\n", outputTarWsl)
+		// Update state even if we skip execution because of cache
+		st.state.apply(instr, b.opts.BuildArgs, step)
 
-		startSave := time.Now()
-		// Move pipe INSIDE WSL to prevent CRLF corruption via wsl.exe stdout (v0.7.3)
-		saveCmd := s.wslClient.PrepareDistroCommand("sh", "-c", fmt.Sprintf("tar -C '%s' -cf - . | gzip > '%s'", rootfsDir, outputTarWsl))
-		if err := saveCmd.Start(); err != nil {
-			return "", fmt.Errorf("failed to start save: %w", err)
+		// Skip execution if covered by cache
+		if k <= lastHitIndex {
+			step.emit(BuildEvent{Type: StepCached})
+			continue
 		}
 
-		// Simple progress (elapsed time) since we can't safely monitor bytes via Go stdout
-		done := make(chan error, 1)
-		go func() {
-			done <- saveCmd.Wait()
-		}()
-
-		ticker := time.NewTicker(1 * time.Second)
-		defer ticker.Stop()
-
-	Loop:
-		for {
-			select {
-			case err := <-done:
+		// Save Cache after execution
+		// Optimization: Skip caching for non-RUN steps UNLESS it's the last step.
+		isSkippable := false
+		switch strings.ToUpper(instr.Type) {
+		case "ENV", "ARG", "USER", "WORKDIR", "LABEL", "COPY", "ADD", "EXPOSE", "VOLUME", "HEALTHCHECK", "STOPSIGNAL", "SHELL", "ONBUILD":
+			isSkippable = true
+		}
+		checkpoint := !isSkippable || k == len(stage.Instructions)-1
+		stepHash := st.hashes[k]
+
+		// Concurrent builds compute an identical step once: the first one holds the
+		// key's lock while it runs, the others wait and then take its result from the cache
+		release := func() {}
+		if checkpoint {
+			if unlock, err := s.lockCacheKey(stepHash, step); err != nil {
+				step.Warnf("%v", err)
+			} else {
+				release = unlock
+			}
+			if k < lookupLimit && s.cacheExists(stepHash) {
+				step.emit(BuildEvent{Type: StepCached})
+				_, err := s.LoadCache(stepHash, rootfsDir, step)
+				if err == nil {
+					err = s.writeManifest(rootfsDir, st.manifest)
+				}
+				release()
 				if err != nil {
-					return "", fmt.Errorf("save failed: %w", err)
+					return step.fail(fmt.Errorf("failed to load cache %s: %w", stepHash[:12], err))
 				}
-				break Loop
-			case <-ticker.C:
-				fmt.Printf("\x1b[2K\rSaving image... (%ds elapsed)", int(time.Since(startSave).Seconds()))
+				st.parentLayer = stepHash
+				continue
 			}
 		}
-		fmt.Printf("\x1b[2K\rSaving image... done. (%s)\n", time.Since(startSave).Round(time.Second))
-	}
-
-	// 7. Save Image Metadata
-	// Get CMD if any
-	var finalCmd []string
-	for _, instr := range df.Instructions {
-		if instr.Type == "CMD" {
-			// Re-parse CMD form (simple logic matches cmd_run.go)
-			args := instr.Raw
-			if strings.HasPrefix(args, "[") && strings.HasSuffix(args, "]") {
-				trimmed := strings.Trim(args, "[]")
-				parts := strings.Split(trimmed, ",")
-				for i, p := range parts {
-					parts[i] = strings.Trim(strings.TrimSpace(p), "\"")
-				}
-				finalCmd = parts
+
+		// Execute Step
+		step.emit(BuildEvent{Type: StepStarted})
+		if err := b.executeStep(st, instr, step); err != nil {
+			release()
+			return step.fail(err)
+		}
+
+		if checkpoint {
+			layer := CacheLayer{Parent: st.parentLayer, Base: st.rootImage, BaseDigest: st.rootDigest}
+			if err := s.SaveCache(stepHash, layer, rootfsDir, st.manifest, step); err != nil {
+				step.Warnf("failed to save cache for step %d: %v", k+1, err)
 			} else {
-				finalCmd = []string{"sh", "-c", args}
+				st.parentLayer = stepHash
 			}
+			release()
 		}
 	}
+	return nil
+}
+
+// executeStep runs one instruction of a stage.
+func (b *wslBuild) executeStep(st *wslStage, instr Instruction, step stepReporter) error {
+	s := b.s
+	state := st.state
+	switch instr.Type {
+	case "RUN":
+		mounts, err := resolveRunMounts(instr, b.opts.Secrets, GetWslCacheMountsDir(), wsl.WindowsToWslPath, step)
+		if err != nil {
+			return err
+		}
+		if err := s.executeBuildRun(state.argPrefix+state.envPrefix, instr.ShellCommand(), state.rootfs, state.workdir, state.user, mounts, step); err != nil {
+			return fmt.Errorf("RUN failed: %w", err)
+		}
 
-	metaData := ImageMetadata{
-		User:    s.currentUser,
-		Workdir: currentWorkdir,
-		Env:     envMap,
-		Command: finalCmd,
+	case "COPY", "ADD":
+		if len(instr.Args) < 2 {
+			return fmt.Errorf("%s requires a source and a destination", instr.Type)
+		}
+		if instr.Type == "COPY" && instr.Flag("from") != "" {
+			if err := b.copyFrom(st, instr, step); err != nil {
+				return fmt.Errorf("COPY failed: %w", err)
+			}
+			break
+		}
+		if err := s.executeBuildCopy(b.opts.ContextDir, instr, state.rootfs, state.workdir, step); err != nil {
+			return fmt.Errorf("%s failed: %w", instr.Type, err)
+		}
+
+	case "USER":
+		step.Logf("Switching build user to %s", state.user)
+
+	case "WORKDIR":
+		if len(instr.Args) > 0 {
+			workdirPath := path.Join(state.rootfs, strings.TrimPrefix(state.workdir, "/"))
+			_ = s.wslClient.RunDistroCommand("mkdir", "-p", workdirPath)
+		}
 	}
-	metaJSON, _ := json.MarshalIndent(metaData, "", "  ")
-	metaFileWsl := path.Join(GetWslImagesDir(), imageName+".json")
-	_ = s.wslClient.RunDistroCommandWithInput(string(metaJSON), "sh", "-c", fmt.Sprintf("cat > '%s'", metaFileWsl))
+	return nil
+}
 
-	fmt.Printf("\nSuccessfully built image '%s'\n", imageName)
-	return imageName, nil
+// copyFrom runs COPY --from=<stage|image>.
+func (b *wslBuild) copyFrom(st *wslStage, instr Instruction, step stepReporter) error {
+	from := instr.Flag("from")
+	srcRoot := ""
+	if j := b.df.StageIndex(from, st.index); j >= 0 {
+		srcRoot = b.stages[j].state.rootfs
+	} else {
+		root, err := b.imageRootfs(from)
+		if err != nil {
+			return err
+		}
+		srcRoot = root
+	}
+
+	destPath := instr.Dest()
+	if !path.IsAbs(destPath) {
+		destPath = path.Join(st.state.workdir, destPath)
+	}
+	step.Logf("COPY --from=%s %s to %s", from, strings.Join(instr.Sources(), " "), instr.Dest())
+	script := stageCopyScript(srcRoot, instr.Sources(), st.state.rootfs, destPath, strings.HasSuffix(instr.Dest(), "/"), instr.Flag("chmod"), instr.Flag("chown"))
+
+	out := step.Writer()
+	defer out.Close()
+	copyCmd := b.s.wslClient.PrepareDistroCommand("sh", "-c", script)
+	copyCmd.Stdout = out
+	copyCmd.Stderr = out
+	return copyCmd.Run()
+}
+
+// imageRootfs extracts an image used by COPY --from once per build.
+func (b *wslBuild) imageRootfs(image string) (string, error) {
+	b.fromMu.Lock()
+	defer b.fromMu.Unlock()
+	if dir, ok := b.fromImages[image]; ok {
+		return dir, nil
+	}
+	dir := path.Join(b.dir, "from", image)
+	tarWsl := path.Join(GetWslImagesDir(), image+".tar.gz")
+	if err := b.s.wslClient.RunDistroCommand("sh", "-c", fmt.Sprintf("mkdir -p %s && tar -xzf %s -C %s", shellQuote(dir), shellQuote(tarWsl), shellQuote(dir))); err != nil {
+		return "", fmt.Errorf("failed to extract image %s: %w", image, err)
+	}
+	b.fromImages[image] = dir
+	return dir, nil
 }
 
-func (s *WSLImageService) executeBuildRun(envPrefix string, runCmd string, rootfsDir string, currentWorkdir string) error {
-	fmt.Printf("STEP: RUN %s\n", runCmd)
+func (s *WSLImageService) executeBuildRun(envPrefix string, runCmd string, rootfsDir string, currentWorkdir string, user string, mounts []buildMount, step stepReporter) error {
 
 	// 3. Create a temporary script for the command to avoid quoting issues
 	scriptName := fmt.Sprintf("build_step_%d.sh", time.Now().UnixNano())
@@ -412,8 +628,16 @@ func (s *WSLImageService) executeBuildRun(envPrefix string, runCmd string, rootf
 
 	// Use su if a non-root user is requested
 	execCmd := fmt.Sprintf("/tmp/%s", scriptName)
-	if s.currentUser != "" && s.currentUser != "root" {
-		execCmd = fmt.Sprintf("su %s -c \"/tmp/%s\"", s.currentUser, scriptName)
+	if user != "" && user != "root" {
+		execCmd = fmt.Sprintf("su %s -c \"/tmp/%s\"", user, scriptName)
+	}
+
+	// RUN --mount: bind secrets and caches only for this command
+	mountSetup, mountTeardown := "", ""
+	if len(mounts) > 0 {
+		setup, teardown := mountScript(rootfsDir, mounts)
+		mountSetup = "{\n" + setup + "\n} && "
+		mountTeardown = teardown + "\n"
 	}
 
 	// 隔離環境のセットアップと実行
@@ -428,130 +652,159 @@ func (s *WSLImageService) executeBuildRun(envPrefix string, runCmd string, rootf
 			"mknod -m 666 %s/dev/urandom c 1 9 && "+
 			"mkdir -p %s/etc && "+
 			"cat /etc/resolv.conf > %s/etc/resolv.conf && "+
-			"chroot %s %s; "+
-			"RET=$?; umount %s/proc %s/sys; exit $RET",
+			"%schroot %s %s; "+
+			"RET=$?; %sumount %s/proc %s/sys; exit $RET",
 		rootfsDir, rootfsDir, rootfsDir, rootfsDir, currentWorkdir,
 		rootfsDir, rootfsDir,
 		rootfsDir, rootfsDir, rootfsDir, rootfsDir, // for rm -f
 		rootfsDir, rootfsDir, rootfsDir, rootfsDir, // for mknod
 		rootfsDir, // for mkdir -p %s/etc
 		rootfsDir, // for cat /etc/resolv.conf > ...
-		rootfsDir, execCmd,
-		rootfsDir, rootfsDir,
+		mountSetup, rootfsDir, execCmd,
+		mountTeardown, rootfsDir, rootfsDir,
 	)
 
-	return s.wslClient.RunDistroCommand("unshare", "--mount", "sh", "-c", fullCmd)
+	// Stream the command's output as step events
+	out := step.Writer()
+	defer out.Close()
+	chrootCmd := s.wslClient.PrepareDistroCommand("unshare", "--mount", "sh", "-c", fullCmd)
+	chrootCmd.Stdout = out
+	chrootCmd.Stderr = out
+	return chrootCmd.Run()
 }
 
-func (s *WSLImageService) executeBuildCopy(ctxDir, srcArg, destArg, rootfsDir, currentWorkdir string) error {
-	src := filepath.Join(ctxDir, srcArg)
-	dest := path.Join(rootfsDir, strings.TrimPrefix(path.Join(currentWorkdir, destArg), "/"))
-
-	// Load ignore patterns from .plxignore
-	ignorePatterns := make(map[string]bool)
-	ignoreFile := filepath.Join(ctxDir, ".plxignore")
-	if data, err := os.ReadFile(ignoreFile); err == nil {
-		lines := strings.Split(string(data), "\n")
-		for _, line := range lines {
-			line = strings.TrimSpace(line)
-			if line != "" && !strings.HasPrefix(line, "#") {
-				ignorePatterns[line] = true
-			}
+func (s *WSLImageService) executeBuildCopy(ctxDir string, instr Instruction, rootfsDir, currentWorkdir string, step stepReporter) error {
+	sources, err := ExpandSources(ctxDir, instr)
+	if err != nil {
+		return err
+	}
+	for _, src := range sources {
+		if err := s.copyBuildSource(ctxDir, instr, src, instr.Dest(), rootfsDir, currentWorkdir, step); err != nil {
+			return err
 		}
 	}
-	ignorePatterns[".git"] = true
+	return nil
+}
+
+func (s *WSLImageService) copyBuildSource(ctxDir string, instr Instruction, srcArg, destArg, rootfsDir, currentWorkdir string, step stepReporter) error {
+	isAdd := instr.Type == "ADD"
 
-	// Count files for progress visibility, respecting ignore patterns
-	fileCount := 0
-	_ = filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+	destPath := destArg
+	if !path.IsAbs(destPath) {
+		destPath = path.Join(currentWorkdir, destArg)
+	}
+	dest := path.Join(rootfsDir, strings.TrimPrefix(destPath, "/"))
+	destIsDir := strings.HasSuffix(destArg, "/")
+
+	// Resolve the source: ADD may download URLs, everything else comes from the host
+	src := ""
+	srcName := ""
+	extract := false
+	if isAdd && IsRemoteSource(srcArg) {
+		step.Logf("Downloading %s...", srcArg)
+		downloaded, err := FetchRemoteSource(srcArg, instr.Flag("checksum"))
 		if err != nil {
-			return nil
+			return err
 		}
-		relPath, _ := filepath.Rel(src, p)
-		if relPath != "." && (ignorePatterns[relPath] || ignorePatterns[filepath.Base(p)]) {
-			if d.IsDir() {
-				return filepath.SkipDir
+		src = downloaded
+		srcName = RemoteSourceName(srcArg)
+	} else {
+		src = ResolveLocalSource(ctxDir, srcArg)
+		srcName = filepath.Base(src)
+		if checksum := instr.Flag("checksum"); checksum != "" {
+			if err := VerifyChecksum(src, checksum); err != nil {
+				return fmt.Errorf("%s: %w", srcArg, err)
 			}
-			return nil
-		}
-		if !d.IsDir() {
-			fileCount++
 		}
-		return nil
-	})
+		// ADD auto-extracts local archives (remote downloads are copied as-is)
+		extract = isAdd && IsArchive(src)
+	}
 
-	fmt.Printf("STEP: COPY %s to %s (%d files detected after filtering)\n", srcArg, destArg, fileCount)
+	info, err := os.Stat(src)
+	if err != nil {
+		return fmt.Errorf("source %s not found: %w", srcArg, err)
+	}
 
 	srcWsl, err := wsl.WindowsToWslPath(src)
 	if err != nil {
 		return fmt.Errorf("failed to convert src path: %w", err)
 	}
 
-	// ホストからrootfs内へコピー
-	// .plxignore にあるディレクトリを除外するために tar を使用する
-	fmt.Printf("Copying files from Windows to Linux... ")
+	// The script copies into dest and records every top-level path it created in $LIST,
+	// so that --chown/--chmod only touch what this step added.
+	var script strings.Builder
+	script.WriteString("set -e\nLIST=$(mktemp)\n")
+	fmt.Fprintf(&script, "D=%s\n", shellQuote(dest))
 
-	excludeArgs := ""
-	for pattern := range ignorePatterns {
-		excludeArgs += fmt.Sprintf("--exclude=%q ", pattern)
-	}
+	switch {
+	case extract:
+		step.Logf("%s %s to %s (extracting archive)", instr.Type, srcArg, destArg)
+		fmt.Fprintf(&script, "mkdir -p \"$D\"\ntar -xf %s -C \"$D\"\n", shellQuote(srcWsl))
+		fmt.Fprintf(&script, "tar -tf %s | sed -e 's|^\\./||' -e 's|/.*||' | sort -u | while IFS= read -r e; do if [ -n \"$e\" ]; then printf '%%s\\n' \"$D/$e\"; fi; done > \"$LIST\"\n", shellQuote(srcWsl))
 
-	// Create parent dir and copy using tar to honor excludes
-	cmd := fmt.Sprintf("mkdir -p %s && tar -C %s %s -cf - . | tar -C %s -xf -", dest, srcWsl, excludeArgs, dest)
-	err = s.wslClient.RunDistroCommand("sh", "-c", cmd)
-	if err == nil {
-		fmt.Println("done.")
-	} else {
-		fmt.Println("failed.")
-	}
-	return err
-}
+	case info.IsDir():
+		ignore, err := LoadIgnoreMatcher(ctxDir)
+		if err != nil {
+			return err
+		}
+		entries, err := ListContextFiles(ctxDir, src, ignore)
+		if err != nil {
+			return fmt.Errorf("failed to scan %s: %w", srcArg, err)
+		}
 
-// Prune removes all cached layers
-func (s *WSLImageService) Prune() error {
-	return s.wslClient.RunDistroCommand("rm", "-rf", GetWslCacheDir()+"/*")
-}
+		fileCount := 0
+		var list strings.Builder
+		var topLevel []string
+		for _, e := range entries {
+			list.WriteString(e + "\x00")
+			if !strings.Contains(e, "/") {
+				topLevel = append(topLevel, e)
+			}
+			if st, err := os.Lstat(filepath.Join(src, filepath.FromSlash(e))); err == nil && !st.IsDir() {
+				fileCount++
+			}
+		}
 
-// LoadCache attempts to restore a layer from WSL cache
-func (s *WSLImageService) LoadCache(hash string, rootfs string) (bool, error) {
-	cacheFile := path.Join(GetWslCacheDir(), hash+".tar.gz")
+		step.Logf("%s %s to %s (%d files detected after filtering)", instr.Type, srcArg, destArg, fileCount)
 
-	// Check if cache file exists
-	if err := s.wslClient.RunDistroCommand("test", "-f", cacheFile); err != nil {
-		return false, nil // Cache miss
-	}
-
-	fmt.Printf("Restoring state from cache...\n")
-	s.wslClient.RunDistroCommand("rm", "-rf", rootfs+"/*")
+		// Send exactly the files the cache hash saw, as a NUL-separated list for tar -T
+		listWsl := path.Join("/tmp", fmt.Sprintf("plx-copy-%d.list", time.Now().UnixNano()))
+		if err := s.wslClient.RunDistroCommandWithInput(list.String(), "sh", "-c", fmt.Sprintf("cat > %s", shellQuote(listWsl))); err != nil {
+			return fmt.Errorf("failed to write file list: %w", err)
+		}
+		fmt.Fprintf(&script, "mkdir -p \"$D\"\ntar -C %s --null --no-recursion -T %s -cf - | tar -C \"$D\" -xf -\nrm -f %s\n", shellQuote(srcWsl), shellQuote(listWsl), shellQuote(listWsl))
+		for _, name := range topLevel {
+			fmt.Fprintf(&script, "printf '%%s\\n' \"$D\"/%s >> \"$LIST\"\n", shellQuote(name))
+		}
 
-	startRest := time.Now()
-	// Use native tar within WSL for speed (v0.7.5)
-	restCmd := s.wslClient.PrepareDistroCommand("tar", "-xzf", cacheFile, "-C", rootfs)
-	if err := restCmd.Start(); err != nil {
-		return false, fmt.Errorf("failed to start restoration: %w", err)
+	default:
+		step.Logf("%s %s to %s", instr.Type, srcArg, destArg)
+		// A trailing slash or an existing directory means "copy into", otherwise dest is the file name
+		fmt.Fprintf(&script, "if [ %t = true ] || [ -d \"$D\" ]; then mkdir -p \"$D\"; T=\"$D\"/%s; else mkdir -p \"$(dirname \"$D\")\"; T=\"$D\"; fi\n", destIsDir, shellQuote(srcName))
+		fmt.Fprintf(&script, "cp %s \"$T\"\nprintf '%%s\\n' \"$T\" > \"$LIST\"\n", shellQuote(srcWsl))
 	}
 
-	done := make(chan error, 1)
-	go func() {
-		done <- restCmd.Wait()
-	}()
+	if mode := instr.Flag("chmod"); mode != "" {
+		fmt.Fprintf(&script, "while IFS= read -r t; do chmod -R %s \"$t\"; done < \"$LIST\"\n", shellQuote(mode))
+	}
+	if owner := instr.Flag("chown"); owner != "" {
+		// chown inside the rootfs so that user/group names resolve against the image's /etc/passwd
+		fmt.Fprintf(&script, "R=%s\nwhile IFS= read -r t; do chroot \"$R\" chown -R %s \"${t#\"$R\"}\"; done < \"$LIST\"\n", shellQuote(rootfsDir), shellQuote(owner))
+	}
+	script.WriteString("rm -f \"$LIST\"\n")
 
-	ticker := time.NewTicker(1 * time.Second)
-	defer ticker.Stop()
+	// ホストからrootfs内へコピー
+	out := step.Writer()
+	defer out.Close()
+	copyCmd := s.wslClient.PrepareDistroCommand("sh", "-c", script.String())
+	copyCmd.Stdout = out
+	copyCmd.Stderr = out
+	return step.Track("Copying files from Windows to Linux", copyCmd.Run)
+}
 
-LoopRest:
-	for {
-		select {
-		case err := <-done:
-			if err != nil {
-				return false, fmt.Errorf("restoration failed: %w", err)
-			}
-			break LoopRest
-		case <-ticker.C:
-			fmt.Printf("\x1b[2K\rRestoring... (%ds elapsed)", int(time.Since(startRest).Seconds()))
-		}
-	}
-	return true, nil
+// Prune removes all cached layers and RUN --mount=type=cache contents
+func (s *WSLImageService) Prune() error {
+	return s.wslClient.RunDistroCommand("rm", "-rf", GetWslCacheDir()+"/*", GetWslCacheMountsDir())
 }
 
 func (s *WSLImageService) Diff(image1, image2 string) (string, error) {
@@ -655,8 +908,172 @@ func sortStrings(s []string) {
 	}
 }
 
-// SaveCache checkpoints the current rootfs state to WSL cache
-func (s *WSLImageService) SaveCache(hash string, rootfs string) error {
+// manifestCmd lists every path of a rootfs with the attributes that reveal a change
+// (type, size, mtime, mode, owner, link target), sorted for diffing.
+const manifestCmd = `cd '%s' && find . -mindepth 1 -printf '%%P\t%%y\t%%s\t%%T@\t%%m\t%%U:%%G\t%%l\n' | LC_ALL=C sort > '%s'`
+
+// layerDiffScript compares two manifests ($OLD = parent, $NEW = current) and writes the
+// paths to archive to $CH and the paths to delete before extracting to $WH.
+// A path whose file type changed is both deleted and archived.
+const layerDiffScript = `awk -F '\t' -v changed="$CH" -v wh="$WH" '
+FILENAME == ARGV[1] { old[$1] = $0; kind[$1] = $2; next }
+{
+	seen[$1] = 1
+	if (!($1 in old)) { print $1 > changed }
+	else if (old[$1] != $0) {
+		if (kind[$1] != $2) print $1 > wh
+		print $1 > changed
+	}
+}
+END { for (p in old) if (!(p in seen)) print p > wh }
+' "$OLD" "$NEW"`
+
+// writeManifest records the current state of rootfs, used as the parent of the next checkpoint.
+func (s *WSLImageService) writeManifest(rootfs, manifest string) error {
+	return s.wslClient.RunDistroCommand("sh", "-c", fmt.Sprintf(manifestCmd, rootfs, manifest))
+}
+
+// cacheExists reports whether a step's cache entry is complete. The tarball is renamed
+// into place after its metadata, so its presence means both are there.
+func (s *WSLImageService) cacheExists(hash string) bool {
+	return s.wslClient.RunDistroCommand("test", "-f", path.Join(GetWslCacheDir(), hash+".tar.gz")) == nil
+}
+
+// lockCacheKey takes an exclusive lock on a cache key. The lock is held by a flock
+// process inside WSL until release is called, or until plx exits.
+func (s *WSLImageService) lockCacheKey(hash string, step stepReporter) (release func(), err error) {
+	lockFile := path.Join(GetWslCacheDir(), hash+".lock")
+	cmd := s.wslClient.PrepareDistroCommand("sh", "-c", fmt.Sprintf(
+		"mkdir -p %s && exec 9>%s && { flock -n 9 || { echo waiting; flock 9; }; } && echo locked && read _",
+		shellQuote(GetWslCacheDir()), shellQuote(lockFile)))
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to lock cache key %s: %w", hash[:12], err)
+	}
+	release = func() {
+		stdin.Close()
+		cmd.Wait()
+	}
+
+	lines := bufio.NewReader(stdout)
+	for {
+		line, err := lines.ReadString('\n')
+		switch strings.TrimSpace(line) {
+		case "waiting":
+			step.Logf("Waiting for a concurrent build running the same step...")
+			continue
+		case "locked":
+			return release, nil
+		}
+		release()
+		if err == nil {
+			err = fmt.Errorf("unexpected output %q", line)
+		}
+		return nil, fmt.Errorf("failed to lock cache key %s: %w", hash[:12], err)
+	}
+}
+
+// readCacheLayer loads <hash>.json. It returns nil for a cache entry in the old
+// full-snapshot format, which has a tarball but no layer metadata.
+func (s *WSLImageService) readCacheLayer(hash string) (*CacheLayer, error) {
+	data, err := s.wslClient.RunDistroCommandOutput("cat", path.Join(GetWslCacheDir(), hash+".json"))
+	if err != nil {
+		if err := s.wslClient.RunDistroCommand("test", "-f", path.Join(GetWslCacheDir(), hash+".tar.gz")); err != nil {
+			return nil, fmt.Errorf("cache layer %s is missing", hash[:12])
+		}
+		return nil, nil
+	}
+	var layer CacheLayer
+	if err := json.Unmarshal([]byte(data), &layer); err != nil {
+		return nil, fmt.Errorf("corrupt cache layer %s: %w", hash[:12], err)
+	}
+	return &layer, nil
+}
+
+// fullSnapshot returns a complete rootfs tarball for a cached step, if one exists:
+// the image saved by the build that created it, or an old-format snapshot.
+func (s *WSLImageService) fullSnapshot(hash string) string {
+	snapshot := path.Join(GetWslCacheDir(), hash+".full.tar.gz")
+	if err := s.wslClient.RunDistroCommand("test", "-f", snapshot); err == nil {
+		return snapshot
+	}
+	if layer, err := s.readCacheLayer(hash); err == nil && layer == nil {
+		return path.Join(GetWslCacheDir(), hash+".tar.gz")
+	}
+	return ""
+}
+
+// LoadCache reconstructs the rootfs of a cached step by extracting the base image
+// and applying every diff layer of the chain in order.
+func (s *WSLImageService) LoadCache(hash string, rootfs string, report stepReporter) (bool, error) {
+	if err := s.wslClient.RunDistroCommand("test", "-f", path.Join(GetWslCacheDir(), hash+".tar.gz")); err != nil {
+		return false, nil // Cache miss
+	}
+
+	// Walk back to the root of the chain
+	var chain []string
+	root := ""
+	for h := hash; ; {
+		layer, err := s.readCacheLayer(h)
+		if err != nil {
+			return false, err
+		}
+		if layer == nil {
+			// Old-format entry: a full snapshot
+			root = path.Join(GetWslCacheDir(), h+".tar.gz")
+			break
+		}
+		chain = append([]string{h}, chain...)
+		if layer.Parent == "" {
+			root = path.Join(GetWslImagesDir(), layer.Base+".tar.gz")
+			break
+		}
+		h = layer.Parent
+	}
+
+	err := report.Track(fmt.Sprintf("Restoring state from cache (%d layer(s))", len(chain)), func() error {
+		if err := s.wslClient.RunDistroCommand("sh", "-c", fmt.Sprintf("rm -rf '%s' && mkdir -p '%s'", rootfs, rootfs)); err != nil {
+			return fmt.Errorf("failed to reset rootfs: %w", err)
+		}
+		// Use native tar within WSL for speed (v0.7.5)
+		if err := s.wslClient.RunDistroCommand("tar", "-xzf", root, "-C", rootfs); err != nil {
+			return fmt.Errorf("restoration failed: %w", err)
+		}
+		for _, h := range chain {
+			if err := s.applyCacheLayer(h, rootfs); err != nil {
+				return fmt.Errorf("failed to apply cache layer %s: %w", h[:12], err)
+			}
+		}
+		return nil
+	})
+	return err == nil, err
+}
+
+// applyCacheLayer removes the layer's whiteouts from rootfs and extracts its diff archive.
+func (s *WSLImageService) applyCacheLayer(hash, rootfs string) error {
+	layer, err := s.readCacheLayer(hash)
+	if err != nil {
+		return err
+	}
+	if layer != nil && len(layer.Whiteouts) > 0 {
+		list := strings.Join(layer.Whiteouts, "\x00") + "\x00"
+		if err := s.wslClient.RunDistroCommandWithInput(list, "sh", "-c", fmt.Sprintf("cd '%s' && xargs -0 rm -rf --", rootfs)); err != nil {
+			return fmt.Errorf("failed to apply whiteouts: %w", err)
+		}
+	}
+	return s.wslClient.RunDistroCommand("tar", "-xzf", path.Join(GetWslCacheDir(), hash+".tar.gz"), "-C", rootfs)
+}
+
+// SaveCache checkpoints the changes made since the state recorded in stateManifest
+// as a diff layer on top of layer.Parent, then advances stateManifest.
+func (s *WSLImageService) SaveCache(hash string, layer CacheLayer, rootfs string, stateManifest string, step stepReporter) error {
 	cacheDir := GetWslCacheDir()
 	cacheFile := path.Join(cacheDir, hash+".tar.gz")
 
@@ -665,37 +1082,42 @@ func (s *WSLImageService) SaveCache(hash string, rootfs string) error {
 		return err
 	}
 
-	fmt.Printf("Saving checkpoint...\n")
-
-	startSave := time.Now()
-	// Move pipe INSIDE WSL to prevent CRLF corruption (v0.7.3)
-	saveCmd := s.wslClient.PrepareDistroCommand("sh", "-c", fmt.Sprintf("tar -C '%s' -cf - . | gzip > '%s'", rootfs, cacheFile))
-	if err := saveCmd.Start(); err != nil {
-		return fmt.Errorf("failed to start save: %w", err)
+	newManifest := stateManifest + ".new"
+	changedList := stateManifest + ".changed"
+	whiteoutList := stateManifest + ".wh"
+	if err := s.writeManifest(rootfs, newManifest); err != nil {
+		return fmt.Errorf("failed to scan rootfs: %w", err)
+	}
+	diffCmd := fmt.Sprintf("OLD=%s NEW=%s CH=%s WH=%s\n: > \"$CH\"; : > \"$WH\"\n%s",
+		shellQuote(stateManifest), shellQuote(newManifest), shellQuote(changedList), shellQuote(whiteoutList), layerDiffScript)
+	if err := s.wslClient.RunDistroCommand("sh", "-c", diffCmd); err != nil {
+		return fmt.Errorf("failed to compute changes: %w", err)
 	}
 
-	done := make(chan error, 1)
-	go func() {
-		done <- saveCmd.Wait()
-	}()
+	whiteouts, err := s.wslClient.RunDistroCommandOutput("cat", whiteoutList)
+	if err != nil {
+		return fmt.Errorf("failed to read whiteouts: %w", err)
+	}
+	layer.Whiteouts = pruneWhiteouts(strings.Split(strings.TrimRight(whiteouts, "\n"), "\n"))
+	if count, err := s.wslClient.RunDistroCommandOutput("sh", "-c", fmt.Sprintf("wc -l < '%s'", changedList)); err == nil {
+		fmt.Sscanf(strings.TrimSpace(count), "%d", &layer.Changed)
+	}
 
-	ticker := time.NewTicker(1 * time.Second)
-	defer ticker.Stop()
+	// Metadata first: a tarball without its .json would be mistaken for an old full snapshot.
+	// Both are renamed into place, so a concurrent build never reads a partial entry.
+	layerJSON, _ := json.MarshalIndent(layer, "", "  ")
+	if err := s.wslClient.RunDistroCommandWithInput(string(layerJSON), "sh", "-c", atomicWriteScript(path.Join(cacheDir, hash+".json"))); err != nil {
+		return fmt.Errorf("failed to write layer metadata: %w", err)
+	}
 
-LoopSave:
-	for {
-		select {
-		case err := <-done:
-			if err != nil {
-				return fmt.Errorf("save failed: %w", err)
-			}
-			break LoopSave
-		case <-ticker.C:
-			fmt.Printf("\x1b[2K\rSaving checkpoint... (%ds elapsed)", int(time.Since(startSave).Seconds()))
-		}
+	// Move pipe INSIDE WSL to prevent CRLF corruption (v0.7.3)
+	saveCmd := s.wslClient.PrepareDistroCommand("sh", "-c", fmt.Sprintf(
+		"T=$(mktemp %s) && tar -C %s --no-recursion --verbatim-files-from -T %s -cf - | gzip > \"$T\" && chmod 644 \"$T\" && mv \"$T\" %s && mv %s %s",
+		shellQuote(cacheFile+".XXXXXX"), shellQuote(rootfs), shellQuote(changedList), shellQuote(cacheFile), shellQuote(newManifest), shellQuote(stateManifest)))
+	if err := step.Track("Saving checkpoint", saveCmd.Run); err != nil {
+		return fmt.Errorf("save failed: %w", err)
 	}
-	fmt.Printf("\x1b[2K\rSaving checkpoint... done. (%s)\n", time.Since(startSave).Round(time.Second))
-	fmt.Printf("\nSaving checkpoint... done.\n")
+	step.emit(BuildEvent{Type: StepCheckpoint, Message: fmt.Sprintf("%s: %d changed, %d removed", hash[:12], layer.Changed, len(layer.Whiteouts))})
 	return nil
 }
 
@@ -3,12 +3,15 @@
 package container
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -75,7 +78,7 @@ func (s *WSLRuntimeService) recoverNetworkState() {
 	if os.Getenv("PLX_VERBOSE") != "" {
 		fmt.Println("[DEBUG] Recovering network state from existing containers...")
 	}
-	containers, err := s.List()
+	containers, _, err := s.readContainers()
 	if err != nil {
 		fmt.Printf("Warning: Failed to recover network state: %v. IP conflicts may occur.\n", err)
 		return
@@ -88,7 +91,44 @@ func (s *WSLRuntimeService) recoverNetworkState() {
 	}
 }
 
+// RestoreContainers starts the detached containers with a restart policy that went
+// down without being stopped, e.g. after a WSL restart (restoreCandidates). It reads
+// the state before reconciling it, and is called by plx setup (all) and by the
+// dashboard's monitor loop; the reconcile grace window keeps it away from containers
+// that are just being started. With all, "always" containers stopped with plx stop
+// come back as well.
+func (s *WSLRuntimeService) RestoreContainers(all bool) error {
+	containers, dead, err := s.readContainers()
+	if err != nil {
+		return err
+	}
+	return s.restoreContainers(restoreCandidates(containers, dead, all))
+}
+
+func (s *WSLRuntimeService) restoreContainers(ids []string) error {
+	var errs []string
+	for _, id := range ids {
+		fmt.Printf("Restoring container %s (restart policy)...\n", id)
+		if err := s.Start(id); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", id, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to restore containers: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
 func (s *WSLRuntimeService) Run(opts RunOptions) error {
+	if _, err := ParseRestartPolicy(opts.Restart); err != nil {
+		return err
+	}
+	if err := ValidateResources(opts); err != nil {
+		return err
+	}
+	if err := ValidateLogConfig(opts); err != nil {
+		return err
+	}
 	containerId := opts.Name
 	if containerId == "" {
 		containerId = fmt.Sprintf("c-%x", time.Now().UnixNano())
@@ -120,9 +160,9 @@ func (s *WSLRuntimeService) Run(opts RunOptions) error {
 	}
 
 	// B. Load Image Metadata and Setup Environment INSIDE Session (v1.1.6)
+	var imgMeta ImageMetadata
 	if sess != nil {
 		if data, err := sess.Execute(fmt.Sprintf("cat %s", wslImgMetaPath)); err == nil {
-			var imgMeta ImageMetadata
 			if err := json.Unmarshal([]byte(data), &imgMeta); err == nil {
 				if opts.User == "" {
 					opts.User = imgMeta.User
@@ -158,7 +198,6 @@ func (s *WSLRuntimeService) Run(opts RunOptions) error {
 	} else {
 		// Legacy fallback if no session (v0.7.3 logic)
 		if data, err := s.wslClient.RunDistroCommandOutput("cat", wslImgMetaPath); err == nil {
-			var imgMeta ImageMetadata
 			if err := json.Unmarshal([]byte(data), &imgMeta); err == nil {
 				if opts.User == "" {
 					opts.User = imgMeta.User
@@ -168,6 +207,16 @@ func (s *WSLRuntimeService) Run(opts RunOptions) error {
 		}
 	}
 
+	// C. Publish exposed ports (-P) and give declared VOLUMEs anonymous managed volumes
+	if opts.PublishAll {
+		opts.Ports = PublishExposedPorts(opts.Ports, imgMeta.ExposedPorts)
+	}
+	opts.Mounts = append(opts.Mounts, AnonymousVolumeMounts(opts.Mounts, imgMeta.Volumes)...)
+	opts.Healthcheck = MergeHealthConfig(imgMeta.Healthcheck, opts.Healthcheck)
+	if opts.StopSignal == "" {
+		opts.StopSignal = imgMeta.StopSignal
+	}
+
 	wslRootfsPath := wslImgPath
 	// 1. Provisioning Directories
 	if sess != nil {
@@ -200,7 +249,9 @@ func (s *WSLRuntimeService) Run(opts RunOptions) error {
 			if !isPath {
 				volName := m.Source
 				srcWsl = path.Join(GetWslVolumesDir(), volName)
-				volumeMkdirCmds = append(volumeMkdirCmds, fmt.Sprintf("mkdir -p %s", srcWsl))
+				// A new volume is seeded with the image's content at the mount point, like Docker
+				seedDir := path.Join(rootfsDir, strings.TrimPrefix(m.Target, "/"))
+				volumeMkdirCmds = append(volumeMkdirCmds, fmt.Sprintf("if [ ! -d %s ]; then mkdir -p %s; cp -a %s/. %s/ 2>/dev/null || true; fi", srcWsl, srcWsl, seedDir, srcWsl))
 			} else {
 				absSource, _ := filepath.Abs(m.Source)
 				opts.Mounts[i].Source = absSource
@@ -239,6 +290,11 @@ func (s *WSLRuntimeService) Run(opts RunOptions) error {
 		Config:  opts,
 		IP:      ip,
 	}
+	meta.StartedAt = meta.Created
+	// Health is probed by run.sh (detached) or startHealthMonitor (foreground)
+	if opts.Healthcheck.Enabled() {
+		meta.Health = "starting"
+	}
 	metaJSON, _ := json.Marshal(meta)
 
 	// 4. Final Configuration (Hosts, Metadata, Shim, Volumes)
@@ -422,6 +478,20 @@ func (s *WSLRuntimeService) executeContainer(sess *wsl.Session, containerId, con
 	}
 	os.Setenv("WSLENV", wslEnvList)
 
+	// Resource limits and accounting: the shim joins the container's cgroup (PLX_CGROUP).
+	// run.sh sets it up on every start (cgroupfs does not survive a WSL restart); with
+	// limits it is created here as well, so that problems are reported right away.
+	if !opts.Detach || opts.HasResourceLimits() {
+		cmd := s.wslClient.PrepareDistroCommand("sh", "-c", cgroupSetupScript(containerId, opts))
+		out, err := cmd.Output()
+		if err != nil {
+			return fmt.Errorf("failed to set up resource limits: %w", err)
+		}
+		if cg := strings.TrimSpace(string(out)); cg != "" {
+			unshareArgs = append([]string{"env", "PLX_CGROUP=" + cg}, unshareArgs...)
+		}
+	}
+
 	if opts.Detach {
 		if err := s.generateLaunchScript(containerDir, rootfsDir, mountsStr, opts); err != nil {
 			return err
@@ -437,16 +507,43 @@ func (s *WSLRuntimeService) executeContainer(sess *wsl.Session, containerId, con
 	}
 
 	// EXECUTE (v1.1.5: Reuse path if session exists)
-	var err error
-	if sess != nil {
-		fmt.Println("Launching container (inheriting session)...")
-		err = sess.Become(unshareArgs)
-	} else {
-		err = s.wslClient.RunDistroCommand(unshareArgs...)
-	}
+	// The session can only be taken over once; restarts use a new wsl.exe call.
+	policy, _ := ParseRestartPolicy(opts.Restart)
+	launched := false
+	err := superviseForeground(policy, func() error {
+		// The PID is recorded by a second wsl.exe call without stdin, which belongs to the container
+		recorder := exec.Command("wsl.exe", "-d", s.wslClient.DistroName, "-u", "root", "--", "sh", "-c", pidRecordScript(pidFile, path.Join(containerDir, "config.json")))
+		if err := recorder.Start(); err == nil {
+			defer recorder.Wait()
+		}
+		if opts.Healthcheck.Enabled() {
+			stop := s.startHealthMonitor(containerDir, rootfsDir, pidFile, opts.Healthcheck)
+			defer stop()
+		}
+		if sess != nil && !launched {
+			launched = true
+			fmt.Println("Launching container (inheriting session)...")
+			return sess.Become(unshareArgs)
+		}
+		return s.wslClient.RunDistroCommand(unshareArgs...)
+	}, func() bool {
+		return s.wslClient.RunDistroCommand("test", "-e", path.Join(containerDir, "stopped")) == nil
+	}, func(count int) {
+		meta.RestartCount = count
+		meta.StartedAt = time.Now()
+		_, _ = s.wslClient.RunDistroCommandOutput("rm", "-f", pidFile)
+		metaJSON, _ := json.Marshal(meta)
+		_ = s.wslClient.RunDistroCommandWithInput(string(metaJSON), "sh", "-c", fmt.Sprintf("cat > %s/config.json", containerDir))
+	})
+
+	oomOut, _ := s.wslClient.RunDistroCommandOutput("sh", "-c", oomKillsScript(containerId)+cgroupCleanupScript(containerId))
 
 	// Update status
 	meta.Status = "Exited"
+	meta.Health = ""
+	meta.ExitCode = exitCodeOf(err)
+	meta.OOMKilled = parseOOMKilled(oomOut)
+	meta.FinishedAt = time.Now()
 	metaJSON, _ := json.Marshal(meta)
 	if sess != nil && err == nil {
 		// Note: sess is probably closed if Become returned, so we use fallback
@@ -455,6 +552,9 @@ func (s *WSLRuntimeService) executeContainer(sess *wsl.Session, containerId, con
 		s.wslClient.RunDistroCommandWithInput(string(metaJSON), "sh", "-c", fmt.Sprintf("cat > %s/config.json", containerDir))
 	}
 
+	if meta.ExitCode > 0 {
+		return &ExitError{ID: containerId, Code: meta.ExitCode}
+	}
 	if err != nil {
 		return fmt.Errorf("execution failed: %w", err)
 	}
@@ -485,7 +585,8 @@ func (s *WSLRuntimeService) generateLaunchScript(containerDir, rootfsDir, mounts
 	unshareArgs = append(unshareArgs, "/bin/sh", "/usr/local/bin/container-shim", rootfsDir, mountsStr, workdirArg, userArg, pidFile)
 	unshareArgs = append(unshareArgs, opts.Args...)
 
-	logFile := fmt.Sprintf("%s/console.log", containerDir)
+	logFile := fmt.Sprintf("%s/container.log", containerDir)
+	codeFile := fmt.Sprintf("%s/exit.code", containerDir)
 	scriptFile := fmt.Sprintf("%s/run.sh", containerDir)
 
 	var cmdBuilder strings.Builder
@@ -497,12 +598,105 @@ func (s *WSLRuntimeService) generateLaunchScript(containerDir, rootfsDir, mounts
 		cmdBuilder.WriteString("'" + escaped + "'")
 	}
 
-	scriptContent := fmt.Sprintf("#!/bin/sh\n%s > %s 2>&1\nsed -i 's/\"status\":\"Running\"/\"status\":\"Exited\"/g' %s/config.json",
-		cmdBuilder.String(), logFile, containerDir)
+	var script strings.Builder
+	script.WriteString("#!/bin/sh\n")
+	fmt.Fprintf(&script, "CONFIG=%s/config.json\n", containerDir)
+	script.WriteString(setFieldFunc)
+
+	hc := opts.Healthcheck
+	if hc.Enabled() {
+		script.WriteString(s.healthProbeScript(containerDir, rootfsDir, hc))
+	}
+	script.WriteString(cgroupSetupFunc(path.Base(containerDir), opts))
+	script.WriteString(containerStateFuncs(pidFile))
+	fmt.Fprintf(&script, "rm -f %s %s.* %s\n", logFile, logFile, pidFile)
+	fmt.Fprintf(&script, "if ! setup_cgroup 2>> %s; then finished 1; set_field status Exited; exit 1; fi\nexport PLX_CGROUP=\"$CG\"\n", logFile)
+	// The log driver timestamps every line for plx logs --since/--timestamps
+	logCfg, _ := opts.logConfig()
+	command := loggedCommand(cmdBuilder.String(), logFile, codeFile, logCfg)
+	policy, _ := ParseRestartPolicy(opts.Restart)
+	if !policy.Enabled() {
+		fmt.Fprintf(&script, "rm -f %s\n%s &\nMAIN=$!\n", codeFile, command)
+		if hc.Enabled() {
+			script.WriteString("health_loop &\nHEALTH=$!\n")
+		}
+		fmt.Fprintf(&script, "started\nwait \"$MAIN\"\nfinished \"$(cat %s 2>/dev/null || echo 1)\"\n", codeFile)
+		if hc.Enabled() {
+			script.WriteString("kill \"$HEALTH\" 2>/dev/null\n")
+		}
+	} else {
+		script.WriteString(restartSupervisorScript(command, codeFile, path.Join(containerDir, "stopped"), policy, hc.Enabled()))
+	}
+	script.WriteString(cgroupCleanupScript(path.Base(containerDir)))
+	script.WriteString("set_field status Exited\n")
+	scriptContent := script.String()
 
 	return s.wslClient.RunDistroCommandWithInput(scriptContent, "sh", "-c", fmt.Sprintf("cat > %s && chmod +x %s", scriptFile, scriptFile))
 }
 
+// setFieldFunc defines set_field KEY VALUE, which rewrites a string field of $CONFIG in place.
+const setFieldFunc = `set_field() { sed -i "s/\"$1\":\"[^\"]*\"/\"$1\":\"$2\"/" "$CONFIG"; }` + "\n"
+
+// startHealthMonitor probes a foreground container with health_loop, as run.sh does
+// for detached ones, once the shim has written its PID to pidFile. The script is
+// passed on stdin so that the pgrep in health_loop does not find it. The returned
+// function stops the monitor.
+func (s *WSLRuntimeService) startHealthMonitor(containerDir, rootfsDir, pidFile string, hc *HealthConfig) func() {
+	var script strings.Builder
+	fmt.Fprintf(&script, "CONFIG=%s\n", shellQuote(path.Join(containerDir, "config.json")))
+	script.WriteString(setFieldFunc)
+	script.WriteString(s.healthProbeScript(containerDir, rootfsDir, hc))
+	fmt.Fprintf(&script, `i=0
+while [ ! -s %[1]s ] && [ "$i" -lt 50 ]; do sleep 0.1; i=$((i + 1)); done
+MAIN=$(cat %[1]s 2>/dev/null)
+[ -n "$MAIN" ] && health_loop
+`, shellQuote(pidFile))
+
+	cmd := exec.Command("wsl.exe", "-d", s.wslClient.DistroName, "-u", "root", "--", "sh")
+	cmd.Stdin = strings.NewReader(script.String())
+	if err := cmd.Start(); err != nil {
+		fmt.Printf("Warning: failed to start the health check: %v\n", err)
+		return func() {}
+	}
+	return func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}
+}
+
+// healthProbeScript defines health_loop, which runs the probe through the same
+// nsenter + chroot path as Exec and records starting/healthy/unhealthy in config.json.
+// Failures during the start period are not counted.
+func (s *WSLRuntimeService) healthProbeScript(containerDir, rootfsDir string, hc *HealthConfig) string {
+	interval, timeout, startPeriod := hc.seconds()
+	shCmd := fmt.Sprintf("export %s; %s", s.execPathEnv(containerDir), hc.ShellCommand())
+
+	var probe []string
+	for _, a := range append(append([]string{}, nsenterFlags...), containerShellArgs(rootfsDir, shCmd)...) {
+		probe = append(probe, shellQuote(a))
+	}
+
+	return fmt.Sprintf(`health_loop() {
+  START=$(date +%%s)
+  FAILS=0
+  while kill -0 "$MAIN" 2>/dev/null; do
+    sleep %d
+    kill -0 "$MAIN" 2>/dev/null || break
+    P=$(pgrep -f %s | head -n 1)
+    PID=$(pgrep -P "$P" 2>/dev/null | head -n 1)
+    [ -n "$PID" ] || continue
+    if timeout %d nsenter -t "$PID" %s >/dev/null 2>&1; then
+      FAILS=0
+      set_field health healthy
+    elif [ $(( $(date +%%s) - START )) -ge %d ]; then
+      FAILS=$((FAILS + 1))
+      if [ "$FAILS" -ge %d ]; then set_field health unhealthy; fi
+    fi
+  done
+}
+`, interval, shellQuote("container-shim "+rootfsDir+" "), timeout, strings.Join(probe, " "), startPeriod, hc.retries())
+}
+
 func (s *WSLRuntimeService) Exec(idOrName string, cmdArgs []string, interactive bool) error {
 	id, err := s.resolveID(idOrName)
 	if err != nil {
@@ -538,32 +732,9 @@ func (s *WSLRuntimeService) Exec(idOrName string, cmdArgs []string, interactive
 	pid := strings.TrimSpace(childPids[0])
 
 	// Inject common PATHs and host address for ADB
-	pathEnv := "PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+	pathEnv := s.execPathEnv(containerDir)
 	adbEnv := "ANDROID_ADB_SERVER_ADDRESS=host.plx.internal"
 
-	// Try to load image metadata for extra paths (v1.0.8)
-	configPath := path.Join(containerDir, "config.json")
-	if configData, err := s.wslClient.RunDistroCommandOutput("cat", configPath); err == nil {
-		var meta Container
-		if err := json.Unmarshal([]byte(configData), &meta); err == nil {
-			wslImgMetaPath := path.Join(GetWslImagesDir(), meta.Image+".json")
-			if imgData, err := s.wslClient.RunDistroCommandOutput("cat", wslImgMetaPath); err == nil {
-				var imgMeta ImageMetadata
-				if err := json.Unmarshal([]byte(imgData), &imgMeta); err == nil {
-					if p, ok := imgMeta.Env["PATH"]; ok {
-						// Simple expansion for exec context
-						expandedP := strings.ReplaceAll(p, "${PATH}", "/usr/local/bin:/usr/bin:/bin")
-						expandedP = strings.ReplaceAll(expandedP, "$PATH", "/usr/local/bin:/usr/bin:/bin")
-						if imgMeta.Env["FLUTTER_HOME"] != "" {
-							expandedP = strings.ReplaceAll(expandedP, "${FLUTTER_HOME}", imgMeta.Env["FLUTTER_HOME"])
-						}
-						pathEnv = "PATH=" + expandedP
-					}
-				}
-			}
-		}
-	}
-
 	// Simplified execution:
 	// We don't use 'exec' here to support commands with semicolons correctly
 	userCmd := strings.Join(cmdArgs, " ")
@@ -572,8 +743,9 @@ func (s *WSLRuntimeService) Exec(idOrName string, cmdArgs []string, interactive
 	// nsenter -t PID -m -n -u -i -p joins namespaces (mount, net, uts, ipc, pid)
 	// We DON'T use -r (root) because the proc's root may show as "(deleted)" due to mount namespace changes
 	// Instead, we chroot explicitly to the container's rootfs directory
-	rootfsPath := fmt.Sprintf("/var/lib/pocketlinx/containers/%s/rootfs", id)
-	args := []string{"-d", s.wslClient.DistroName, "-u", "root", "--", "nsenter", "-t", pid, "-m", "-n", "-u", "-i", "-p", "--", "chroot", rootfsPath, "/bin/sh", "-c", shCmd}
+	args := []string{"-d", s.wslClient.DistroName, "-u", "root", "--", "nsenter", "-t", pid}
+	args = append(args, nsenterFlags...)
+	args = append(args, containerShellArgs(rootfsDir, shCmd)...)
 
 	if os.Getenv("PLX_VERBOSE") != "" {
 		fmt.Printf("[DEBUG] Executing in container %s: %v\n", id, cmdArgs)
@@ -595,6 +767,47 @@ func (s *WSLRuntimeService) Exec(idOrName string, cmdArgs []string, interactive
 	return nil
 }
 
+// nsenterFlags joins the container's mount, net, uts, ipc and pid namespaces.
+var nsenterFlags = []string{"-m", "-n", "-u", "-i", "-p", "--"}
+
+// containerShellArgs runs shCmd through /bin/sh inside the container's rootfs.
+// Used after nsenter by Exec and by the healthcheck probe in run.sh.
+func containerShellArgs(rootfsDir, shCmd string) []string {
+	return []string{"chroot", rootfsDir, "/bin/sh", "-c", shCmd}
+}
+
+// execPathEnv returns the PATH assignment for commands run inside a container,
+// taking the image's ENV PATH into account (v1.0.8).
+func (s *WSLRuntimeService) execPathEnv(containerDir string) string {
+	pathEnv := "PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+	configPath := path.Join(containerDir, "config.json")
+	if configData, err := s.wslClient.RunDistroCommandOutput("cat", configPath); err == nil {
+		var meta Container
+		if err := json.Unmarshal([]byte(configData), &meta); err == nil {
+			wslImgMetaPath := path.Join(GetWslImagesDir(), meta.Image+".json")
+			if imgData, err := s.wslClient.RunDistroCommandOutput("cat", wslImgMetaPath); err == nil {
+				var imgMeta ImageMetadata
+				if err := json.Unmarshal([]byte(imgData), &imgMeta); err == nil {
+					if p, ok := imgMeta.Env["PATH"]; ok {
+						// Simple expansion for exec context
+						expandedP := strings.ReplaceAll(p, "${PATH}", "/usr/local/bin:/usr/bin:/bin")
+						expandedP = strings.ReplaceAll(expandedP, "$PATH", "/usr/local/bin:/usr/bin:/bin")
+						if imgMeta.Env["FLUTTER_HOME"] != "" {
+							expandedP = strings.ReplaceAll(expandedP, "${FLUTTER_HOME}", imgMeta.Env["FLUTTER_HOME"])
+						}
+						pathEnv = "PATH=" + expandedP
+					}
+				}
+			}
+		}
+	}
+	return pathEnv
+}
+
+func (s *WSLRuntimeService) Networks() []Network {
+	return []Network{s.network.Info()}
+}
+
 func (s *WSLRuntimeService) resolveID(idOrName string) (string, error) {
 	// 1. Check if ID directly exists
 	containerDir := fmt.Sprintf("/var/lib/pocketlinx/containers/%s", idOrName)
@@ -622,6 +835,11 @@ func (s *WSLRuntimeService) Start(idOrName string) error {
 	if err != nil {
 		return err
 	}
+	// Reconciled first, so that a container whose process is gone can be started again
+	meta, haveMeta := s.findContainer(id)
+	if haveMeta && (meta.Status == "Running" || meta.Status == "Restarting") {
+		return fmt.Errorf("container %s is already running", id)
+	}
 	fmt.Printf("Starting container %s...\n", id)
 
 	// Lazy Network Init
@@ -639,16 +857,23 @@ func (s *WSLRuntimeService) Start(idOrName string) error {
 
 	// Update status to Running BEFORE starting
 	configPath := fmt.Sprintf("%s/config.json", containerDir)
-	out, err := exec.Command("wsl.exe", "-d", s.wslClient.DistroName, "--", "cat", configPath).Output()
 	var ip string
-	if err == nil {
-		var meta Container
-		if err := json.Unmarshal(out, &meta); err == nil {
-			meta.Status = "Running"
-			ip = meta.IP // Retrieve IP from config
-			metaJSON, _ := json.Marshal(meta)
-			_ = s.wslClient.RunDistroCommandWithInput(string(metaJSON), "sh", "-c", fmt.Sprintf("cat > %s", configPath))
+	if haveMeta {
+		meta.Status = "Running"
+		meta.RestartCount = 0
+		meta.ExitReason = ""
+		if meta.Config.Healthcheck.Enabled() {
+			meta.Health = "starting"
 		}
+		if meta.IP == "" && os.Getenv("PLX_SKIP_NETWORK") == "" {
+			// Released when the container was found dead (reconcile)
+			if meta.IP, err = s.network.AllocateIP(); err != nil {
+				return fmt.Errorf("failed to allocate ip: %w", err)
+			}
+		}
+		ip = meta.IP // Retrieve IP from config
+		metaJSON, _ := json.Marshal(meta)
+		_ = s.wslClient.RunDistroCommandWithInput(string(metaJSON), "sh", "-c", fmt.Sprintf("cat > %s", configPath))
 	}
 
 	// 2.5 Ensure Network is configured (for persistent/restart)
@@ -680,7 +905,8 @@ func (s *WSLRuntimeService) Start(idOrName string) error {
 	// 3. Execution: Wrap with 'ip netns exec' and run as root
 	// Use daemonize pattern: nohup runs in subshell which is immediately disowned
 	// The double-fork pattern ensures the process survives WSL session termination
-	startCmd := fmt.Sprintf("nohup ip netns exec %s sh %s >%s/console.log 2>&1 </dev/null &", id, scriptFile, containerDir)
+	// Clear the stop request left by plx stop so that the restart policy applies again
+	startCmd := fmt.Sprintf("rm -f %s/stopped; nohup ip netns exec %s sh %s >%s/console.log 2>&1 </dev/null &", containerDir, id, scriptFile, containerDir)
 
 	cmd := exec.Command("wsl.exe", "-d", s.wslClient.DistroName, "-u", "root", "--", "sh", "-c", startCmd)
 	if err := cmd.Run(); err != nil {
@@ -690,28 +916,218 @@ func (s *WSLRuntimeService) Start(idOrName string) error {
 	return nil
 }
 
+// List returns all containers. Those that config.json reports as running but whose
+// process is gone (crashed, killed outside plx, WSL shut down) are marked Exited first
+// and their network is released, see reconcile.
 func (s *WSLRuntimeService) List() ([]Container, error) {
+	containers, dead, err := s.readContainers()
+	if err != nil {
+		return nil, nil
+	}
+	if len(dead) > 0 {
+		s.reconcile(containers, dead)
+	}
+	return containers, nil
+}
+
+// readContainers reads every config.json and checks the containers that claim to be
+// running (reconcileScript) in the same wsl.exe call.
+func (s *WSLRuntimeService) readContainers() ([]Container, map[string]bool, error) {
 	// 圧倒的高速化: find + exec cat を1回の wsl.exe 呼び出しで完結させる
-	cmdText := "find /var/lib/pocketlinx/containers -name config.json -exec cat {} +"
+	cmdText := "find /var/lib/pocketlinx/containers -name config.json -exec cat {} +; echo; echo '#reconcile'\n" +
+		reconcileScript("/var/lib/pocketlinx/containers", "container-shim")
 	cmd := exec.Command("wsl.exe", "-d", s.wslClient.DistroName, "--", "sh", "-c", cmdText)
 	out, err := cmd.Output()
 	if err != nil {
-		return nil, nil
+		return nil, nil, err
 	}
+	configs, states, _ := strings.Cut(string(out), "\n#reconcile\n")
 
 	var containers []Container
 	// 解読: 連結されたJSONをデコード
-	dec := json.NewDecoder(strings.NewReader(string(out)))
+	dec := json.NewDecoder(strings.NewReader(configs))
 	for dec.More() {
 		var c Container
 		if err := dec.Decode(&c); err == nil {
 			containers = append(containers, c)
 		}
 	}
-	return containers, nil
+	return containers, deadContainers(states, containers), nil
+}
+
+// reconcile marks the dead containers Exited (markDead) and releases what they held:
+// their IP (Start allocates a new one), network namespace and cgroup. Port proxies
+// follow the status and are closed by the API server.
+func (s *WSLRuntimeService) reconcile(containers []Container, dead map[string]bool) {
+	var script strings.Builder
+	now := time.Now()
+	for i := range containers {
+		c := &containers[i]
+		if !dead[c.ID] {
+			continue
+		}
+		if os.Getenv("PLX_VERBOSE") != "" {
+			fmt.Printf("[DEBUG] Container %s is no longer running, marking it Exited\n", c.ID)
+		}
+		if c.IP != "" && c.IP != "127.0.0.1" {
+			s.network.ReleaseIP(c.IP)
+			fmt.Fprintf(&script, "ip netns del %s 2>/dev/null\n", shellQuote(c.ID))
+			c.IP = ""
+		}
+		c.markDead(now)
+		metaJSON, _ := json.Marshal(c)
+		fmt.Fprintf(&script, "cat > %s <<'EOF'\n%s\nEOF\n", shellQuote(path.Join("/var/lib/pocketlinx/containers", c.ID, "config.json")), metaJSON)
+		script.WriteString(cgroupCleanupScript(c.ID))
+	}
+	cmd := exec.Command("wsl.exe", "-d", s.wslClient.DistroName, "-u", "root", "--", "sh")
+	cmd.Stdin = strings.NewReader(script.String())
+	if err := cmd.Run(); err != nil {
+		fmt.Printf("Warning: failed to mark stopped containers as exited: %v\n", err)
+	}
 }
 
-func (s *WSLRuntimeService) Stop(idOrName string) error {
+// findContainer returns the container with the given ID from List, i.e. reconciled.
+func (s *WSLRuntimeService) findContainer(id string) (Container, bool) {
+	containers, _ := s.List()
+	for _, c := range containers {
+		if c.ID == id {
+			return c, true
+		}
+	}
+	return Container{}, false
+}
+
+// Stats reads the cgroup and network namespace counters of all running containers
+// with a single wsl.exe call.
+func (s *WSLRuntimeService) Stats() ([]ContainerStats, error) {
+	containers, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	ids := runningIDs(containers)
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	out, err := s.wslClient.RunDistroCommandOutput("sh", "-c", statsScript(ids, true))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read container stats: %w", err)
+	}
+	return parseStats(out, containers), nil
+}
+
+// Top lists the processes of a running container. psArgs, if given, are passed to ps
+// in the distro and its output is filtered to the container's processes.
+func (s *WSLRuntimeService) Top(idOrName string, psArgs []string) (*ContainerTop, error) {
+	id, err := s.resolveID(idOrName)
+	if err != nil {
+		return nil, err
+	}
+	containerDir := path.Join("/var/lib/pocketlinx/containers", id)
+	script := topScript("container-shim", path.Join(containerDir, "rootfs"), path.Join(containerDir, "shim.pid"), psArgs)
+	out, err := s.wslClient.RunDistroCommandOutput("sh", "-c", script)
+	if exitCodeOf(err) == 3 {
+		return nil, fmt.Errorf("container %s is not running", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list processes of container %s: %w", id, err)
+	}
+	return parseTop(out, psArgs)
+}
+
+// wslCopyPath converts a host path of plx cp to its path in the distro, keeping a
+// trailing "/." (copy the contents of the directory).
+func wslCopyPath(hostPath string) (string, error) {
+	if _, err := os.Stat(hostPath); err != nil {
+		return "", err
+	}
+	p, err := wsl.WindowsToWslPath(hostPath)
+	if err != nil {
+		return "", err
+	}
+	if hostPath == "." || strings.HasSuffix(hostPath, "/.") || strings.HasSuffix(hostPath, `\.`) {
+		p = strings.TrimSuffix(p, "/") + "/."
+	}
+	return p, nil
+}
+
+// copyCommand prepares a copy script (see archive.go) for the container's rootfs.
+func (s *WSLRuntimeService) copyCommand(idOrName string, build func(pidScript, rootfsDir string) string) (*exec.Cmd, string, error) {
+	id, err := s.resolveID(idOrName)
+	if err != nil {
+		return nil, "", err
+	}
+	containerDir := path.Join("/var/lib/pocketlinx/containers", id)
+	rootfsDir := path.Join(containerDir, "rootfs")
+	script := build(containerPIDScript("container-shim", rootfsDir, path.Join(containerDir, "shim.pid")), rootfsDir)
+	return exec.Command("wsl.exe", "-d", s.wslClient.DistroName, "-u", "root", "--", "sh", "-c", script), id, nil
+}
+
+func (s *WSLRuntimeService) CopyToContainer(idOrName, hostPath, containerPath string, copyOwnership bool) error {
+	src, err := wslCopyPath(hostPath)
+	if err != nil {
+		return err
+	}
+	cmd, id, err := s.copyCommand(idOrName, func(pidScript, rootfsDir string) string {
+		return copyToScript(pidScript, src, rootfsDir, containerPath, copyOwnership)
+	})
+	if err != nil {
+		return err
+	}
+	if err := runCopyScript(cmd); err != nil {
+		return fmt.Errorf("failed to copy %s to %s:%s: %w", hostPath, id, containerPath, err)
+	}
+	return nil
+}
+
+func (s *WSLRuntimeService) CopyFromContainer(idOrName, containerPath, hostPath string) error {
+	dst, err := wsl.WindowsToWslPath(hostPath)
+	if err != nil {
+		return err
+	}
+	if strings.HasSuffix(hostPath, "/") || strings.HasSuffix(hostPath, `\`) {
+		dst += "/"
+	}
+	cmd, id, err := s.copyCommand(idOrName, func(pidScript, rootfsDir string) string {
+		return copyFromScript(pidScript, rootfsDir, containerPath, dst)
+	})
+	if err != nil {
+		return err
+	}
+	if err := runCopyScript(cmd); err != nil {
+		return fmt.Errorf("failed to copy %s:%s to %s: %w", id, containerPath, hostPath, err)
+	}
+	return nil
+}
+
+func (s *WSLRuntimeService) GetArchive(idOrName, containerPath string, w io.Writer) error {
+	cmd, id, err := s.copyCommand(idOrName, func(pidScript, rootfsDir string) string {
+		return getArchiveScript(pidScript, rootfsDir, containerPath)
+	})
+	if err != nil {
+		return err
+	}
+	cmd.Stdout = w
+	if err := runCopyScript(cmd); err != nil {
+		return fmt.Errorf("failed to archive %s:%s: %w", id, containerPath, err)
+	}
+	return nil
+}
+
+func (s *WSLRuntimeService) PutArchive(idOrName, containerPath string, r io.Reader, copyOwnership bool) error {
+	cmd, id, err := s.copyCommand(idOrName, func(pidScript, rootfsDir string) string {
+		return putArchiveScript(pidScript, rootfsDir, containerPath, copyOwnership)
+	})
+	if err != nil {
+		return err
+	}
+	cmd.Stdin = r
+	if err := runCopyScript(cmd); err != nil {
+		return fmt.Errorf("failed to extract the archive to %s:%s: %w", id, containerPath, err)
+	}
+	return nil
+}
+
+func (s *WSLRuntimeService) Stop(idOrName string, timeout time.Duration) error {
 	id, err := s.resolveID(idOrName)
 	if err != nil {
 		return err
@@ -720,21 +1136,20 @@ func (s *WSLRuntimeService) Stop(idOrName string) error {
 	configPath := fmt.Sprintf("%s/config.json", containerDir)
 	rootfsDir := fmt.Sprintf("%s/rootfs", containerDir)
 
-	// 1. Read PID from file if exists (v0.8.0)
-	pidFile := path.Join(containerDir, "shim.pid")
-	pidBytes, err := s.wslClient.RunDistroCommandOutput("cat", pidFile)
-	if err == nil && strings.TrimSpace(pidBytes) != "" {
-		pid := strings.TrimSpace(pidBytes)
-		// Verify if the PID is still alive and belongs to the shim (v0.8.1)
-		// kill -0 just checks existence.
-		if err := s.wslClient.RunDistroCommand("kill", "-0", pid); err == nil {
-			// Check process context to be absolutely sure (v0.8.1)
-			cmdline, _ := s.wslClient.RunDistroCommandOutput("cat", fmt.Sprintf("/proc/%s/cmdline", pid))
-			if strings.Contains(cmdline, "container-shim") && strings.Contains(cmdline, id) {
-				_ = s.wslClient.RunDistroCommand("kill", "-9", pid)
-			}
-		}
+	// A container whose process is already gone is marked Exited ("unknown") here
+	meta, haveMeta := s.findContainer(id)
+
+	signal := meta.Config.StopSignal
+	if signal == "" {
+		signal = DefaultStopSignal
 	}
+	sigNum, err := ParseSignal(signal)
+	if err != nil {
+		return err
+	}
+
+	// 1. Graceful stop: signal the container's PID 1, wait, then SIGKILL
+	reason := s.signalAndWait(id, containerDir, rootfsDir, sigNum, timeout)
 
 	// 2. Kill everything that has the container ID in its command line or process name
 	// Use more specific pattern to avoid 'c1' matches 'c11' (v0.8.0)
@@ -743,9 +1158,7 @@ func (s *WSLRuntimeService) Stop(idOrName string) error {
 	_ = s.wslClient.RunDistroCommand("sh", "-c", stopCmd)
 	_ = s.wslClient.RunDistroCommand("sh", "-c", fmt.Sprintf("pkill -9 -f 'ip netns exec %s' || true", id))
 
-	// 3. Kill anything remaining inside the container's rootfs (orphaned internal processes)
-
-	// 4. Clean up Mounts (v0.8.0)
+	// 3. Clean up Mounts (v0.8.0)
 	// /proc/mounts を解析し、rootfsDir 以下のすべてのマウントポイントを特定して、
 	// 依存関係を考慮した逆順（深い順）で強制アンマウント（-l）する。
 	// grep パターンと while 内の変数をクォートしてスペースに対応 (v0.8.1)
@@ -757,39 +1170,119 @@ func (s *WSLRuntimeService) Stop(idOrName string) error {
 			[ -n "$mnt_clean" ] && umount -l "$mnt_clean" 2>/dev/null || true
 		done
 	`, rootfsDir)
-	_ = s.wslClient.RunDistroCommand("sh", "-c", unmountScript)
+	// 4. Remove the resource limit cgroup
+	_ = s.wslClient.RunDistroCommand("sh", "-c", unmountScript+cgroupCleanupScript(id))
 
 	// Update metadata status
-
-	cmd := exec.Command("wsl.exe", "-d", s.wslClient.DistroName, "--", "cat", configPath)
-	out, err := cmd.Output()
-	if err == nil {
-		var meta Container
-		if err := json.Unmarshal(out, &meta); err == nil {
-			meta.Status = "Exited"
-			metaJSON, _ := json.Marshal(meta)
-			_ = s.wslClient.RunDistroCommandWithInput(string(metaJSON), "sh", "-c", fmt.Sprintf("cat > %s", configPath))
+	if haveMeta {
+		meta.Status = "Exited"
+		meta.Health = ""
+		if reason != "" {
+			meta.ExitCode = s.stoppedExitCode(containerDir, meta.Config.Detach, reason, sigNum)
+			meta.FinishedAt = time.Now()
+		} else {
+			// Already gone (e.g. found dead by reconcile): it is stopped now, not lost,
+			// so RestoreContainers must leave it alone
+			reason = "stopped"
 		}
+		meta.ExitReason = reason
+		meta.Pid = 0
+		metaJSON, _ := json.Marshal(meta)
+		_ = s.wslClient.RunDistroCommandWithInput(string(metaJSON), "sh", "-c", fmt.Sprintf("cat > %s", configPath))
 	}
 
-	fmt.Printf("Container %s stopped.\n", id)
+	switch reason {
+	case "killed":
+		fmt.Printf("Container %s did not exit within %s and was killed.\n", id, timeout)
+	default:
+		fmt.Printf("Container %s stopped.\n", id)
+	}
 	return nil
 }
 
-func (s *WSLRuntimeService) Logs(idOrName string) (string, error) {
-	id, err := s.resolveID(idOrName)
+// stoppedExitCode returns the exit code of a container plx stop has just ended. run.sh
+// saves the command's status in exit.code right after it exits; foreground containers
+// and commands that could not save it get stopExitCode.
+func (s *WSLRuntimeService) stoppedExitCode(containerDir string, detached bool, reason string, sig int) int {
+	if detached {
+		codeFile := shellQuote(path.Join(containerDir, "exit.code"))
+		script := fmt.Sprintf("i=0\nwhile [ ! -s %s ] && [ \"$i\" -lt 10 ]; do sleep 0.1; i=$((i + 1)); done\ncat %s", codeFile, codeFile)
+		if out, err := s.wslClient.RunDistroCommandOutput("sh", "-c", script); err == nil {
+			if code, err := strconv.Atoi(strings.TrimSpace(out)); err == nil {
+				return code
+			}
+		}
+	}
+	return stopExitCode(reason, sig)
+}
+
+// signalAndWait sends sig to the container's PID 1 and waits up to timeout for it to exit,
+// then falls back to SIGKILL. It returns "stopped", "killed", or "" if nothing was running.
+func (s *WSLRuntimeService) signalAndWait(id, containerDir, rootfsDir string, sig int, timeout time.Duration) string {
+	// shim.pid holds the host PID of the shim, which execs into the container's PID 1
+	// (verified by containerPIDScript). The stopped file tells the restart supervisor (run.sh) not to start the container again.
+	script := fmt.Sprintf("touch %s\n", shellQuote(path.Join(containerDir, "stopped"))) +
+		containerPIDScript("container-shim", rootfsDir, path.Join(containerDir, "shim.pid")) + fmt.Sprintf(`[ -n "$PID" ] || exit 0
+kill -%d "$PID" 2>/dev/null
+i=0
+while kill -0 "$PID" 2>/dev/null; do
+  if [ "$i" -ge %d ]; then
+    kill -9 "$PID" 2>/dev/null
+    echo killed
+    exit 0
+  fi
+  sleep 0.1
+  i=$((i + 1))
+done
+echo stopped
+`, sig, int(timeout/(100*time.Millisecond)))
+
+	if os.Getenv("PLX_VERBOSE") != "" {
+		fmt.Printf("[DEBUG] Sending signal %d to container %s (timeout %s)\n", sig, id, timeout)
+	}
+	out, err := s.wslClient.RunDistroCommandOutput("sh", "-c", script)
 	if err != nil {
-		return "", err
+		return ""
 	}
-	logFile := fmt.Sprintf("/var/lib/pocketlinx/containers/%s/console.log", id)
+	return strings.TrimSpace(out)
+}
 
-	cmd := exec.Command("wsl.exe", "-d", s.wslClient.DistroName, "--", "cat", logFile)
-	out, err := cmd.Output()
+// Logs writes the container's log to w. With opts.Follow it keeps streaming until the
+// container exits or ctx is cancelled.
+func (s *WSLRuntimeService) Logs(ctx context.Context, idOrName string, opts LogOptions, w io.Writer) error {
+	id, err := s.resolveID(idOrName)
 	if err != nil {
-		return "", fmt.Errorf("failed to read logs for container %s (maybe no logs yet): %w", id, err)
+		return err
 	}
+	containerDir := fmt.Sprintf("/var/lib/pocketlinx/containers/%s", id)
+	script := logReadScript(path.Join(containerDir, "container.log"), path.Join(containerDir, "console.log"), path.Join(containerDir, "config.json"), opts)
 
-	return string(out), nil
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "wsl.exe", "-d", s.wslClient.DistroName, "-u", "root", "--", "sh", "-c", script)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to read logs for container %s: %w", id, err)
+	}
+	copyErr := copyLogs(stdout, w, opts)
+	if copyErr != nil {
+		cancel() // --until reached or the reader went away: stop tail -f
+	}
+	waitErr := cmd.Wait()
+	switch {
+	case copyErr != nil && copyErr != errLogsUntil:
+		return copyErr
+	case copyErr == nil && exitCodeOf(waitErr) == 3:
+		return fmt.Errorf("no logs for container %s yet", id)
+	case copyErr == nil && exitCodeOf(waitErr) == 4:
+		return fmt.Errorf("container %s was started with --log-driver none", id)
+	case copyErr == nil && waitErr != nil && ctx.Err() == nil:
+		return fmt.Errorf("failed to read logs for container %s: %w", id, waitErr)
+	}
+	return nil
 }
 
 func (s *WSLRuntimeService) Remove(idOrName string) error {
@@ -801,7 +1294,7 @@ func (s *WSLRuntimeService) Remove(idOrName string) error {
 	ip, _ := s.GetIP(id) // Best effort
 
 	containerDir := fmt.Sprintf("/var/lib/pocketlinx/containers/%s", id)
-	err = s.wslClient.RunDistroCommand("rm", "-rf", containerDir)
+	err = s.wslClient.RunDistroCommand("sh", "-c", cgroupCleanupScript(id)+"rm -rf "+shellQuote(containerDir))
 
 	// Cleanup Network
 	if ip != "" && ip != "127.0.0.1" {
@@ -66,3 +66,11 @@ func (s *WSLVolumeService) List() ([]string, error) {
 	}
 	return volumes, nil
 }
+
+func (s *WSLVolumeService) Inspect(name string) (*Volume, error) {
+	volDir := path.Join(GetWslVolumesDir(), name)
+	if err := s.wslClient.RunDistroCommand("test", "-d", volDir); err != nil {
+		return nil, fmt.Errorf("volume '%s' not found", name)
+	}
+	return &Volume{Name: name, Mountpoint: volDir}, nil
+}
@@ -14,8 +14,22 @@ if [ -z "$ROOTFS" ]; then
   exit 1
 fi
 
-if [ -n "$PID_FILE" ]; then
-  echo $$ > "$PID_FILE"
+# $$ is 1 inside the new PID namespace; /proc is still the host's here, so this is our host PID.
+# After the final exec this process becomes the container's PID 1.
+read -r HOST_PID _ < /proc/self/stat
+
+# Join the container's cgroup (resource limits) before anything else runs
+if [ -n "$PLX_CGROUP" ]; then
+  if ! echo "$HOST_PID" > "$PLX_CGROUP/cgroup.procs"; then
+    echo "Error: failed to join cgroup $PLX_CGROUP"
+    exit 1
+  fi
+  unset PLX_CGROUP
+fi
+
+if [ -n "$PID_FILE" ] && [ "$PID_FILE" != "none" ]; then
+  # Record the host PID so that stop can signal us
+  echo "$HOST_PID" > "$PID_FILE"
 fi
 
 if [ ! -d "$ROOTFS" ]; then